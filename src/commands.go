@@ -0,0 +1,622 @@
+package main
+
+import (
+	"encoding/json"
+	"errord"
+	"flag"
+	"fmt"
+	"log"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+const ISSUES_USAGE string = "issues | issues <resolve|unresolve|ignore> <fingerprint> | issues mute <fingerprint> <duration> - Print issues or change their status"
+
+const SILENCES_USAGE string = "silences | silences add [-exception <regex>] [-fingerprint <fingerprint>] [-source <regex>] [-service <service>] " +
+	"[-for 2h | -until <RFC3339 time>] -by <name> -comment <why> | silences expire <id> - Print, create or expire silences"
+
+const TEMPLATE_USAGE string = "template preview [-dir templates] [-notifier <name>] [-type new|threshold|resolved|regression|digest] [-html] - " +
+	"Render notification templates with sample data"
+
+const MAINTENANCE_USAGE string = "maintenance | maintenance add -name <name> -cron <cron expression> -for <duration> [-action hold|drop] " +
+	"[-exception <regex>] [-source <regex>] [-service <service>] -by <name> -comment <why> | maintenance delete <id> - Print, create or delete maintenance windows"
+
+const TAIL_USAGE string = "tail [-api http://localhost:8080] [-exception <regex>] [-source <regex>] [-level ERROR] [-decisions] - " +
+	"Follow the error events, and with -decisions the anomaly decisions, of the daemon as they happen"
+
+const WATCH_USAGE string = "watch -tailFile <path> [-oldLogs <dir>] [-listen :8080] [flags] - Run the daemon: backfill old logs, update the stats " +
+	"and tail the file, notifying of anomalies. Run watch -h for every flag. Without a command errord runs watch"
+
+const INGEST_USAGE string = "ingest [-recompute=false] <file or directory>... - Parse log files, and the .log files of directories, into the " +
+	"database once and rebuild the summaries and stats"
+
+const QUERY_USAGE string = "query [-since 24h] [-until <RFC3339 time or period>] [-exception <name>] [-limit 100] [-offset 0] [-json] - " +
+	"Search the stored error events, newest first"
+
+const NOTIFY_TEST_USAGE string = "notify-test [-notifierConfig <path> | -emailConfig <path>] [-notifier <name>] " +
+	"[-type new|threshold|resolved|regression|digest] - Send a sample notification through every configured notifier"
+
+type command struct {
+	usage string
+	run   func(args []string)
+}
+
+var commands = map[string]command{
+	"watch":         {WATCH_USAGE, watchCommand},
+	"ingest":        {INGEST_USAGE, ingestCommand},
+	"stats":         {"stats [exception] - Print the stat items of every exception, or the stat item and day summaries of one exception", statsCommand},
+	"query":         {QUERY_USAGE, queryCommand},
+	"notify-test":   {NOTIFY_TEST_USAGE, notifyTestCommand},
+	"recompute":     {"recompute - Rebuild the day summaries, stat items and issues from the stored error events", recomputeCommand},
+	"correlate":     {"correlate [-since 24h] [-bucket 1m] - Print which exceptions occur together", correlateCommand},
+	"issues":        {ISSUES_USAGE, issuesCommand},
+	"releases":      {"releases | releases add -version <version> -service <service> [-at <RFC3339 time>] | releases report - Print, record or report on releases", releasesCommand},
+	"outbox":        {"outbox [-since 24h] | outbox retry <id> - Print the delivery state of notifications or retry an undelivered notification now", outboxCommand},
+	"report":        {"report [-since 7d] [-html] - Print a report of the top, new and resolved exceptions and the biggest movers", reportCommand},
+	"silences":      {SILENCES_USAGE, silencesCommand},
+	"maintenance":   {MAINTENANCE_USAGE, maintenanceCommand},
+	"template":      {TEMPLATE_USAGE, templateCommand},
+	"notifications": {"notifications [-since 24h] - Print the notifications that were sent and the decisions of the notification policy", notificationsCommand},
+	"tail":          {TAIL_USAGE, tailCommand},
+	"incidents":     {"incidents [-since 24h] | incidents ack <id> - Print incidents or acknowledge an open incident", incidentsCommand},
+}
+
+// runCommand runs the command named by the first argument. When there is no such command false is returned and errord runs as a daemon
+func runCommand(args []string) bool {
+	if len(args) == 0 {
+		return false
+	}
+	if args[0] == "help" {
+		printUsage()
+		return true
+	}
+	c, ok := commands[args[0]]
+	if !ok {
+		return false
+	}
+	c.run(args[1:])
+	return true
+}
+
+func printUsage() {
+	names := []string{}
+	for name := range commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	fmt.Fprintln(os.Stderr, "Usage: errord <command> [arguments]\n\nCommands:")
+	for _, name := range names {
+		fmt.Fprintf(os.Stderr, "  %v\n", commands[name].usage)
+	}
+}
+
+func openStore() errord.Store {
+	s := errord.NewStore()
+	if errs := s.Init(); len(errs) > 0 {
+		log.Printf("There were problems initializing the database: [%v]\n", errs)
+	}
+	return s
+}
+
+func correlateCommand(args []string) {
+	flags := flag.NewFlagSet("correlate", flag.ExitOnError)
+	since := flags.Duration("since", 24*time.Hour, "How far back to look for error events")
+	bucket := flags.Duration("bucket", time.Minute, "Size of the time buckets events are counted in")
+	flags.Parse(args)
+
+	events := openStore().Errors().FetchErrorEvents(time.Now().Add(-*since))
+	w := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(w, "EXCEPTION\tEXCEPTION\tCO-OCCURRENCE\tCORRELATION")
+	for _, c := range errord.Correlate(events, *bucket) {
+		if c.CoOccurrence == 0 {
+			continue
+		}
+		fmt.Fprintf(w, "%v\t%v\t%v\t%.2f\n", c.First, c.Second, c.CoOccurrence, c.Coefficient)
+	}
+	w.Flush()
+}
+
+func incidentsCommand(args []string) {
+	if len(args) == 2 && args[0] == "ack" {
+		id, err := strconv.Atoi(args[1])
+		if err != nil {
+			log.Fatalf("Invalid incident id: %v", args[1])
+		}
+		if err := openStore().Incidents().Acknowledge(id); err != nil {
+			log.Fatalf("Failed acknowledging Incident #%v: %v", id, err)
+		}
+		fmt.Printf("Incident #%v acknowledged\n", id)
+		return
+	}
+	flags := flag.NewFlagSet("incidents", flag.ExitOnError)
+	since := flags.Duration("since", 24*time.Hour, "Print incidents updated within this period")
+	flags.Parse(args)
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(w, "ID\tEXCEPTION\tSTATE\tOPENED\tLAST SEEN\tCOUNT")
+	for _, i := range openStore().Incidents().FetchIncidents(time.Now().Add(-*since)) {
+		fmt.Fprintf(w, "%v\t%v\t%v\t%v\t%v\t%v\n", i.Id, i.Exception, i.State, i.OpenedAt.Format(time.RFC3339), i.UpdatedAt.Format(time.RFC3339), i.Count)
+	}
+	w.Flush()
+}
+
+func reportCommand(args []string) {
+	flags := flag.NewFlagSet("report", flag.ExitOnError)
+	since := flags.String("since", "7d", "Period the report covers, for example 24h or 7d")
+	html := flags.Bool("html", false, "Print the report as HTML")
+	flags.Parse(args)
+
+	period, err := errord.ParsePeriod(*since)
+	if err != nil {
+		log.Fatalf("%v", err)
+	}
+	s := openStore()
+	now := time.Now()
+	report := errord.CreateReport("Error report", s.Stats(), s.Issues(), s.Errors(), now.Add(-period), now)
+	if !*html {
+		fmt.Print(report.Text())
+		return
+	}
+	content, err := report.HTML()
+	if err != nil {
+		log.Fatalf("Failed rendering report: %v", err)
+	}
+	fmt.Print(content)
+}
+
+// matcherFlags adds the flags of a Matcher to the flag set
+func matcherFlags(flags *flag.FlagSet, m *errord.Matcher) {
+	flags.StringVar(&m.Exception, "exception", "", "Regular expression the exception must match")
+	flags.StringVar(&m.Fingerprint, "fingerprint", "", "Fingerprint of the issue")
+	flags.StringVar(&m.Source, "source", "", "Regular expression the source must match")
+	flags.StringVar(&m.Service, "service", "", "Service errord runs for")
+}
+
+func silencesCommand(args []string) {
+	switch {
+	case len(args) == 0:
+		w := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+		fmt.Fprintln(w, "ID\tEXCEPTION\tFINGERPRINT\tSOURCE\tSERVICE\tSTARTS\tENDS\tBY\tCOMMENT")
+		for _, s := range openStore().Silences().FetchSilences(time.Now()) {
+			fmt.Fprintf(w, "%v\t%v\t%v\t%v\t%v\t%v\t%v\t%v\t%v\n", s.Id, s.Exception, s.Fingerprint, s.Source, s.Service,
+				s.StartsAt.Format(time.RFC3339), s.EndsAt.Format(time.RFC3339), s.CreatedBy, s.Comment)
+		}
+		w.Flush()
+	case len(args) == 2 && args[0] == "expire":
+		id, err := strconv.Atoi(args[1])
+		if err != nil {
+			log.Fatalf("Invalid silence id: %v", args[1])
+		}
+		if err := openStore().Silences().ExpireSilence(id); err != nil {
+			log.Fatalf("Failed expiring Silence #%v: %v", id, err)
+		}
+		fmt.Printf("Silence #%v expired\n", id)
+	case args[0] == "add":
+		silence := &errord.Silence{StartsAt: time.Now()}
+		flags := flag.NewFlagSet("silences add", flag.ExitOnError)
+		matcherFlags(flags, &silence.Matcher)
+		duration := flags.Duration("for", time.Hour, "How long the silence lasts")
+		until := flags.String("until", "", "Time the silence ends in RFC3339. Takes precedence over -for")
+		flags.StringVar(&silence.CreatedBy, "by", os.Getenv("USER"), "Who created the silence")
+		flags.StringVar(&silence.Comment, "comment", "", "Why notifications are silenced")
+		flags.Parse(args[1:])
+		silence.EndsAt = silence.StartsAt.Add(*duration)
+		if *until != "" {
+			endsAt, err := time.Parse(time.RFC3339, *until)
+			if err != nil {
+				log.Fatalf("Invalid end time: %v", err)
+			}
+			silence.EndsAt = endsAt
+		}
+		if err := openStore().Silences().AddSilence(silence); err != nil {
+			log.Fatalf("Failed adding silence: %v", err)
+		}
+		fmt.Printf("Silence #%v added until %v\n", silence.Id, silence.EndsAt.Format(time.RFC3339))
+	default:
+		log.Fatalf("Usage: %v", SILENCES_USAGE)
+	}
+}
+
+func maintenanceCommand(args []string) {
+	switch {
+	case len(args) == 0:
+		w := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+		fmt.Fprintln(w, "ID\tNAME\tCRON\tDURATION\tACTION\tEXCEPTION\tSOURCE\tSERVICE\tBY\tCOMMENT")
+		for _, m := range openStore().Silences().FetchMaintenanceWindows() {
+			fmt.Fprintf(w, "%v\t%v\t%v\t%v\t%v\t%v\t%v\t%v\t%v\t%v\n", m.Id, m.Name, m.Cron, m.Duration, m.Action, m.Exception, m.Source, m.Service, m.CreatedBy, m.Comment)
+		}
+		w.Flush()
+	case len(args) == 2 && args[0] == "delete":
+		id, err := strconv.Atoi(args[1])
+		if err != nil {
+			log.Fatalf("Invalid maintenance window id: %v", args[1])
+		}
+		if err := openStore().Silences().DeleteMaintenanceWindow(id); err != nil {
+			log.Fatalf("Failed deleting Maintenance window #%v: %v", id, err)
+		}
+		fmt.Printf("Maintenance window #%v deleted\n", id)
+	case args[0] == "add":
+		window := new(errord.MaintenanceWindow)
+		flags := flag.NewFlagSet("maintenance add", flag.ExitOnError)
+		matcherFlags(flags, &window.Matcher)
+		flags.StringVar(&window.Name, "name", "", "Name of the maintenance window")
+		flags.StringVar(&window.Cron, "cron", "", "Cron expression of when the window starts, for example '0 2 * * 6'")
+		flags.StringVar(&window.Duration, "for", "1h", "How long the window lasts")
+		flags.StringVar(&window.Action, "action", errord.MAINTENANCE_HOLD, "hold sends notifications once the window ends and drop discards them")
+		flags.StringVar(&window.CreatedBy, "by", os.Getenv("USER"), "Who created the maintenance window")
+		flags.StringVar(&window.Comment, "comment", "", "What the maintenance is for")
+		flags.Parse(args[1:])
+		if err := openStore().Silences().AddMaintenanceWindow(window); err != nil {
+			log.Fatalf("Failed adding maintenance window: %v", err)
+		}
+		fmt.Printf("Maintenance window #%v added\n", window.Id)
+	default:
+		log.Fatalf("Usage: %v", MAINTENANCE_USAGE)
+	}
+}
+
+func templateCommand(args []string) {
+	if len(args) == 0 || args[0] != "preview" {
+		log.Fatalf("Usage: %v", TEMPLATE_USAGE)
+	}
+	flags := flag.NewFlagSet("template preview", flag.ExitOnError)
+	dir := flags.String("dir", "templates", "Directory of the notification templates")
+	notifier := flags.String("notifier", "", "Name of the notifier whose templates are rendered")
+	kind := flags.String("type", errord.TEMPLATE_NEW, "Type of notification to render")
+	html := flags.Bool("html", false, "Print the html part instead of the text")
+	flags.Parse(args[1:])
+
+	templates, err := errord.LoadTemplates(*dir)
+	if err != nil {
+		log.Fatalf("Failed loading templates from %v: %v", *dir, err)
+	}
+	n, err := errord.SampleNotification(*kind)
+	if err != nil {
+		log.Fatalf("%v", err)
+	}
+	rendered, err := templates.Render(*notifier, n)
+	if err != nil {
+		log.Fatalf("Failed rendering templates: %v", err)
+	}
+	if rendered == nil {
+		fmt.Printf("No %v templates in %v. Notifications keep the default subject and body:\n\n", *kind, *dir)
+		rendered = &errord.Rendered{Subject: n.Subject(), Text: n.Body()}
+	}
+	if *html {
+		if rendered.HTML == "" {
+			log.Fatalf("There is no %v.html.tmpl template", *kind)
+		}
+		fmt.Print(rendered.HTML)
+		return
+	}
+	fmt.Printf("Subject: %v\n\n%v", rendered.Subject, rendered.Text)
+}
+
+func notificationsCommand(args []string) {
+	flags := flag.NewFlagSet("notifications", flag.ExitOnError)
+	since := flags.Duration("since", 24*time.Hour, "Print notifications recorded within this period")
+	flags.Parse(args)
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(w, "ID\tSUBJECT\tDEDUP KEY\tAT\tSEVERITY\tDECISION\tDECISIONS\tREASON")
+	for _, n := range openStore().Notifications().FetchNotifications(time.Now().Add(-*since)) {
+		fmt.Fprintf(w, "%v\t%v\t%v\t%v\t%v\t%v\t%v\t%v\n", n.Id, n.Subject, n.DedupKey, n.SentAt.Format(time.RFC3339), n.Severity, n.Decision, n.Decisions, n.Reason)
+	}
+	w.Flush()
+}
+
+func outboxCommand(args []string) {
+	if len(args) == 2 && args[0] == "retry" {
+		id, err := strconv.Atoi(args[1])
+		if err != nil {
+			log.Fatalf("Invalid outbox id: %v", args[1])
+		}
+		if err := openStore().Outbox().Retry(id); err != nil {
+			log.Fatalf("Failed retrying Outbox entry #%v: %v", id, err)
+		}
+		fmt.Printf("Outbox entry #%v is retried by the running daemon\n", id)
+		return
+	}
+	flags := flag.NewFlagSet("outbox", flag.ExitOnError)
+	since := flags.Duration("since", 24*time.Hour, "Print notifications written to the outbox within this period")
+	flags.Parse(args)
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(w, "ID\tSUBJECT\tSTATE\tHELD BY\tATTEMPTS\tCREATED\tNEXT ATTEMPT\tLAST ERROR")
+	for _, e := range openStore().Outbox().FetchEntries(time.Now().Add(-*since)) {
+		next := ""
+		if e.State == errord.OUTBOX_PENDING || (e.State == errord.OUTBOX_HELD && e.Attempts > 0) {
+			next = e.NextAttemptAt.Format(time.RFC3339)
+		}
+		fmt.Fprintf(w, "%v\t%v\t%v\t%v\t%v\t%v\t%v\t%v\n", e.Id, e.Subject, e.State, e.Scope, e.Attempts, e.CreatedAt.Format(time.RFC3339), next, e.LastError)
+	}
+	w.Flush()
+}
+
+func issuesCommand(args []string) {
+	if len(args) == 0 {
+		w := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+		fmt.Fprintln(w, "FINGERPRINT\tEXCEPTION\tSTATUS\tFIRST SEEN\tLAST SEEN\tCOUNT")
+		for _, i := range openStore().Issues().FetchIssues() {
+			fmt.Fprintf(w, "%v\t%v\t%v\t%v\t%v\t%v\n", i.Fingerprint, i.Exception, i.Status, i.FirstSeen.Format(time.RFC3339), i.LastSeen.Format(time.RFC3339), i.Count)
+		}
+		w.Flush()
+		return
+	}
+	var status errord.IssueStatus
+	var mutedUntil *time.Time
+	switch {
+	case len(args) == 2 && args[0] == "resolve":
+		status = errord.ISSUE_RESOLVED
+	case len(args) == 2 && args[0] == "unresolve":
+		status = errord.ISSUE_UNRESOLVED
+	case len(args) == 2 && args[0] == "ignore":
+		status = errord.ISSUE_IGNORED
+	case len(args) == 3 && args[0] == "mute":
+		duration, err := time.ParseDuration(args[2])
+		if err != nil {
+			log.Fatalf("Invalid mute duration: %v", args[2])
+		}
+		until := time.Now().Add(duration)
+		status = errord.ISSUE_MUTED
+		mutedUntil = &until
+	default:
+		log.Fatalf("Usage: %v", ISSUES_USAGE)
+	}
+	if err := openStore().Issues().SetStatus(args[1], status, mutedUntil); err != nil {
+		log.Fatalf("Failed changing status of Issue [%v]: %v", args[1], err)
+	}
+	fmt.Printf("Issue [%v] is %v\n", args[1], status)
+}
+
+func releasesCommand(args []string) {
+	if len(args) > 0 && args[0] == "add" {
+		flags := flag.NewFlagSet("releases add", flag.ExitOnError)
+		version := flags.String("version", "", "Version that was deployed")
+		service := flags.String("service", "", "Service that was deployed")
+		at := flags.String("at", "", "Time of the deployment in RFC3339. Defaults to now")
+		flags.Parse(args[1:])
+		release := &errord.Release{Version: *version, Service: *service, DeployedAt: time.Now()}
+		if *at != "" {
+			deployedAt, err := time.Parse(time.RFC3339, *at)
+			if err != nil {
+				log.Fatalf("Invalid deployment time: %v", err)
+			}
+			release.DeployedAt = deployedAt
+		}
+		// the database is the one of the deployed service, so its error events are associated with the release
+		s := openStore()
+		s.SetService(*service)
+		if err := s.Releases().Add(release); err != nil {
+			log.Fatalf("Failed recording release: %v", err)
+		}
+		fmt.Printf("Recorded release %v of %v at %v\n", release.Version, release.Service, release.DeployedAt.Format(time.RFC3339))
+		return
+	}
+	if len(args) > 0 && args[0] == "report" {
+		for _, report := range openStore().Releases().FetchReleaseReports() {
+			r := report.Release
+			fmt.Printf("Release %v of %v deployed at %v\n", r.Version, r.Service, r.DeployedAt.Format(time.RFC3339))
+			w := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+			for _, c := range report.New {
+				fmt.Fprintf(w, "  NEW\t%v\t%v seen\t%.2f/hour\n", c.Exception, c.Count, c.After)
+			}
+			for _, c := range report.Increased {
+				fmt.Fprintf(w, "  INCREASED\t%v\t%v seen\t%.2f/hour -> %.2f/hour\n", c.Exception, c.Count, c.Before, c.After)
+			}
+			w.Flush()
+		}
+		return
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(w, "ID\tVERSION\tSERVICE\tDEPLOYED")
+	for _, r := range openStore().Releases().FetchReleases() {
+		fmt.Fprintf(w, "%v\t%v\t%v\t%v\n", r.Id, r.Version, r.Service, r.DeployedAt.Format(time.RFC3339))
+	}
+	w.Flush()
+}
+
+func tailCommand(args []string) {
+	flags := flag.NewFlagSet("tail", flag.ExitOnError)
+	api := flags.String("api", "http://localhost:8080", "URL of the HTTP API of the daemon")
+	exception := flags.String("exception", "", "Only follow exceptions matching this regular expression")
+	source := flags.String("source", "", "Only follow sources matching this regular expression")
+	level := flags.String("level", "", "Only follow this log level")
+	decisions := flags.Bool("decisions", false, "Also follow what the stat engine decided about every event")
+	flags.Parse(args)
+
+	values := url.Values{}
+	for name, value := range map[string]string{"exception": *exception, "source": *source, "level": *level} {
+		if value != "" {
+			values.Set(name, value)
+		}
+	}
+	if !*decisions {
+		values.Set("type", errord.STREAM_EVENT)
+	}
+	streamURL := strings.TrimSuffix(*api, "/") + "/stream?" + values.Encode()
+	err := errord.FollowStream(streamURL, 5*time.Second, func(m *errord.StreamMessage) {
+		if e := m.Event; e != nil {
+			fmt.Printf("%v %v [%v] %v: %v\n", e.Timestamp.Format(time.RFC3339), e.Level, e.Source, e.Exception, e.Description)
+		} else if d := m.Decision; d != nil {
+			fmt.Printf("%v %v -> %v (%v/%v) notify=%v\n", d.Timestamp.Format(time.RFC3339), d.Exception, d.Decision, d.Count, d.Limit, d.Notify)
+		}
+	})
+	log.Fatalf("Failed following %v: %v", streamURL, err)
+}
+
+func ingestCommand(args []string) {
+	flags := flag.NewFlagSet("ingest", flag.ExitOnError)
+	recompute := flags.Bool("recompute", true, "Rebuild the day summaries, stat items and issues once the files are parsed")
+	flags.Parse(args)
+	if flags.NArg() == 0 {
+		log.Fatalf("Usage: %v", INGEST_USAGE)
+	}
+
+	files := []string{}
+	for _, path := range flags.Args() {
+		info, err := os.Stat(path)
+		if err != nil {
+			log.Fatalf("Cannot ingest %v: %v", path, err)
+		}
+		if info.IsDir() {
+			files = append(files, findAllFilesToParse(path)...)
+		} else {
+			files = append(files, path)
+		}
+	}
+	s := openStore()
+	stats := loadAll(s.Errors(), s.Metrics(), files)
+	w := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(w, "FILE\tLINES\tFAILED\tSTORED\tDUPLICATES")
+	for _, file := range files {
+		fmt.Fprintf(w, "%v\t%v\t%v\t%v\t%v\n", file, stats[file].Lines, stats[file].Failed, stats[file].Success, stats[file].Duplicates)
+	}
+	w.Flush()
+	if *recompute {
+		if err := errord.NewStatEngine(s, nil).Recompute(); err != nil {
+			log.Fatalf("Failed recomputing stats: %v", err)
+		}
+	}
+}
+
+func statsCommand(args []string) {
+	if len(args) > 1 {
+		log.Fatalf("Usage: stats [exception]")
+	}
+	q := errord.Query{Limit: errord.QUERY_MAX_LIMIT}
+	if len(args) == 1 {
+		q.Exception = args[0]
+	}
+	stats := openStore().Stats()
+	items, total, err := stats.QueryStatItems(q)
+	if err != nil {
+		log.Fatalf("Failed fetching stat items: %v", err)
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(w, "EXCEPTION\tMEAN\tSTDDEV\tSTDDEV MAX\tTOTAL\tDAYS\tMODIFIED")
+	for _, i := range items {
+		fmt.Fprintf(w, "%v\t%.2f\t%.2f\t%v\t%v\t%v\t%v\n", i.Name, i.Mean, i.StdDev, i.StdDevMax(), i.Total, i.DayCount, i.ModifiedAt.Format(time.RFC3339))
+	}
+	w.Flush()
+	if total > len(items) {
+		fmt.Printf("Showing %v of %v stat items\n", len(items), total)
+	}
+	if q.Exception == "" {
+		return
+	}
+	if len(items) == 0 {
+		fmt.Printf("There are no stats for %v yet\n", q.Exception)
+	}
+	fmt.Println()
+	w = tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(w, "DATE\tTOTAL")
+	for _, day := range stats.FetchDaySummariesByName(q.Exception) {
+		fmt.Fprintf(w, "%v\t%v\n", day.Date.Format("2006-01-02"), day.Total)
+	}
+	w.Flush()
+}
+
+func queryCommand(args []string) {
+	flags := flag.NewFlagSet("query", flag.ExitOnError)
+	since := flags.String("since", "24h", "Only events since this RFC3339 time or period before now")
+	until := flags.String("until", "", "Only events before this RFC3339 time or period before now")
+	exception := flags.String("exception", "", "Only events of this exception")
+	limit := flags.String("limit", strconv.Itoa(errord.QUERY_DEFAULT_LIMIT), "Number of events to print")
+	offset := flags.String("offset", "0", "Number of events to skip")
+	asJSON := flags.Bool("json", false, "Print the page of events as JSON")
+	flags.Parse(args)
+
+	values := url.Values{"since": {*since}, "until": {*until}, "exception": {*exception}, "limit": {*limit}, "offset": {*offset}}
+	q, err := errord.ParseQuery(values, time.Now())
+	if err != nil {
+		log.Fatalf("Invalid query: %v", err)
+	}
+	events, total, err := openStore().Errors().QueryErrorEvents(q)
+	if err != nil {
+		log.Fatalf("Failed querying events: %v", err)
+	}
+	if *asJSON {
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		encoder.Encode(errord.Page{Items: events, Total: total, Limit: q.Limit, Offset: q.Offset})
+		return
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(w, "TIME\tLEVEL\tEXCEPTION\tDETAIL\tDESCRIPTION")
+	for _, e := range events {
+		fmt.Fprintf(w, "%v\t%v\t%v\t%v\t%v\n", e.Timestamp.Format(time.RFC3339), e.Level, e.Exception, e.Detail, e.Description)
+	}
+	w.Flush()
+	fmt.Printf("Showing %v of %v events\n", len(events), total)
+}
+
+func notifyTestCommand(args []string) {
+	flags := flag.NewFlagSet("notify-test", flag.ExitOnError)
+	notifierConfig := flags.String("notifierConfig", "", "Path to the notifier config json")
+	emailConfig := flags.String("emailConfig", "", "Path to the email config json, used when there is no -notifierConfig")
+	only := flags.String("notifier", "", "Only send through the notifier with this name")
+	kind := flags.String("type", errord.TEMPLATE_NEW, "Type of the sample notification")
+	flags.Parse(args)
+
+	s := openStore()
+	names, notifiers := testNotifiers(*notifierConfig, *emailConfig, s)
+	failed := false
+	for _, name := range names {
+		if *only != "" && name != *only {
+			continue
+		}
+		n, err := errord.SampleNotification(*kind)
+		if err != nil {
+			log.Fatalf("%v", err)
+		}
+		if err := notifiers[name].Fire(n); err != nil {
+			failed = true
+			fmt.Printf("%v: failed: %v\n", name, err)
+		} else {
+			fmt.Printf("%v: sent\n", name)
+		}
+	}
+	if failed {
+		os.Exit(1)
+	}
+}
+
+// testNotifiers are the notifiers the daemon would notify through, or the console notifier when nothing is configured
+func testNotifiers(notifierConfigPath, emailConfigPath string, s errord.Store) ([]string, map[string]errord.Notifier) {
+	if notifierConfigPath != "" {
+		config, err := errord.ReadNotificationConfig(notifierConfigPath)
+		if err != nil {
+			log.Fatalf("Failed reading notifier config %v: %v", notifierConfigPath, err)
+		}
+		names, notifiers, err := errord.NewTestNotifiers(config, s)
+		if err != nil {
+			log.Fatalf("Failed creating notifiers: %v", err)
+		}
+		return names, notifiers
+	}
+	store := errord.NewUnrecordedStore(s)
+	c := readEmailConfig(emailConfigPath)
+	if c == (errord.EmailConfig{}) {
+		return []string{"console"}, map[string]errord.Notifier{"console": errord.NewConsoleNotifier(store.Notifications())}
+	}
+	n, err := errord.NewEmailNotifier(c, s.Stats(), store.Notifications())
+	if err != nil {
+		log.Fatalf("Invalid email config %v: %v", emailConfigPath, err)
+	}
+	return []string{"email"}, map[string]errord.Notifier{"email": n}
+}
+
+func recomputeCommand(args []string) {
+	s := openStore()
+	if err := errord.NewStatEngine(s, nil).Recompute(); err != nil {
+		log.Fatalf("Failed recomputing stats: %v", err)
+	}
+	_, total, _ := s.Stats().QueryStatItems(errord.Query{Limit: 1})
+	fmt.Printf("Recomputed the day summaries, issues and %v stat items\n", total)
+}
@@ -0,0 +1,142 @@
+package errord
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+const ALERTMANAGER_ALERTNAME string = "ErrordException"
+
+type alertmanagerAlert struct {
+	Labels       map[string]string `json:"labels"`
+	Annotations  map[string]string `json:"annotations"`
+	StartsAt     string            `json:"startsAt,omitempty"`
+	EndsAt       string            `json:"endsAt,omitempty"`
+	GeneratorURL string            `json:"generatorURL,omitempty"`
+}
+
+/*
+AlertmanagerNotifier posts alerts to the /api/v2/alerts endpoint of Alertmanager. An alert starts when its incident is opened and
+ends when the incident is resolved. Alertmanager resolves alerts that are not posted again within its resolve_timeout, so firing
+alerts are posted again every refresh interval
+*/
+type AlertmanagerNotifier struct {
+	url     string
+	service string
+	host    string
+	client  *http.Client
+	store   NotifyStore
+	firing  map[string]alertmanagerAlert
+	lock    sync.Mutex
+}
+
+func NewAlertmanagerNotifier(url, service, host string, timeout, refresh time.Duration, store NotifyStore) Notifier {
+	n := new(AlertmanagerNotifier)
+	n.url = strings.TrimRight(url, "/") + "/api/v2/alerts"
+	n.service = service
+	n.host = host
+	n.client = &http.Client{Timeout: timeout}
+	n.store = store
+	n.firing = make(map[string]alertmanagerAlert)
+	if refresh > 0 {
+		go n.refresh(refresh)
+	}
+	return n
+}
+
+func (n *AlertmanagerNotifier) Fire(notification *ErrorNotification) error {
+	if n.store.HasNotification(notification) {
+		log.Printf("Notification already sent for %v\n", notification.ErrorEvent)
+		return nil
+	}
+	n.lock.Lock()
+	alert := n.alert(notification)
+	if firing, ok := n.firing[notification.fingerprint()]; ok {
+		alert.Labels = firing.Labels
+	}
+	n.lock.Unlock()
+	if err := n.post([]alertmanagerAlert{alert}); err != nil {
+		log.Printf("Failed posting alert to Alertmanager -> %v\n", err)
+		return err
+	}
+	n.lock.Lock()
+	if alert.EndsAt == "" {
+		n.firing[notification.fingerprint()] = alert
+	} else {
+		delete(n.firing, notification.fingerprint())
+	}
+	n.lock.Unlock()
+	markSent(n.store, notification)
+	return nil
+}
+
+func (n *AlertmanagerNotifier) refresh(interval time.Duration) {
+	for range time.Tick(interval) {
+		n.lock.Lock()
+		alerts := []alertmanagerAlert{}
+		for _, alert := range n.firing {
+			alerts = append(alerts, alert)
+		}
+		n.lock.Unlock()
+		if len(alerts) == 0 {
+			continue
+		}
+		if err := n.post(alerts); err != nil {
+			log.Printf("Failed refreshing %v firing alerts in Alertmanager -> %v\n", len(alerts), err)
+		}
+	}
+}
+
+func (n *AlertmanagerNotifier) post(alerts []alertmanagerAlert) error {
+	payload, err := json.Marshal(alerts)
+	if err != nil {
+		return err
+	}
+	resp, err := n.client.Post(n.url, "application/json", bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("Alertmanager responded with %v", resp.Status)
+	}
+	return nil
+}
+
+// alert creates the alert of the notification. Labels identify the alert in Alertmanager, so once an alert is firing its labels are kept
+func (n *AlertmanagerNotifier) alert(notification *ErrorNotification) alertmanagerAlert {
+	e := notification.ErrorEvent
+	subject, body := notification.describe()
+	alert := alertmanagerAlert{
+		Labels: map[string]string{
+			"alertname":   ALERTMANAGER_ALERTNAME,
+			"exception":   e.Exception,
+			"fingerprint": notification.fingerprint(),
+			"source":      e.Source,
+			"service":     n.service,
+			"host":        n.host,
+		},
+		Annotations: map[string]string{"summary": subject, "description": body},
+	}
+	if notification.Kind != NOTIFY_RESOLVED {
+		alert.Labels["severity"] = notification.Severity()
+	}
+	if e.Detail != "" {
+		alert.Annotations["detail"] = e.Detail
+	}
+	if i := notification.Incident; i != nil {
+		alert.StartsAt = i.OpenedAt.Format(time.RFC3339)
+		if i.ResolvedAt != nil {
+			alert.EndsAt = i.ResolvedAt.Format(time.RFC3339)
+		}
+	} else if e.Timestamp != nil {
+		alert.StartsAt = e.Timestamp.Format(time.RFC3339)
+	}
+	return alert
+}
@@ -0,0 +1,57 @@
+package errord
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestAlertmanagerNotifierFollowsIncident(t *testing.T) {
+	posted := [][]alertmanagerAlert{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/v2/alerts" {
+			t.Errorf("Alerts should be posted to /api/v2/alerts. Got %v", r.URL.Path)
+		}
+		var alerts []alertmanagerAlert
+		json.NewDecoder(r.Body).Decode(&alerts)
+		posted = append(posted, alerts)
+	}))
+	defer server.Close()
+
+	notifier := NewAlertmanagerNotifier(server.URL+"/", "recharge", "host-1", time.Second, 0, newMemNotifyStore())
+	opened := newTestNotification()
+	opened.ErrorEvent.Source = "client.AirtelService"
+	incident := &Incident{Id: 1, Exception: opened.ErrorEvent.Exception, Fingerprint: opened.ErrorEvent.Fingerprint(), Source: "client.AirtelService",
+		State: INCIDENT_OPEN, OpenedAt: *newTime(2016, 3, 31, 12, 0, 0)}
+	opened.Kind = NOTIFY_OPENED
+	opened.Incident = incident
+	notifier.Fire(opened)
+	incident.State = INCIDENT_RESOLVED
+	incident.ResolvedAt = newTime(2016, 3, 31, 13, 0, 0)
+	notifier.Fire(&ErrorNotification{ErrorEvent: incident.event(), Kind: NOTIFY_RESOLVED, Incident: incident})
+
+	if len(posted) != 2 {
+		t.Fatalf("Every notification should be posted. Got %v", len(posted))
+	}
+	firing, resolved := posted[0][0], posted[1][0]
+	labels := firing.Labels
+	if labels["exception"] != "java.sql.SQLException" || labels["source"] != "client.AirtelService" || labels["service"] != "recharge" || labels["host"] != "host-1" {
+		t.Errorf("Alert should be labelled with the exception, source, service and host. Got %v", labels)
+	}
+	if firing.Annotations["detail"] != opened.ErrorEvent.Detail || firing.Annotations["description"] == "" {
+		t.Errorf("Alert should be annotated with the description and detail. Got %v", firing.Annotations)
+	}
+	if firing.StartsAt != incident.OpenedAt.Format(time.RFC3339) || firing.EndsAt != "" {
+		t.Errorf("Firing alert should start when the incident opened and not end. Got %v - %v", firing.StartsAt, firing.EndsAt)
+	}
+	if resolved.EndsAt != incident.ResolvedAt.Format(time.RFC3339) {
+		t.Errorf("Resolved alert should end when the incident was resolved. Got %v", resolved.EndsAt)
+	}
+	for name, value := range labels {
+		if resolved.Labels[name] != value {
+			t.Errorf("Resolved alert should have the labels of the firing alert. Got %v = %v", name, resolved.Labels[name])
+		}
+	}
+}
@@ -0,0 +1,301 @@
+package errord
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html/template"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var ErrWritesDisabled error = errors.New("Changes through the API require errord to be started with -apiToken")
+var ErrUnauthorized error = errors.New("Changes through the API require an Authorization: Bearer <token> header with the API token")
+
+type api struct {
+	store Store
+	links *AckLinks
+	token string
+	mux   *http.ServeMux
+}
+
+/*
+NewAPI creates the HTTP API errord serves when it is started with -listen, with the dashboard under /ui/. Without links the
+acknowledge links are not served and without a stream live events are not served. Requests that change anything, like releases,
+silences, maintenance windows and acknowledgements, require the token as a bearer token. Without a token they are refused. Signed
+acknowledge links are confirmed with a POST that carries the signature instead of the token
+*/
+func NewAPI(s Store, links *AckLinks, stream *Stream, token string) http.Handler {
+	a := new(api)
+	a.store = s
+	a.links = links
+	a.token = token
+	a.mux = http.NewServeMux()
+	a.mux.HandleFunc("/releases", a.releases)
+	a.mux.HandleFunc("/silences", a.silences)
+	a.mux.HandleFunc("/silences/", a.silence)
+	a.mux.HandleFunc("/maintenance", a.maintenanceWindows)
+	a.mux.HandleFunc("/maintenance/", a.maintenanceWindow)
+	a.mux.HandleFunc("/incidents/", a.incident)
+	a.mux.HandleFunc("/ack", a.ack)
+	a.mux.Handle("/ui/", NewDashboard(s))
+	a.mux.Handle("/metrics", METRICS)
+	a.mux.HandleFunc("/events", a.read(func(q Query) (interface{}, int, error) { return a.store.Errors().QueryErrorEvents(q) }))
+	a.mux.HandleFunc("/summaries", a.read(func(q Query) (interface{}, int, error) { return a.store.Stats().QuerySummaries(q) }))
+	a.mux.HandleFunc("/day-summaries", a.read(func(q Query) (interface{}, int, error) { return a.store.Stats().QueryDaySummaries(q) }))
+	a.mux.HandleFunc("/stats", a.read(func(q Query) (interface{}, int, error) { return a.store.Stats().QueryStatItems(q) }))
+	a.mux.HandleFunc("/notifications", a.read(func(q Query) (interface{}, int, error) { return a.store.Notifications().QueryNotifications(q) }))
+	if stream != nil {
+		a.mux.Handle("/stream", stream)
+		a.mux.HandleFunc("/stream/ws", stream.ServeWebSocket)
+	}
+	return a
+}
+
+func (a *api) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	log.Printf("API %v %v\n", r.Method, r.URL)
+	// only reads are served without the token. The acknowledge links carry their own signature instead
+	if r.Method != "GET" && r.Method != "HEAD" && r.URL.Path != "/ack" {
+		if a.token == "" {
+			writeError(w, http.StatusForbidden, ErrWritesDisabled)
+			return
+		}
+		if !a.authorized(r) {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="errord"`)
+			writeError(w, http.StatusUnauthorized, ErrUnauthorized)
+			return
+		}
+	}
+	a.mux.ServeHTTP(w, r)
+}
+
+func (a *api) authorized(r *http.Request) bool {
+	token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+	return subtle.ConstantTimeCompare([]byte(token), []byte(a.token)) == 1
+}
+
+func (a *api) releases(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case "GET":
+		writeJSON(w, http.StatusOK, a.store.Releases().FetchReleases())
+	case "POST":
+		release := new(Release)
+		if err := json.NewDecoder(r.Body).Decode(release); err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+		if release.DeployedAt.IsZero() {
+			release.DeployedAt = time.Now()
+		}
+		if err := a.store.Releases().Add(release); err == ErrEmptyRelease {
+			writeError(w, http.StatusBadRequest, err)
+		} else if err != nil {
+			writeError(w, http.StatusInternalServerError, err)
+		} else {
+			writeJSON(w, http.StatusCreated, release)
+		}
+	default:
+		w.Header().Set("Allow", "GET, POST")
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+// silences lists the silences that have not ended or creates a silence. A silence without StartsAt starts now
+func (a *api) silences(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case "GET":
+		writeJSON(w, http.StatusOK, a.store.Silences().FetchSilences(time.Now()))
+	case "POST":
+		silence := new(Silence)
+		if err := json.NewDecoder(r.Body).Decode(silence); err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+		if silence.StartsAt.IsZero() {
+			silence.StartsAt = time.Now()
+		}
+		if err := a.store.Silences().AddSilence(silence); err != nil {
+			writeError(w, http.StatusBadRequest, err)
+		} else {
+			writeJSON(w, http.StatusCreated, silence)
+		}
+	default:
+		w.Header().Set("Allow", "GET, POST")
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+// silence expires the silence with the id in the path
+func (a *api) silence(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(strings.TrimPrefix(r.URL.Path, "/silences/"))
+	if err != nil {
+		writeError(w, http.StatusNotFound, ErrSilenceNotFound)
+		return
+	}
+	if r.Method != "DELETE" {
+		w.Header().Set("Allow", "DELETE")
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	if err := a.store.Silences().ExpireSilence(id); err == ErrSilenceNotFound {
+		writeError(w, http.StatusNotFound, err)
+	} else if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+	} else {
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+func (a *api) maintenanceWindows(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case "GET":
+		writeJSON(w, http.StatusOK, a.store.Silences().FetchMaintenanceWindows())
+	case "POST":
+		window := new(MaintenanceWindow)
+		if err := json.NewDecoder(r.Body).Decode(window); err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+		if err := a.store.Silences().AddMaintenanceWindow(window); err != nil {
+			writeError(w, http.StatusBadRequest, err)
+		} else {
+			writeJSON(w, http.StatusCreated, window)
+		}
+	default:
+		w.Header().Set("Allow", "GET, POST")
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+func (a *api) maintenanceWindow(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(strings.TrimPrefix(r.URL.Path, "/maintenance/"))
+	if err != nil {
+		writeError(w, http.StatusNotFound, ErrMaintenanceWindowNotFound)
+		return
+	}
+	if r.Method != "DELETE" {
+		w.Header().Set("Allow", "DELETE")
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	if err := a.store.Silences().DeleteMaintenanceWindow(id); err == ErrMaintenanceWindowNotFound {
+		writeError(w, http.StatusNotFound, err)
+	} else if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+	} else {
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// incident acknowledges the incident on POST /incidents/<id>/ack
+func (a *api) incident(w http.ResponseWriter, r *http.Request) {
+	path := strings.TrimSuffix(strings.TrimPrefix(r.URL.Path, "/incidents/"), "/ack")
+	id, err := strconv.Atoi(path)
+	if err != nil || !strings.HasSuffix(r.URL.Path, "/ack") {
+		writeError(w, http.StatusNotFound, ErrIncidentNotOpen)
+		return
+	}
+	if r.Method != "POST" {
+		w.Header().Set("Allow", "POST")
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	if err := a.store.Incidents().Acknowledge(id); err == ErrIncidentNotOpen {
+		writeError(w, http.StatusConflict, err)
+	} else if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+	} else {
+		writeJSON(w, http.StatusOK, a.store.Incidents().GetIncident(id))
+	}
+}
+
+/*
+ack acknowledges the incident of a signed link. A GET only shows a form that asks to confirm it with a POST, so that mail scanners
+and link previews that open the link do not acknowledge the incident
+*/
+func (a *api) ack(w http.ResponseWriter, r *http.Request) {
+	if a.links == nil {
+		http.NotFound(w, r)
+		return
+	}
+	if r.Method != "GET" && r.Method != "POST" {
+		w.Header().Set("Allow", "GET, POST")
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	id, err := strconv.Atoi(r.FormValue("incident"))
+	if err != nil {
+		http.Error(w, ErrInvalidAckSignature.Error(), http.StatusBadRequest)
+		return
+	}
+	signature := r.FormValue("signature")
+	if err := a.links.Verify(id, signature); err != nil {
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	}
+	if r.Method == "GET" {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		ackTemplate.Execute(w, struct {
+			Id        int
+			Signature string
+		}{id, signature})
+		return
+	}
+	if err := a.store.Incidents().Acknowledge(id); err == ErrIncidentNotOpen {
+		http.Error(w, fmt.Sprintf("Incident #%v is already acknowledged or resolved", id), http.StatusConflict)
+		return
+	} else if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	fmt.Fprintf(w, "Incident #%v acknowledged\n", id)
+}
+
+var ackTemplate = template.Must(template.New("ack").Parse(`<!DOCTYPE html>
+<html><head><title>Acknowledge Incident #{{.Id}}</title></head>
+<body>
+<form method="POST" action="ack">
+<input type="hidden" name="incident" value="{{.Id}}">
+<input type="hidden" name="signature" value="{{.Signature}}">
+<button type="submit">Acknowledge Incident #{{.Id}}</button>
+</form>
+</body></html>
+`))
+
+// read serves a page of the rows the fetch function returns for the query in the URL parameters
+func (a *api) read(fetch func(q Query) (interface{}, int, error)) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "GET" {
+			w.Header().Set("Allow", "GET")
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		q, err := ParseQuery(r.URL.Query(), time.Now())
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+		items, total, err := fetch(q)
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, Page{Items: items, Total: total, Limit: q.Limit, Offset: q.Offset})
+	}
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		log.Printf("Failed writing JSON response: %v\n", err)
+	}
+}
+
+func writeError(w http.ResponseWriter, status int, err error) {
+	writeJSON(w, status, map[string]string{"Error": err.Error()})
+}
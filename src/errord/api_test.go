@@ -0,0 +1,74 @@
+package errord
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestAPIRequiresTokenForChanges(t *testing.T) {
+	post := func(api http.Handler, authorization string) int {
+		r := httptest.NewRequest("POST", "/silences", strings.NewReader("not json"))
+		if authorization != "" {
+			r.Header.Set("Authorization", authorization)
+		}
+		w := httptest.NewRecorder()
+		api.ServeHTTP(w, r)
+		return w.Code
+	}
+
+	if code := post(NewAPI(nil, nil, nil, ""), "Bearer secret"); code != http.StatusForbidden {
+		t.Errorf("Changes should be refused when the API has no token. Got %v", code)
+	}
+	api := NewAPI(nil, nil, nil, "secret")
+	if code := post(api, ""); code != http.StatusUnauthorized {
+		t.Errorf("Changes without a token should be unauthorized. Got %v", code)
+	}
+	if code := post(api, "Bearer wrong"); code != http.StatusUnauthorized {
+		t.Errorf("Changes with the wrong token should be unauthorized. Got %v", code)
+	}
+	if code := post(api, "Bearer secret"); code != http.StatusBadRequest {
+		t.Errorf("Changes with the token should reach the handler. Got %v", code)
+	}
+}
+
+type incidentsStore struct {
+	Store
+	incidents IncidentStore
+}
+
+func (s *incidentsStore) Incidents() IncidentStore {
+	return s.incidents
+}
+
+func TestAckLinkAsksToConfirm(t *testing.T) {
+	incidents := &memIncidentStore{}
+	incident, _ := incidents.Open(newTestNotification().ErrorEvent)
+	links := NewAckLinks("https://errord.example.com", "secret")
+	api := NewAPI(&incidentsStore{incidents: incidents}, links, nil, "")
+	link := strings.TrimPrefix(links.Link(incident.Id), "https://errord.example.com")
+
+	w := httptest.NewRecorder()
+	api.ServeHTTP(w, httptest.NewRequest("GET", link, nil))
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), `method="POST"`) || incident.State != INCIDENT_OPEN {
+		t.Fatalf("Opening the link should ask to confirm without acknowledging. Got %v, %v", w.Code, incident.State)
+	}
+
+	forged := httptest.NewRequest("POST", "/ack", strings.NewReader("incident=1&signature=forged"))
+	forged.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	w = httptest.NewRecorder()
+	api.ServeHTTP(w, forged)
+	if w.Code != http.StatusForbidden || incident.State != INCIDENT_OPEN {
+		t.Errorf("Confirming with a forged signature should be forbidden. Got %v", w.Code)
+	}
+
+	query := strings.SplitN(link, "?", 2)[1]
+	confirm := httptest.NewRequest("POST", "/ack", strings.NewReader(query))
+	confirm.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	w = httptest.NewRecorder()
+	api.ServeHTTP(w, confirm)
+	if w.Code != http.StatusOK || incident.State != INCIDENT_ACKNOWLEDGED {
+		t.Errorf("Confirming should acknowledge the incident without the API token. Got %v, %v", w.Code, incident.State)
+	}
+}
@@ -0,0 +1,207 @@
+package errord
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+const OVERFLOW_BLOCK string = "block"
+const OVERFLOW_DROP_OLDEST string = "drop-oldest"
+const OVERFLOW_SAMPLE string = "sample"
+
+const DEFAULT_SAMPLE_RATE int = 10
+
+// DEFAULT_BUS_CONFIG lets the stat engine and the metrics see every event and lets the stream skip events when its clients are slow
+const DEFAULT_BUS_CONFIG string = "stats=block:1000,metrics=block:1000,stream=drop-oldest:1000"
+
+var ErrUnknownOverflow error = errors.New("Overflow must be one of 'block', 'drop-oldest' or 'sample'")
+var ErrBusClosed error = errors.New("Event bus is closed")
+
+/*
+SubscriberConfig is the buffering of a subscriber of the event bus and what happens when its buffer is full. block waits for the
+subscriber, drop-oldest drops the oldest buffered event to make room and sample keeps one in SampleRate of the events that do not
+fit, in place of the oldest buffered event, and drops the others
+*/
+type SubscriberConfig struct {
+	Buffer     int
+	Overflow   string
+	SampleRate int
+}
+
+func (c SubscriberConfig) validate() error {
+	switch c.Overflow {
+	case OVERFLOW_BLOCK:
+		if c.Buffer < 0 {
+			return fmt.Errorf("Buffer must not be negative")
+		}
+	case OVERFLOW_DROP_OLDEST, OVERFLOW_SAMPLE:
+		if c.Buffer < 1 {
+			return fmt.Errorf("Buffer of %v must be at least 1", c.Overflow)
+		}
+	default:
+		return ErrUnknownOverflow
+	}
+	return nil
+}
+
+/*
+ParseBusConfig reads the subscriber configs from name=overflow:buffer pairs separated by commas, like stats=block:1000. The sample
+rate of sample follows the buffer, as in stream=sample:100:10
+*/
+func ParseBusConfig(spec string) (map[string]SubscriberConfig, error) {
+	configs := make(map[string]SubscriberConfig)
+	for _, pair := range strings.Split(spec, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+		parts := strings.SplitN(pair, "=", 2)
+		if len(parts) != 2 || parts[0] == "" {
+			return nil, fmt.Errorf("Invalid subscriber '%v': must be name=overflow:buffer", pair)
+		}
+		values := strings.Split(parts[1], ":")
+		c := SubscriberConfig{Overflow: values[0], SampleRate: DEFAULT_SAMPLE_RATE}
+		var err error
+		if len(values) > 1 {
+			if c.Buffer, err = strconv.Atoi(values[1]); err != nil {
+				return nil, fmt.Errorf("Invalid buffer of subscriber %v: %v", parts[0], values[1])
+			}
+		}
+		if len(values) > 2 {
+			if c.SampleRate, err = strconv.Atoi(values[2]); err != nil || c.SampleRate < 1 {
+				return nil, fmt.Errorf("Invalid sample rate of subscriber %v: %v", parts[0], values[2])
+			}
+		}
+		if err := c.validate(); err != nil {
+			return nil, fmt.Errorf("Invalid subscriber %v: %v", parts[0], err)
+		}
+		configs[parts[0]] = c
+	}
+	return configs, nil
+}
+
+// Subscription is a subscriber of the event bus. Events are read from Events, which is closed when the bus is closed
+type Subscription struct {
+	Name       string
+	Events     chan ErrorEvent
+	config     SubscriberConfig
+	overflowed int
+	done       chan struct{}
+	once       sync.Once
+}
+
+/*
+EventBus fans the error events read from the tailed file out to every subscriber, like the stat engine, the metrics, the stream and
+forwarders. Every subscriber has its own buffer, so a slow subscriber only holds up tailing when its overflow is block
+*/
+type EventBus struct {
+	lock          sync.Mutex
+	subscriptions []*Subscription
+	closed        bool
+}
+
+func NewEventBus() *EventBus {
+	return new(EventBus)
+}
+
+func (b *EventBus) Subscribe(name string, c SubscriberConfig) (*Subscription, error) {
+	if c.SampleRate < 1 {
+		c.SampleRate = DEFAULT_SAMPLE_RATE
+	}
+	if err := c.validate(); err != nil {
+		return nil, err
+	}
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	if b.closed {
+		return nil, ErrBusClosed
+	}
+	s := &Subscription{Name: name, Events: make(chan ErrorEvent, c.Buffer), config: c, done: make(chan struct{})}
+	b.subscriptions = append(b.subscriptions, s)
+	log.Printf("%v subscribed to the event bus with a buffer of %v and overflow %v\n", name, c.Buffer, c.Overflow)
+	return s, nil
+}
+
+// Unsubscribe stops sending events to the subscription. Its Events are not closed
+func (b *EventBus) Unsubscribe(s *Subscription) {
+	// a publish blocked on the subscription gives up once done is closed, which releases the lock
+	s.once.Do(func() { close(s.done) })
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	for i, subscription := range b.subscriptions {
+		if subscription == s {
+			b.subscriptions = append(b.subscriptions[:i], b.subscriptions[i+1:]...)
+			break
+		}
+	}
+}
+
+// Publish sends the event to every subscriber, in the order they subscribed
+func (b *EventBus) Publish(e ErrorEvent) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	if b.closed {
+		return
+	}
+	for _, s := range b.subscriptions {
+		s.deliver(e)
+		METRICS.Set("errord_bus_queue_length", float64(len(s.Events)), "subscriber", s.Name)
+	}
+}
+
+// Close closes the Events of every subscriber. The events already buffered for a subscriber are still read
+func (b *EventBus) Close() {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	if b.closed {
+		return
+	}
+	b.closed = true
+	for _, s := range b.subscriptions {
+		close(s.Events)
+	}
+	b.subscriptions = nil
+}
+
+func (s *Subscription) deliver(e ErrorEvent) {
+	select {
+	case s.Events <- e:
+		return
+	default:
+	}
+	switch s.config.Overflow {
+	case OVERFLOW_BLOCK:
+		select {
+		case s.Events <- e:
+		case <-s.done:
+		}
+		return
+	case OVERFLOW_SAMPLE:
+		s.overflowed++
+		if s.overflowed%s.config.SampleRate != 0 {
+			s.dropped()
+			return
+		}
+	}
+	// only the bus sends to the subscription, so there is room once an event was taken, here or by the subscriber
+	for {
+		select {
+		case <-s.Events:
+			s.dropped()
+		default:
+		}
+		select {
+		case s.Events <- e:
+			return
+		default:
+		}
+	}
+}
+
+func (s *Subscription) dropped() {
+	METRICS.Add("errord_bus_dropped_total", 1, "subscriber", s.Name)
+}
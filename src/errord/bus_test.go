@@ -0,0 +1,131 @@
+package errord
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+func busEvent(i int) ErrorEvent {
+	return ErrorEvent{Exception: fmt.Sprintf("Exception%v", i)}
+}
+
+func drain(events chan ErrorEvent) []string {
+	exceptions := []string{}
+	for e := range events {
+		exceptions = append(exceptions, e.Exception)
+	}
+	return exceptions
+}
+
+func TestEventBusFansOutToEverySubscriber(t *testing.T) {
+	bus := NewEventBus()
+	stats, _ := bus.Subscribe("stats", SubscriberConfig{Buffer: 10, Overflow: OVERFLOW_BLOCK})
+	stream, _ := bus.Subscribe("stream", SubscriberConfig{Buffer: 10, Overflow: OVERFLOW_DROP_OLDEST})
+	for i := 0; i < 3; i++ {
+		bus.Publish(busEvent(i))
+	}
+	bus.Close()
+	for _, s := range []*Subscription{stats, stream} {
+		if received := drain(s.Events); fmt.Sprint(received) != "[Exception0 Exception1 Exception2]" {
+			t.Errorf("Expected %v to receive every event, got %v", s.Name, received)
+		}
+	}
+	if _, err := bus.Subscribe("late", SubscriberConfig{Buffer: 1, Overflow: OVERFLOW_BLOCK}); err != ErrBusClosed {
+		t.Errorf("Expected subscribing to a closed bus to fail, got %v", err)
+	}
+}
+
+func TestEventBusDropsOldestForSlowSubscriber(t *testing.T) {
+	bus := NewEventBus()
+	s, _ := bus.Subscribe("stream", SubscriberConfig{Buffer: 2, Overflow: OVERFLOW_DROP_OLDEST})
+	for i := 0; i < 5; i++ {
+		bus.Publish(busEvent(i))
+	}
+	bus.Close()
+	if received := drain(s.Events); fmt.Sprint(received) != "[Exception3 Exception4]" {
+		t.Errorf("Expected the newest events to be kept, got %v", received)
+	}
+}
+
+func TestEventBusSamplesOverflow(t *testing.T) {
+	bus := NewEventBus()
+	s, _ := bus.Subscribe("forwarder", SubscriberConfig{Buffer: 2, Overflow: OVERFLOW_SAMPLE, SampleRate: 3})
+	for i := 0; i < 8; i++ {
+		bus.Publish(busEvent(i))
+	}
+	bus.Close()
+	// events 2 to 7 overflow and every third of them, 4 and 7, replaces the oldest
+	if received := drain(s.Events); fmt.Sprint(received) != "[Exception4 Exception7]" {
+		t.Errorf("Expected one in 3 overflowing events to be kept, got %v", received)
+	}
+}
+
+func TestEventBusBlocksUntilSubscriberReads(t *testing.T) {
+	bus := NewEventBus()
+	s, _ := bus.Subscribe("stats", SubscriberConfig{Buffer: 1, Overflow: OVERFLOW_BLOCK})
+	bus.Publish(busEvent(0))
+	published := make(chan bool)
+	go func() {
+		bus.Publish(busEvent(1))
+		published <- true
+	}()
+	select {
+	case <-published:
+		t.Errorf("Expected publish to wait for the subscriber")
+	case <-time.After(50 * time.Millisecond):
+	}
+	if e := <-s.Events; e.Exception != "Exception0" {
+		t.Errorf("Expected the first event, got %v", e.Exception)
+	}
+	select {
+	case <-published:
+	case <-time.After(time.Second):
+		t.Errorf("Expected publish to continue once the subscriber read")
+	}
+}
+
+func TestEventBusUnsubscribeReleasesBlockedPublish(t *testing.T) {
+	bus := NewEventBus()
+	s, _ := bus.Subscribe("stats", SubscriberConfig{Overflow: OVERFLOW_BLOCK})
+	other, _ := bus.Subscribe("metrics", SubscriberConfig{Buffer: 1, Overflow: OVERFLOW_BLOCK})
+	published := make(chan bool)
+	go func() {
+		bus.Publish(busEvent(0))
+		published <- true
+	}()
+	time.Sleep(20 * time.Millisecond)
+	bus.Unsubscribe(s)
+	select {
+	case <-published:
+	case <-time.After(time.Second):
+		t.Errorf("Expected publish to give up on the unsubscribed subscriber")
+	}
+	if e := <-other.Events; e.Exception != "Exception0" {
+		t.Errorf("Expected the other subscriber to receive the event, got %v", e.Exception)
+	}
+}
+
+func TestParseBusConfig(t *testing.T) {
+	configs, err := ParseBusConfig("stats=block:1000, stream=drop-oldest:50,forwarder=sample:10:5")
+	if err != nil {
+		t.Fatalf("Expected a valid config: %v", err)
+	}
+	if c := configs["stats"]; c.Overflow != OVERFLOW_BLOCK || c.Buffer != 1000 {
+		t.Errorf("Unexpected stats config %v", c)
+	}
+	if c := configs["stream"]; c.Overflow != OVERFLOW_DROP_OLDEST || c.Buffer != 50 || c.SampleRate != DEFAULT_SAMPLE_RATE {
+		t.Errorf("Unexpected stream config %v", c)
+	}
+	if c := configs["forwarder"]; c.Overflow != OVERFLOW_SAMPLE || c.Buffer != 10 || c.SampleRate != 5 {
+		t.Errorf("Unexpected forwarder config %v", c)
+	}
+	for _, spec := range []string{"stats", "stats=queue:10", "stats=block:x", "stream=drop-oldest:0", "stream=sample:10:0"} {
+		if _, err := ParseBusConfig(spec); err == nil {
+			t.Errorf("Expected %v to be invalid", spec)
+		}
+	}
+	if _, err := ParseBusConfig(DEFAULT_BUS_CONFIG); err != nil {
+		t.Errorf("Expected the default config to be valid: %v", err)
+	}
+}
@@ -0,0 +1,108 @@
+package errord
+
+import (
+	"log"
+	"sync"
+	"time"
+)
+
+const CORRELATION_BUCKET time.Duration = time.Minute
+const CORRELATION_LOOKBACK time.Duration = 24 * time.Hour
+
+const CLUSTER_SCOPE string = "cluster"
+
+/*
+ClusterNotifier holds back notifications for a window. Notifications of exceptions that are correlated are combined into one
+notification led by the exception that was seen first. The notifications are held back in the outbox, so they are still sent when
+errord is restarted within the window
+*/
+type ClusterNotifier struct {
+	notifier    Notifier
+	errorStore  ErrorStore
+	notifyStore NotifyStore
+	held        *heldNotifications
+	lock        sync.Mutex
+}
+
+func NewClusterNotifier(n Notifier, window time.Duration, errorStore ErrorStore, notifyStore NotifyStore, outbox OutboxStore) Notifier {
+	c := new(ClusterNotifier)
+	c.notifier = n
+	c.errorStore = errorStore
+	c.notifyStore = notifyStore
+	c.held = newHeldNotifications(outbox, CLUSTER_SCOPE, window, c.flush)
+	return c
+}
+
+func (c *ClusterNotifier) Fire(n *ErrorNotification) error {
+	if n.Kind != NOTIFY_DETECTED && n.Kind != NOTIFY_OPENED && n.Kind != NOTIFY_REGRESSION {
+		return c.notifier.Fire(n)
+	}
+	if c.notifyStore.HasNotification(n) {
+		log.Printf("Notification already sent for %v\n", n.ErrorEvent)
+		return nil
+	}
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	for _, p := range c.held.store.FetchHeld(CLUSTER_SCOPE) {
+		if p.Notification.ErrorEvent.Exception == n.ErrorEvent.Exception {
+			log.Printf("Notification for [%v] already waiting to be sent\n", n.ErrorEvent.Exception)
+			return nil
+		}
+	}
+	return c.held.hold(n)
+}
+
+// flush sends every cluster on its own, so that a cluster that fails is retried without sending the others again
+func (c *ClusterNotifier) flush() {
+	c.lock.Lock()
+	held := c.held.fetch()
+	c.lock.Unlock()
+	if len(held) == 0 {
+		return
+	}
+	entries := make(map[*ErrorNotification]*OutboxEntry)
+	for _, entry := range held {
+		entries[entry.Notification] = entry
+	}
+
+	// only the exceptions waiting to be sent are correlated, not every exception seen during the lookback
+	var correlations []Correlation
+	if exceptions := exceptionsOf(held); len(exceptions) > 1 {
+		events := c.errorStore.FetchExceptionEvents(time.Now().Add(-CORRELATION_LOOKBACK), exceptions)
+		correlations = Correlate(events, CORRELATION_BUCKET)
+	}
+	var failed []*OutboxEntry
+	var cause error
+	for _, group := range cluster(notificationsOf(held), correlations) {
+		groupEntries := make([]*OutboxEntry, len(group))
+		for i, n := range group {
+			groupEntries[i] = entries[n]
+		}
+		lead := group[0]
+		lead.Related = group[1:]
+		if len(lead.Related) > 0 {
+			log.Printf("Sending [%v] with %v related exceptions as one incident\n", lead.ErrorEvent.Exception, len(lead.Related))
+		}
+		if err := c.notifier.Fire(lead); err != nil {
+			log.Printf("Failed firing notification for [%v]: %v\n", lead.ErrorEvent.Exception, err)
+			failed, cause = append(failed, groupEntries...), err
+			continue
+		}
+		c.held.sent(groupEntries)
+	}
+	if len(failed) > 0 {
+		c.held.failed(failed, cause)
+	}
+}
+
+func exceptionsOf(entries []*OutboxEntry) []string {
+	seen := make(map[string]bool)
+	exceptions := []string{}
+	for _, entry := range entries {
+		if exception := entry.Notification.ErrorEvent.Exception; !seen[exception] {
+			seen[exception] = true
+			exceptions = append(exceptions, exception)
+		}
+	}
+	return exceptions
+}
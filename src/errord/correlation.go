@@ -0,0 +1,159 @@
+package errord
+
+import (
+	"math"
+	"sort"
+	"time"
+)
+
+const MIN_CORRELATION float64 = 0.5
+
+type Correlation struct {
+	First        string
+	Second       string
+	CoOccurrence int
+	Coefficient  float64
+}
+
+// Correlate splits the events into buckets and compares the number of events per bucket of every pair of exceptions.
+// CoOccurrence is the number of buckets in which both exceptions were seen and Coefficient is the Pearson correlation of the bucket counts
+func Correlate(events []ErrorEvent, bucket time.Duration) []Correlation {
+	series := createSeries(events, bucket)
+	names := make([]string, 0, len(series))
+	for name := range series {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	correlations := []Correlation{}
+	for i := 0; i < len(names); i++ {
+		for j := i + 1; j < len(names); j++ {
+			a, b := series[names[i]], series[names[j]]
+			correlations = append(correlations, Correlation{names[i], names[j], coOccurrence(a, b), pearson(a, b)})
+		}
+	}
+	sort.Sort(byCoefficient(correlations))
+	return correlations
+}
+
+func createSeries(events []ErrorEvent, bucket time.Duration) map[string][]float64 {
+	series := make(map[string][]float64)
+	if len(events) == 0 || bucket <= 0 {
+		return series
+	}
+	start, end := events[0].Timestamp.Truncate(bucket), events[0].Timestamp.Truncate(bucket)
+	for _, e := range events {
+		t := e.Timestamp.Truncate(bucket)
+		if t.Before(start) {
+			start = t
+		}
+		if t.After(end) {
+			end = t
+		}
+	}
+	size := int(end.Sub(start)/bucket) + 1
+	for _, e := range events {
+		if _, ok := series[e.Exception]; !ok {
+			series[e.Exception] = make([]float64, size)
+		}
+		series[e.Exception][int(e.Timestamp.Truncate(bucket).Sub(start)/bucket)]++
+	}
+	return series
+}
+
+func coOccurrence(a, b []float64) int {
+	count := 0
+	for i := range a {
+		if a[i] > 0 && b[i] > 0 {
+			count++
+		}
+	}
+	return count
+}
+
+func pearson(a, b []float64) float64 {
+	n := float64(len(a))
+	if n == 0 {
+		return 0
+	}
+	var sumA, sumB float64
+	for i := range a {
+		sumA += a[i]
+		sumB += b[i]
+	}
+	meanA, meanB := sumA/n, sumB/n
+	var cov, varA, varB float64
+	for i := range a {
+		cov += (a[i] - meanA) * (b[i] - meanB)
+		varA += math.Pow(a[i]-meanA, 2)
+		varB += math.Pow(b[i]-meanB, 2)
+	}
+	if varA == 0 || varB == 0 {
+		// A constant series does not vary with anything. When both are constant and seen together they are treated as correlated
+		if varA == 0 && varB == 0 && coOccurrence(a, b) > 0 {
+			return 1
+		}
+		return 0
+	}
+	return cov / math.Sqrt(varA*varB)
+}
+
+type byCoefficient []Correlation
+
+func (c byCoefficient) Len() int           { return len(c) }
+func (c byCoefficient) Swap(i, j int)      { c[i], c[j] = c[j], c[i] }
+func (c byCoefficient) Less(i, j int) bool { return c[i].Coefficient > c[j].Coefficient }
+
+// cluster groups the notifications whose exceptions are correlated. Each group is ordered by the time its events were seen
+// so that the first notification of a group is the probable leading exception
+func cluster(notifications []*ErrorNotification, correlations []Correlation) [][]*ErrorNotification {
+	correlated := make(map[string]bool)
+	for _, c := range correlations {
+		if c.Coefficient >= MIN_CORRELATION {
+			correlated[c.First+"|"+c.Second] = true
+			correlated[c.Second+"|"+c.First] = true
+		}
+	}
+	groups := make([]int, len(notifications))
+	for i := range groups {
+		groups[i] = i
+	}
+	var find func(i int) int
+	find = func(i int) int {
+		if groups[i] != i {
+			groups[i] = find(groups[i])
+		}
+		return groups[i]
+	}
+	for i := range notifications {
+		for j := i + 1; j < len(notifications); j++ {
+			a, b := notifications[i].ErrorEvent.Exception, notifications[j].ErrorEvent.Exception
+			if a == b || correlated[a+"|"+b] {
+				groups[find(j)] = find(i)
+			}
+		}
+	}
+	byGroup := make(map[int][]*ErrorNotification)
+	order := []int{}
+	for i, n := range notifications {
+		g := find(i)
+		if _, ok := byGroup[g]; !ok {
+			order = append(order, g)
+		}
+		byGroup[g] = append(byGroup[g], n)
+	}
+	clusters := [][]*ErrorNotification{}
+	for _, g := range order {
+		c := byGroup[g]
+		sort.Stable(byEventTime(c))
+		clusters = append(clusters, c)
+	}
+	return clusters
+}
+
+type byEventTime []*ErrorNotification
+
+func (n byEventTime) Len() int      { return len(n) }
+func (n byEventTime) Swap(i, j int) { n[i], n[j] = n[j], n[i] }
+func (n byEventTime) Less(i, j int) bool {
+	return n[i].ErrorEvent.Timestamp.Before(*n[j].ErrorEvent.Timestamp)
+}
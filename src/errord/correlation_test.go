@@ -0,0 +1,64 @@
+package errord
+
+import (
+	"testing"
+	"time"
+)
+
+func newErrorEvent(exception string, t *time.Time) ErrorEvent {
+	return ErrorEvent{Event: Event{Timestamp: t, Level: ERROR_LOG_LEVEL}, Exception: exception}
+}
+
+func TestCorrelateExceptionsThatSpikeTogether(t *testing.T) {
+	events := []ErrorEvent{
+		newErrorEvent("SQLException", newTime(2016, 3, 31, 12, 0, 0)),
+		newErrorEvent("ConnectionException", newTime(2016, 3, 31, 12, 0, 10)),
+		newErrorEvent("SQLException", newTime(2016, 3, 31, 12, 5, 0)),
+		newErrorEvent("SQLException", newTime(2016, 3, 31, 12, 5, 1)),
+		newErrorEvent("ConnectionException", newTime(2016, 3, 31, 12, 5, 30)),
+		newErrorEvent("ConnectionException", newTime(2016, 3, 31, 12, 5, 40)),
+		newErrorEvent("UnmarshalException", newTime(2016, 3, 31, 12, 3, 0)),
+	}
+	correlations := Correlate(events, time.Minute)
+	if len(correlations) != 3 {
+		t.Fatalf("Should return a correlation for every pair of the 3 exceptions. Got %v", len(correlations))
+	}
+	first := correlations[0]
+	if first.First != "ConnectionException" || first.Second != "SQLException" {
+		t.Errorf("Exceptions that spike together should be the most correlated. Got [%v] and [%v]", first.First, first.Second)
+	}
+	if first.CoOccurrence != 2 {
+		t.Errorf("Exceptions were seen together in 2 buckets. Got %v", first.CoOccurrence)
+	}
+	if first.Coefficient < 0.99 {
+		t.Errorf("Exceptions with the same counts per bucket should have a correlation of 1. Got %v", first.Coefficient)
+	}
+	for _, c := range correlations[1:] {
+		if c.CoOccurrence != 0 || c.Coefficient >= MIN_CORRELATION {
+			t.Errorf("[%v] and [%v] are never seen together and should not be correlated. Got %v", c.First, c.Second, c.Coefficient)
+		}
+	}
+
+	if len(Correlate([]ErrorEvent{}, time.Minute)) != 0 {
+		t.Errorf("No events should have no correlations")
+	}
+}
+
+func TestClusterLeadsWithFirstSeenException(t *testing.T) {
+	sql := newErrorEvent("SQLException", newTime(2016, 3, 31, 12, 0, 10))
+	conn := newErrorEvent("ConnectionException", newTime(2016, 3, 31, 12, 0, 0))
+	other := newErrorEvent("UnmarshalException", newTime(2016, 3, 31, 12, 0, 5))
+	notifications := []*ErrorNotification{{ErrorEvent: &sql}, {ErrorEvent: &conn}, {ErrorEvent: &other}}
+	correlations := []Correlation{{"ConnectionException", "SQLException", 2, 1}, {"SQLException", "UnmarshalException", 0, 0}}
+
+	clusters := cluster(notifications, correlations)
+	if len(clusters) != 2 {
+		t.Fatalf("Correlated exceptions should be in one cluster and the other exception on its own. Got %v clusters", len(clusters))
+	}
+	if len(clusters[0]) != 2 || clusters[0][0].ErrorEvent.Exception != "ConnectionException" {
+		t.Errorf("Cluster should be led by the exception that was seen first. Got [%v]", clusters[0][0].ErrorEvent.Exception)
+	}
+	if len(clusters[1]) != 1 || clusters[1][0].ErrorEvent.Exception != "UnmarshalException" {
+		t.Errorf("Uncorrelated exception should be in its own cluster")
+	}
+}
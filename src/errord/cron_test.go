@@ -0,0 +1,42 @@
+package errord
+
+import (
+	"testing"
+	"time"
+)
+
+func TestCronNext(t *testing.T) {
+	// Thursday
+	now := time.Date(2016, 3, 31, 12, 30, 0, 0, time.UTC)
+	tests := []struct {
+		expr string
+		want time.Time
+	}{
+		{"* * * * *", time.Date(2016, 3, 31, 12, 31, 0, 0, time.UTC)},
+		{"*/15 * * * *", time.Date(2016, 3, 31, 12, 45, 0, 0, time.UTC)},
+		{"0 8 * * *", time.Date(2016, 4, 1, 8, 0, 0, 0, time.UTC)},
+		{"0 8 * * 1", time.Date(2016, 4, 4, 8, 0, 0, 0, time.UTC)},
+		{"0 8 * * 1-5", time.Date(2016, 4, 1, 8, 0, 0, 0, time.UTC)},
+		{"30 6 1 * *", time.Date(2016, 4, 1, 6, 30, 0, 0, time.UTC)},
+		{"0 0 1 1 *", time.Date(2017, 1, 1, 0, 0, 0, 0, time.UTC)},
+		{"0 9 15 * 7", time.Date(2016, 4, 3, 9, 0, 0, 0, time.UTC)},
+	}
+	for _, test := range tests {
+		c, err := ParseCron(test.expr)
+		if err != nil {
+			t.Errorf("[%v] should parse: %v", test.expr, err)
+			continue
+		}
+		if next := c.Next(now); !next.Equal(test.want) {
+			t.Errorf("[%v] next should be %v. Got %v", test.expr, test.want, next)
+		}
+	}
+}
+
+func TestParseCronRejectsInvalidExpressions(t *testing.T) {
+	for _, expr := range []string{"* * * *", "60 * * * *", "* 5-1 * * *", "*/0 * * * *", "a * * * *"} {
+		if _, err := ParseCron(expr); err == nil {
+			t.Errorf("[%v] should not parse", expr)
+		}
+	}
+}
@@ -0,0 +1,242 @@
+package errord
+
+import (
+	"bytes"
+	"fmt"
+	"html/template"
+	"log"
+	"net/http"
+	"sort"
+	"time"
+)
+
+const DASHBOARD_HISTOGRAM_DAYS int = 30
+
+const DASHBOARD_LAYOUT_TEMPLATE string = `{{define "header"}}<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>errord - {{.Title}}</title>
+<style>
+body { font-family: sans-serif; margin: 2em; color: #222 }
+nav a { margin-right: 1em }
+table { border-collapse: collapse; margin-bottom: 2em }
+th, td { border-bottom: 1px solid #ddd; padding: 4px 8px; text-align: left; vertical-align: top }
+.over { color: #c0392b; font-weight: bold }
+.spark { font-family: monospace; letter-spacing: 1px }
+pre { background: #f6f6f6; padding: 6px; margin: 0; white-space: pre-wrap }
+</style>
+</head>
+<body>
+<nav><a href="/ui/">Exceptions</a><a href="/ui/live">Live</a></nav>
+<h2>{{.Title}}</h2>
+{{end}}{{define "footer"}}</body>
+</html>
+{{end}}`
+
+const DASHBOARD_EXCEPTIONS_TEMPLATE string = `{{template "header" .}}<table>
+<tr><th>Exception</th><th>Last {{.Days}} days</th><th>Today</th><th>StdDev max</th><th>Total</th><th>First seen</th><th>Last seen</th></tr>
+{{range .Exceptions}}<tr><td><a href="/ui/exception?name={{.Name}}">{{.Name}}</a></td><td class="spark">{{.Sparkline}}</td>
+<td{{if .Over}} class="over"{{end}}>{{.Today}}</td><td>{{if .Limit}}{{.Limit}}{{else}}-{{end}}</td><td>{{.Total}}</td>
+<td>{{.FirstSeen.Format "2006-01-02"}}</td><td>{{.LastSeen.Format "2006-01-02"}}</td></tr>
+{{else}}<tr><td colspan="7">No exceptions seen yet</td></tr>
+{{end}}</table>
+{{template "footer"}}`
+
+const DASHBOARD_EXCEPTION_TEMPLATE string = `{{template "header" .}}<p>{{if .Limit}}Seen {{.Today}} times today. The StdDev max is {{.Limit}} with a daily mean of {{printf "%.1f" .Stats.Mean}} over {{.Stats.DayCount}} days.
+{{else}}Seen {{.Today}} times today. There are no statistics for this exception yet.{{end}}</p>
+<h3>Last {{.Days}} days</h3>
+{{.Histogram}}
+<h3>Recent events</h3>
+<table>
+<tr><th>Time</th><th>Level</th><th>Message and stack trace</th></tr>
+{{range .Events}}<tr><td>{{.Timestamp.Format "2006-01-02 15:04:05"}}</td><td>{{.Level}}</td><td><pre>{{.StackTrace}}</pre></td></tr>
+{{else}}<tr><td colspan="3">No events</td></tr>
+{{end}}</table>
+<h3>Recent notifications</h3>
+<table>
+<tr><th>Time</th><th>Subject</th><th>Severity</th><th>Decision</th><th>Reason</th></tr>
+{{range .Notifications}}<tr><td>{{.SentAt.Format "2006-01-02 15:04:05"}}</td><td>{{.Subject}}</td><td>{{.Severity}}</td><td>{{.Decision}}{{if gt .Decisions 1}} x{{.Decisions}}{{end}}</td><td>{{.Reason}}</td></tr>
+{{else}}<tr><td colspan="5">No notifications</td></tr>
+{{end}}</table>
+{{template "footer"}}`
+
+const DASHBOARD_LIVE_TEMPLATE string = `{{template "header" .}}<p id="status">Waiting for events</p>
+<table>
+<thead><tr><th>Time</th><th>Level</th><th>Exception</th><th>Message</th></tr></thead>
+<tbody id="events"></tbody>
+</table>
+<script>
+var since = new Date().toISOString().replace(/\.\d+Z$/, "Z");
+var seen = {};
+function cell(row, text) {
+	var td = document.createElement("td");
+	td.textContent = text;
+	row.appendChild(td);
+}
+function poll() {
+	fetch("/events?limit=100&since=" + encodeURIComponent(since)).then(function(r) { return r.json(); }).then(function(page) {
+		var body = document.getElementById("events");
+		page.Items.slice().reverse().forEach(function(e) {
+			var key = e.Timestamp + e.Exception + e.Description;
+			if (seen[key]) {
+				return;
+			}
+			seen[key] = true;
+			var row = document.createElement("tr");
+			cell(row, e.Timestamp);
+			cell(row, e.Level);
+			cell(row, e.Exception);
+			cell(row, e.Description);
+			body.insertBefore(row, body.firstChild);
+		});
+		document.getElementById("status").textContent = "Updated " + new Date().toLocaleTimeString();
+	}).catch(function(err) {
+		document.getElementById("status").textContent = "Failed fetching events: " + err;
+	});
+}
+poll();
+setInterval(poll, {{.Interval}});
+</script>
+{{template "footer"}}`
+
+var dashboardTemplates = map[string]*template.Template{
+	"exceptions": dashboardTemplate("exceptions", DASHBOARD_EXCEPTIONS_TEMPLATE),
+	"exception":  dashboardTemplate("exception", DASHBOARD_EXCEPTION_TEMPLATE),
+	"live":       dashboardTemplate("live", DASHBOARD_LIVE_TEMPLATE),
+}
+
+func dashboardTemplate(name, content string) *template.Template {
+	return template.Must(template.Must(template.New(name).Parse(DASHBOARD_LAYOUT_TEMPLATE)).Parse(content))
+}
+
+// DashboardException is a row of the exceptions page. Limit is 0 when there are no statistics for the exception
+type DashboardException struct {
+	Name      string
+	Sparkline string
+	Today     int
+	Limit     int
+	Over      bool
+	Total     int
+	FirstSeen time.Time
+	LastSeen  time.Time
+}
+
+// dashboard is a small web UI over the store for investigating exceptions without digging in the database
+type dashboard struct {
+	store Store
+	mux   *http.ServeMux
+	now   func() time.Time
+}
+
+// NewDashboard creates the web UI the HTTP API serves under /ui/
+func NewDashboard(s Store) http.Handler {
+	d := new(dashboard)
+	d.store = s
+	d.now = time.Now
+	d.mux = http.NewServeMux()
+	d.mux.HandleFunc("/ui/", d.exceptions)
+	d.mux.HandleFunc("/ui/exception", d.exception)
+	d.mux.HandleFunc("/ui/live", d.live)
+	return d.mux
+}
+
+func (d *dashboard) exceptions(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/ui/" {
+		http.NotFound(w, r)
+		return
+	}
+	exceptions := dashboardExceptions(d.store.Stats().FetchSummaries(), d.store.Stats().GetStatItem, d.now())
+	d.render(w, "exceptions", map[string]interface{}{"Title": "Exceptions", "Days": SPARKLINE_DAYS, "Exceptions": exceptions})
+}
+
+func (d *dashboard) exception(w http.ResponseWriter, r *http.Request) {
+	name := r.URL.Query().Get("name")
+	if name == "" {
+		http.NotFound(w, r)
+		return
+	}
+	stats := d.store.Stats()
+	history := stats.FetchDaySummariesByName(name)
+	totals, _ := dailyTotals(history, DASHBOARD_HISTOGRAM_DAYS)
+	item := stats.GetStatItem(name)
+	limit := 0
+	if item.DayCount > 0 {
+		limit = item.StdDevMax()
+	}
+	q := Query{Exception: name, Limit: 20}
+	events, _, err := d.store.Errors().QueryErrorEvents(q)
+	if err != nil {
+		log.Printf("Failed fetching events of [%v] for the dashboard: %v\n", name, err)
+	}
+	notifications, _, err := d.store.Notifications().QueryNotifications(q)
+	if err != nil {
+		log.Printf("Failed fetching notifications of [%v] for the dashboard: %v\n", name, err)
+	}
+	d.render(w, "exception", map[string]interface{}{"Title": name, "Days": DASHBOARD_HISTOGRAM_DAYS, "Today": totals[len(totals)-1],
+		"Limit": limit, "Stats": item, "Histogram": histogram(totals, d.now()), "Events": events, "Notifications": notifications})
+}
+
+func (d *dashboard) live(w http.ResponseWriter, r *http.Request) {
+	d.render(w, "live", map[string]interface{}{"Title": "Live events", "Interval": 5000})
+}
+
+func (d *dashboard) render(w http.ResponseWriter, name string, data interface{}) {
+	var b bytes.Buffer
+	if err := dashboardTemplates[name].Execute(&b, data); err != nil {
+		log.Printf("Failed rendering dashboard page %v: %v\n", name, err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	b.WriteTo(w)
+}
+
+// dashboardExceptions are the rows of the exceptions page, the exceptions seen most today first
+func dashboardExceptions(summaries []Summary, stats func(name string) *StatItem, now time.Time) []*DashboardException {
+	today := now.Format("2006-01-02")
+	exceptions := []*DashboardException{}
+	for _, s := range summaries {
+		e := &DashboardException{Name: s.Name, Sparkline: sparkline(s.DaySummaries, SPARKLINE_DAYS), Total: s.Total, FirstSeen: s.StartDate}
+		for _, day := range s.DaySummaries {
+			if day.Date.Format("2006-01-02") == today {
+				e.Today += day.Total
+			}
+			if day.Date.After(e.LastSeen) {
+				e.LastSeen = day.Date
+			}
+		}
+		if item := stats(s.Name); item != nil && item.DayCount > 0 {
+			e.Limit = item.StdDevMax()
+			e.Over = e.Today > e.Limit
+		}
+		exceptions = append(exceptions, e)
+	}
+	sort.SliceStable(exceptions, func(i, j int) bool {
+		if exceptions[i].Today != exceptions[j].Today {
+			return exceptions[i].Today > exceptions[j].Today
+		}
+		return exceptions[i].Total > exceptions[j].Total
+	})
+	return exceptions
+}
+
+// histogram draws the daily totals, ending today, as an SVG bar chart with the date and total of each day as a tooltip
+func histogram(totals []int, now time.Time) template.HTML {
+	const barWidth, gap, height = 16, 4, 120
+	max := 1
+	for _, total := range totals {
+		if total > max {
+			max = total
+		}
+	}
+	var b bytes.Buffer
+	fmt.Fprintf(&b, `<svg width="%d" height="%d">`, len(totals)*(barWidth+gap), height+1)
+	for i, total := range totals {
+		h := total * height / max
+		day := now.AddDate(0, 0, i-len(totals)+1).Format("2006-01-02")
+		fmt.Fprintf(&b, `<rect x="%d" y="%d" width="%d" height="%d" fill="#c0392b"><title>%v: %d</title></rect>`, i*(barWidth+gap), height-h, barWidth, h, day, total)
+	}
+	fmt.Fprintf(&b, `<line x1="0" y1="%d" x2="%d" y2="%d" stroke="#999"/></svg>`, height, len(totals)*(barWidth+gap), height)
+	return template.HTML(b.String())
+}
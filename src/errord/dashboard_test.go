@@ -0,0 +1,57 @@
+package errord
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestDashboardExceptions(t *testing.T) {
+	now := time.Now()
+	yesterday := now.AddDate(0, 0, -1)
+	summaries := []Summary{
+		{Name: "TimeoutException", StartDate: yesterday, Total: 50, DaySummaries: []*DaySummary{{Date: yesterday, Total: 48}, {Date: now, Total: 2}}},
+		{Name: "java.sql.SQLException", StartDate: yesterday, Total: 30, DaySummaries: []*DaySummary{{Date: yesterday, Total: 10}, {Date: now, Total: 20}}},
+	}
+	stats := func(name string) *StatItem {
+		if name == "java.sql.SQLException" {
+			return &StatItem{Name: name, Mean: 10, StdDev: 2, DayCount: 7}
+		}
+		return &StatItem{}
+	}
+	exceptions := dashboardExceptions(summaries, stats, now)
+	if len(exceptions) != 2 || exceptions[0].Name != "java.sql.SQLException" {
+		t.Fatalf("Exceptions seen most today should be first")
+	}
+	e := exceptions[0]
+	if e.Today != 20 || e.Limit != 12 || !e.Over || e.LastSeen != now {
+		t.Errorf("Today should be compared with the StdDev max. Got %+v", e)
+	}
+	if exceptions[1].Limit != 0 || exceptions[1].Over {
+		t.Errorf("Exception without statistics should have no limit. Got %+v", exceptions[1])
+	}
+
+	var b bytes.Buffer
+	if err := dashboardTemplates["exceptions"].Execute(&b, map[string]interface{}{"Title": "Exceptions", "Days": SPARKLINE_DAYS, "Exceptions": exceptions}); err != nil {
+		t.Fatalf("Exceptions page should render: %v", err)
+	}
+	if !strings.Contains(b.String(), `href="/ui/exception?name=java.sql.SQLException"`) || !strings.Contains(b.String(), `class="over"`) {
+		t.Errorf("Exceptions should link to their detail page and show when they are over the limit")
+	}
+}
+
+func TestDashboardExceptionPage(t *testing.T) {
+	event := newTestNotification().ErrorEvent
+	event.Description = "Failed <loading> invoice"
+	data := map[string]interface{}{"Title": event.Exception, "Days": 3, "Today": 4, "Limit": 0, "Stats": &StatItem{},
+		"Histogram": histogram([]int{1, 0, 4}, time.Now()), "Events": []ErrorEvent{*event}, "Notifications": []*NotificationRecord{}}
+	var b bytes.Buffer
+	if err := dashboardTemplates["exception"].Execute(&b, data); err != nil {
+		t.Fatalf("Exception page should render: %v", err)
+	}
+	page := b.String()
+	if strings.Count(page, "<rect") != 3 || !strings.Contains(page, "Failed &lt;loading&gt; invoice") || !strings.Contains(page, "Caused by: java.sql.SQLException") {
+		t.Errorf("Exception page should show the histogram and escaped stack traces. Got %v", page)
+	}
+}
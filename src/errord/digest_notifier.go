@@ -0,0 +1,134 @@
+package errord
+
+import (
+	"bytes"
+	"fmt"
+	"log"
+	"sort"
+	"text/tabwriter"
+	"time"
+)
+
+const NOTIFY_DIGEST NotificationKind = "digest"
+
+// DigestEntry sums up the notifications of one exception in a digest
+type DigestEntry struct {
+	Exception string
+	Count     int
+	Total     int
+	Limit     string
+	FirstSeen time.Time
+	LastSeen  time.Time
+}
+
+/*
+DigestNotifier collects notifications for a window and then sends them as one digest notification with a table of the exceptions.
+Critical notifications, reports and the acknowledgements and resolutions of incidents are sent immediately. The notifications are
+collected in the outbox under the scope of the digest, so they are still sent when errord is restarted, and a digest that fails is
+sent again after a backoff
+*/
+type DigestNotifier struct {
+	notifier Notifier
+	store    NotifyStore
+	held     *heldNotifications
+}
+
+func NewDigestNotifier(n Notifier, window time.Duration, store NotifyStore, outbox OutboxStore, scope string) Notifier {
+	d := new(DigestNotifier)
+	d.notifier = n
+	d.store = store
+	d.held = newHeldNotifications(outbox, scope, window, d.flush)
+	return d
+}
+
+func (d *DigestNotifier) Fire(n *ErrorNotification) error {
+	if n.Kind == NOTIFY_ACKNOWLEDGED || n.Kind == NOTIFY_RESOLVED || n.Kind == NOTIFY_REPORT || n.Severity() == SEVERITY_CRITICAL {
+		return d.notifier.Fire(n)
+	}
+	if d.store.HasNotification(n) {
+		log.Printf("Notification already sent for %v\n", n.ErrorEvent)
+		return nil
+	}
+	return d.held.hold(n)
+}
+
+func (d *DigestNotifier) flush() {
+	held := d.held.fetch()
+	if len(held) == 0 {
+		return
+	}
+	digest := newDigest(notificationsOf(held))
+	log.Printf("Sending digest of %v notifications\n", len(held))
+	if err := d.notifier.Fire(digest); err != nil {
+		d.held.failed(held, err)
+		return
+	}
+	d.held.sent(held)
+}
+
+// newDigest combines the notifications into one. They are kept as Related so that they are all recorded as sent with the digest
+func newDigest(notifications []*ErrorNotification) *ErrorNotification {
+	now := time.Now()
+	entries := digestEntries(notifications)
+	event := &ErrorEvent{Event: Event{Timestamp: &now, Level: ERROR_LOG_LEVEL, Description: "Digest"}, Exception: fmt.Sprintf("%v exceptions", len(entries))}
+	return &ErrorNotification{ErrorEvent: event, Kind: NOTIFY_DIGEST, Related: notifications, Digest: entries}
+}
+
+func digestEntries(notifications []*ErrorNotification) []*DigestEntry {
+	byException := make(map[string]*DigestEntry)
+	entries := []*DigestEntry{}
+	for _, n := range notifications {
+		e := n.ErrorEvent
+		seen := time.Now()
+		if e.Timestamp != nil {
+			seen = *e.Timestamp
+		}
+		entry, ok := byException[e.Exception]
+		if !ok {
+			entry = &DigestEntry{Exception: e.Exception, FirstSeen: seen, LastSeen: seen, Limit: "-"}
+			byException[e.Exception] = entry
+			entries = append(entries, entry)
+		}
+		entry.Count++
+		if seen.Before(entry.FirstSeen) {
+			entry.FirstSeen = seen
+		}
+		if seen.After(entry.LastSeen) {
+			entry.LastSeen = seen
+		}
+		if n.DaySummary != nil && n.DaySummary.Total > entry.Total {
+			entry.Total = n.DaySummary.Total
+		}
+		if n.Rule != nil {
+			entry.Limit = n.Rule.describe()
+		} else if n.Stats != nil {
+			entry.Limit = fmt.Sprintf("%v per day", n.limit())
+		}
+	}
+	sort.SliceStable(entries, func(i, j int) bool {
+		return entries[i].Count > entries[j].Count
+	})
+	return entries
+}
+
+func (n *ErrorNotification) describeDigest() (title string, description string) {
+	first, last := n.Digest[0].FirstSeen, n.Digest[0].LastSeen
+	for _, entry := range n.Digest {
+		if entry.FirstSeen.Before(first) {
+			first = entry.FirstSeen
+		}
+		if entry.LastSeen.After(last) {
+			last = entry.LastSeen
+		}
+	}
+	subject := fmt.Sprintf("Digest: %v exceptions in %v notifications", len(n.Digest), len(n.Related))
+	var body bytes.Buffer
+	fmt.Fprintf(&body, "Exceptions seen between %v and %v\n\n", first.Format("2006-01-02 15:04:05"), last.Format("2006-01-02 15:04:05"))
+	w := tabwriter.NewWriter(&body, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(w, "EXCEPTION\tNOTIFICATIONS\tSEEN TODAY\tLIMIT\tFIRST SEEN\tLAST SEEN")
+	for _, entry := range n.Digest {
+		fmt.Fprintf(w, "%v\t%v\t%v\t%v\t%v\t%v\n", entry.Exception, entry.Count, entry.Total, entry.Limit, entry.FirstSeen.Format("15:04:05"), entry.LastSeen.Format("15:04:05"))
+	}
+	w.Flush()
+	return subject, body.String()
+}
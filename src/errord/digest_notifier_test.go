@@ -0,0 +1,85 @@
+package errord
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestDigestCombinesNotifications(t *testing.T) {
+	recorder := &recordingNotifier{}
+	store := newMemNotifyStore()
+	digest := NewDigestNotifier(recorder, time.Hour, store, &memOutboxStore{}, "digest:email").(*DigestNotifier)
+
+	first := newErrorEvent("SQLException", newTime(2016, 3, 31, 12, 0, 0))
+	second := newErrorEvent("SQLException", newTime(2016, 3, 31, 12, 10, 0))
+	other := newErrorEvent("TimeoutException", newTime(2016, 3, 31, 12, 5, 0))
+	digest.Fire(&ErrorNotification{ErrorEvent: &first, Kind: NOTIFY_OPENED, Incident: &Incident{Id: 1}})
+	digest.Fire(&ErrorNotification{ErrorEvent: &other})
+	digest.Fire(&ErrorNotification{ErrorEvent: &second, Kind: NOTIFY_ONGOING, Incident: &Incident{Id: 1, Count: 2},
+		DaySummary: &DaySummary{Total: 20}, Stats: &StatItem{Mean: 10, StdDev: 2}, Sigma: 3})
+	if len(recorder.fired) != 0 {
+		t.Fatalf("Notifications should be held back until the window has passed")
+	}
+
+	digest.flush()
+	if len(recorder.fired) != 1 || recorder.fired[0].Kind != NOTIFY_DIGEST {
+		t.Fatalf("Pending notifications should be sent as one digest")
+	}
+	sent := recorder.fired[0]
+	if len(sent.Digest) != 2 || sent.Digest[0].Exception != "SQLException" || sent.Digest[0].Count != 2 || sent.Digest[0].Total != 20 {
+		t.Errorf("Digest should have one entry per exception, most notified first. Got %v", sent.Digest[0])
+	}
+	if !sent.Digest[0].FirstSeen.Equal(*first.Timestamp) || !sent.Digest[0].LastSeen.Equal(*second.Timestamp) {
+		t.Errorf("Digest entry should span the first and last event. Got %v - %v", sent.Digest[0].FirstSeen, sent.Digest[0].LastSeen)
+	}
+	subject, body := sent.describe()
+	if subject != "Digest: 2 exceptions in 3 notifications" || !strings.Contains(body, "TimeoutException") || !strings.Contains(body, "16 per day") {
+		t.Errorf("Digest should describe a table of the exceptions. Got %v\n%v", subject, body)
+	}
+	if len(sent.Related) != 3 {
+		t.Errorf("Digest should keep the notifications so that they are recorded as sent")
+	}
+}
+
+func TestDigestSendsCriticalNotificationsImmediately(t *testing.T) {
+	recorder := &recordingNotifier{}
+	digest := NewDigestNotifier(recorder, time.Hour, newMemNotifyStore(), &memOutboxStore{}, "digest:email")
+
+	notification := newTestNotification()
+	notification.Rule = &Rule{Action: RULE_ALWAYS}
+	digest.Fire(notification)
+	if len(recorder.fired) != 1 || recorder.fired[0] != notification {
+		t.Errorf("Critical notification should not wait for the digest")
+	}
+
+	resolved := newTestNotification()
+	resolved.Kind = NOTIFY_RESOLVED
+	resolved.Incident = &Incident{Id: 1}
+	digest.Fire(resolved)
+	if len(recorder.fired) != 2 {
+		t.Errorf("Resolved incidents should not wait for the digest")
+	}
+}
+
+func TestDigestIsSentAgainWhenItFails(t *testing.T) {
+	outbox := &memOutboxStore{}
+	failing := &failingNotifier{}
+	digest := NewDigestNotifier(failing, time.Hour, newMemNotifyStore(), outbox, "digest:email").(*DigestNotifier)
+	digest.Fire(newTestNotification())
+	if len(outbox.FetchHeld("digest:email")) != 1 || len(outbox.FetchHeld("digest:slack")) != 0 {
+		t.Fatalf("Notification should be held in the outbox under the scope of the digest")
+	}
+
+	digest.flush()
+	if failing.attempts != 1 || len(outbox.FetchHeld("digest:email")) != 1 {
+		t.Errorf("Notifications of a digest that failed should stay held")
+	}
+
+	recorder := &recordingNotifier{}
+	digest.notifier = recorder
+	digest.flush()
+	if len(recorder.fired) != 1 || len(outbox.FetchHeld("digest:email")) != 0 {
+		t.Errorf("Digest should be sent once the notifier recovers")
+	}
+}
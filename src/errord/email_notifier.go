@@ -0,0 +1,367 @@
+package errord
+
+import (
+	"bytes"
+	"crypto/tls"
+	"encoding/base64"
+	"fmt"
+	"html/template"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/png"
+	"io"
+	"log"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net"
+	"net/smtp"
+	"net/textproto"
+	"strings"
+	"time"
+)
+
+const EMAIL_TLS_STARTTLS string = "starttls"
+const EMAIL_TLS_IMPLICIT string = "tls"
+const EMAIL_TLS_NONE string = "none"
+
+const CHART_DAYS int = 14
+const CHART_CID string = "chart@errord"
+
+const EMAIL_HTML_TEMPLATE string = `<!DOCTYPE html>
+<html>
+<body style="font-family: sans-serif">
+<h2>{{.Subject}}</h2>
+<pre style="font-size: 13px">{{.Body}}</pre>
+{{if .Chart}}<p>Last {{.Days}} days</p>
+<img src="cid:{{.Chart}}" alt="Daily count of the last {{.Days}} days">
+{{end}}{{if .Ack}}<p><a href="{{.Ack}}">Acknowledge the incident</a></p>
+{{end}}</body>
+</html>
+`
+
+var emailTemplate = template.Must(template.New("email").Parse(EMAIL_HTML_TEMPLATE))
+
+/*
+EmailConfig is where and how emails are sent. To, Cc and Bcc are comma separated lists of addresses. TLS is starttls, tls for
+implicit TLS as on port 465, or none for a local relay. Without TLS it defaults to tls on port 465 and starttls on any other port.
+Port defaults to 587, or 465 with TLS tls. Without a Pass nothing is authenticated, and Username defaults to From
+*/
+type EmailConfig struct {
+	Host     string
+	Port     int
+	TLS      string
+	Username string
+	Pass     string
+	From     string
+	To       string
+	Cc       string
+	Bcc      string
+}
+
+// EmailNotifier sends multipart emails with a text body and an HTML body with a chart of the daily counts of the exception
+type EmailNotifier struct {
+	config  EmailConfig
+	timeout time.Duration
+	stats   StatStore
+	store   NotifyStore
+}
+
+func (c EmailConfig) validate() error {
+	switch {
+	case c.Host == "" || c.From == "":
+		return fmt.Errorf("Email notifier requires a Host and From address")
+	case c.hasPort():
+		host, port, _ := net.SplitHostPort(c.Host)
+		return fmt.Errorf("Email Host must not include a port. Got '%v', use \"Host\": \"%v\", \"Port\": %v instead", c.Host, host, port)
+	case len(c.recipients()) == 0:
+		return fmt.Errorf("Email notifier requires at least one To, Cc or Bcc address")
+	case c.tls() != EMAIL_TLS_STARTTLS && c.tls() != EMAIL_TLS_IMPLICIT && c.tls() != EMAIL_TLS_NONE:
+		return fmt.Errorf("Email TLS must be '%v', '%v' or '%v'. Got '%v'", EMAIL_TLS_STARTTLS, EMAIL_TLS_IMPLICIT, EMAIL_TLS_NONE, c.TLS)
+	}
+	return nil
+}
+
+// hasPort is whether Host includes a port, which would be doubled when Port is added to it
+func (c EmailConfig) hasPort() bool {
+	_, _, err := net.SplitHostPort(c.Host)
+	return err == nil
+}
+
+func (c EmailConfig) tls() string {
+	if c.TLS == "" && c.Port == 465 {
+		return EMAIL_TLS_IMPLICIT
+	} else if c.TLS == "" {
+		return EMAIL_TLS_STARTTLS
+	}
+	return c.TLS
+}
+
+func (c EmailConfig) addr() string {
+	port := c.Port
+	if port == 0 && c.tls() == EMAIL_TLS_IMPLICIT {
+		port = 465
+	} else if port == 0 {
+		port = 587
+	}
+	return net.JoinHostPort(c.Host, fmt.Sprint(port))
+}
+
+// recipients are all the addresses the email is sent to, including the Bcc addresses that are left out of the headers
+func (c EmailConfig) recipients() []string {
+	return append(append(addresses(c.To), addresses(c.Cc)...), addresses(c.Bcc)...)
+}
+
+func addresses(list string) []string {
+	addresses := []string{}
+	for _, a := range strings.Split(list, ",") {
+		if a = strings.TrimSpace(a); a != "" {
+			addresses = append(addresses, a)
+		}
+	}
+	return addresses
+}
+
+func NewEmailNotifier(c EmailConfig, stats StatStore, store NotifyStore) (Notifier, error) {
+	if err := c.validate(); err != nil {
+		return nil, err
+	}
+	n := new(EmailNotifier)
+	n.config = c
+	n.timeout = 30 * time.Second
+	n.stats = stats
+	n.store = store
+	return n, nil
+}
+
+func (n *EmailNotifier) Fire(notification *ErrorNotification) error {
+	if n.store.HasNotification(notification) {
+		log.Printf("Notification already sent for %v\n", notification.ErrorEvent)
+		return nil
+	}
+	msg, err := n.message(notification)
+	if err != nil {
+		log.Printf("Failed creating email -> %v\n", err)
+		return err
+	}
+	log.Printf("Sending Notifcation via Email to %v\n", n.config.addr())
+	if err := n.send(msg); err != nil {
+		log.Printf("Failed sending email -> %v\n", err)
+		return err
+	}
+	log.Printf("Notification Sent! Updating Store\n")
+	markSent(n.store, notification)
+	return nil
+}
+
+// send delivers the message with TLS and authentication as configured
+func (n *EmailNotifier) send(msg []byte) error {
+	c := n.config
+	host := c.Host
+	var conn net.Conn
+	var err error
+	if c.tls() == EMAIL_TLS_IMPLICIT {
+		conn, err = tls.DialWithDialer(&net.Dialer{Timeout: n.timeout}, "tcp", c.addr(), &tls.Config{ServerName: host})
+	} else {
+		conn, err = net.DialTimeout("tcp", c.addr(), n.timeout)
+	}
+	if err != nil {
+		return err
+	}
+	conn.SetDeadline(time.Now().Add(n.timeout))
+	client, err := smtp.NewClient(conn, host)
+	if err != nil {
+		conn.Close()
+		return err
+	}
+	defer client.Close()
+	if c.tls() == EMAIL_TLS_STARTTLS {
+		if ok, _ := client.Extension("STARTTLS"); !ok {
+			return fmt.Errorf("%v does not support STARTTLS. Configure TLS none to send without encryption", c.addr())
+		}
+		if err := client.StartTLS(&tls.Config{ServerName: host}); err != nil {
+			return err
+		}
+	}
+	if c.Pass != "" {
+		username := c.Username
+		if username == "" {
+			username = c.From
+		}
+		if err := client.Auth(smtp.PlainAuth("", username, c.Pass, host)); err != nil {
+			return err
+		}
+	}
+	if err := client.Mail(c.From); err != nil {
+		return err
+	}
+	for _, r := range c.recipients() {
+		if err := client.Rcpt(r); err != nil {
+			return err
+		}
+	}
+	w, err := client.Data()
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(msg); err != nil {
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+	return client.Quit()
+}
+
+/*
+message is a multipart/alternative email with the text body and a multipart/related HTML body with the chart as an inline image.
+The HTML body is rendered from the html template of the notifier, from the report, or from the text body
+*/
+func (n *EmailNotifier) message(notification *ErrorNotification) ([]byte, error) {
+	subject, body := notification.describe()
+	chart, err := n.chart(notification)
+	if err != nil {
+		log.Printf("Failed drawing chart for [%v]: %v\n", subject, err)
+	}
+	html, err := n.html(notification, subject, body, chart != nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var msg bytes.Buffer
+	alternative := multipart.NewWriter(&msg)
+	fmt.Fprintf(&msg, "From: %v\r\n", n.config.From)
+	if to := addresses(n.config.To); len(to) > 0 {
+		fmt.Fprintf(&msg, "To: %v\r\n", strings.Join(to, ", "))
+	}
+	if cc := addresses(n.config.Cc); len(cc) > 0 {
+		fmt.Fprintf(&msg, "Cc: %v\r\n", strings.Join(cc, ", "))
+	}
+	fmt.Fprintf(&msg, "Subject: %v\r\n", mime.QEncoding.Encode("utf-8", subject))
+	fmt.Fprintf(&msg, "Date: %v\r\n", time.Now().Format(time.RFC1123Z))
+	fmt.Fprintf(&msg, "MIME-Version: 1.0\r\n")
+	fmt.Fprintf(&msg, "Content-Type: multipart/alternative; boundary=%v\r\n\r\n", alternative.Boundary())
+
+	if err := writeQuotedPrintable(alternative, "text/plain; charset=utf-8", body); err != nil {
+		return nil, err
+	}
+	var related bytes.Buffer
+	relatedWriter := multipart.NewWriter(&related)
+	if err := writeQuotedPrintable(relatedWriter, "text/html; charset=utf-8", html); err != nil {
+		return nil, err
+	}
+	if chart != nil {
+		part, err := relatedWriter.CreatePart(textproto.MIMEHeader{
+			"Content-Type":              {"image/png"},
+			"Content-Transfer-Encoding": {"base64"},
+			"Content-Id":                {"<" + CHART_CID + ">"},
+			"Content-Disposition":       {`inline; filename="chart.png"`},
+		})
+		if err != nil {
+			return nil, err
+		}
+		writeBase64(part, chart)
+	}
+	if err := relatedWriter.Close(); err != nil {
+		return nil, err
+	}
+	part, err := alternative.CreatePart(textproto.MIMEHeader{"Content-Type": {"multipart/related; boundary=" + relatedWriter.Boundary()}})
+	if err != nil {
+		return nil, err
+	}
+	if _, err := part.Write(related.Bytes()); err != nil {
+		return nil, err
+	}
+	if err := alternative.Close(); err != nil {
+		return nil, err
+	}
+	return msg.Bytes(), nil
+}
+
+func (n *EmailNotifier) html(notification *ErrorNotification, subject, body string, chart bool) (string, error) {
+	if notification.rendered != nil && notification.rendered.HTML != "" {
+		return notification.rendered.HTML, nil
+	}
+	if notification.Kind == NOTIFY_REPORT {
+		return notification.Report.HTML()
+	}
+	data := struct {
+		Subject string
+		Body    string
+		Chart   string
+		Days    int
+		Ack     string
+	}{subject, body, "", CHART_DAYS, notification.AckURL}
+	if chart {
+		data.Chart = CHART_CID
+	}
+	var b bytes.Buffer
+	err := emailTemplate.Execute(&b, data)
+	return b.String(), err
+}
+
+// chart is a PNG bar chart of the daily totals of the exception. There is no chart when the exception has no history
+func (n *EmailNotifier) chart(notification *ErrorNotification) ([]byte, error) {
+	if notification.ErrorEvent == nil || notification.Kind == NOTIFY_DIGEST || notification.Kind == NOTIFY_REPORT {
+		return nil, nil
+	}
+	history := notification.History
+	if len(history) == 0 && n.stats != nil {
+		history = n.stats.FetchDaySummariesByName(notification.ErrorEvent.Exception)
+	}
+	totals, max := dailyTotals(history, CHART_DAYS)
+	if max == 0 {
+		return nil, nil
+	}
+	return drawChart(totals, max)
+}
+
+// drawChart draws a bar per total with today's bar highlighted
+func drawChart(totals []int, max int) ([]byte, error) {
+	const barWidth, gap, height, padding = 24, 6, 120, 10
+	width := len(totals)*(barWidth+gap) - gap + 2*padding
+	img := image.NewRGBA(image.Rect(0, 0, width, height+2*padding))
+	draw.Draw(img, img.Bounds(), &image.Uniform{color.White}, image.ZP, draw.Src)
+	bar := color.RGBA{0xd9, 0x8c, 0x8c, 0xff}
+	today := color.RGBA{0xc0, 0x39, 0x2b, 0xff}
+	axis := color.RGBA{0x99, 0x99, 0x99, 0xff}
+	for i, total := range totals {
+		h := total * height / max
+		if total > 0 && h == 0 {
+			h = 1
+		}
+		c := bar
+		if i == len(totals)-1 {
+			c = today
+		}
+		x := padding + i*(barWidth+gap)
+		draw.Draw(img, image.Rect(x, padding+height-h, x+barWidth, padding+height), &image.Uniform{c}, image.ZP, draw.Src)
+	}
+	draw.Draw(img, image.Rect(padding/2, padding+height, width-padding/2, padding+height+1), &image.Uniform{axis}, image.ZP, draw.Src)
+	var b bytes.Buffer
+	err := png.Encode(&b, img)
+	return b.Bytes(), err
+}
+
+func writeQuotedPrintable(w *multipart.Writer, contentType, content string) error {
+	part, err := w.CreatePart(textproto.MIMEHeader{"Content-Type": {contentType}, "Content-Transfer-Encoding": {"quoted-printable"}})
+	if err != nil {
+		return err
+	}
+	qp := quotedprintable.NewWriter(part)
+	if _, err := qp.Write([]byte(content)); err != nil {
+		return err
+	}
+	return qp.Close()
+}
+
+// writeBase64 writes the content base64 encoded in lines of 76 characters
+func writeBase64(w io.Writer, content []byte) {
+	encoded := base64.StdEncoding.EncodeToString(content)
+	for len(encoded) > 76 {
+		w.Write([]byte(encoded[:76] + "\r\n"))
+		encoded = encoded[76:]
+	}
+	w.Write([]byte(encoded + "\r\n"))
+}
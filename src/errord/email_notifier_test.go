@@ -0,0 +1,163 @@
+package errord
+
+import (
+	"bufio"
+	"bytes"
+	"io/ioutil"
+	"mime"
+	"mime/multipart"
+	"net"
+	"net/mail"
+	"strings"
+	"testing"
+	"time"
+)
+
+// smtpSink is a local SMTP server that accepts every message without TLS or authentication
+type smtpSink struct {
+	listener   net.Listener
+	recipients []string
+	data       string
+	done       chan bool
+}
+
+func newSMTPSink(t *testing.T) *smtpSink {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed starting SMTP sink: %v", err)
+	}
+	s := &smtpSink{listener: l, done: make(chan bool, 1)}
+	go s.serve()
+	return s
+}
+
+func (s *smtpSink) port() int {
+	return s.listener.Addr().(*net.TCPAddr).Port
+}
+
+func (s *smtpSink) serve() {
+	conn, err := s.listener.Accept()
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+	reply := func(line string) { conn.Write([]byte(line + "\r\n")) }
+	reply("220 sink ready")
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return
+		}
+		command := strings.ToUpper(strings.TrimSpace(line))
+		switch {
+		case strings.HasPrefix(command, "EHLO"), strings.HasPrefix(command, "HELO"):
+			reply("250 sink")
+		case strings.HasPrefix(command, "RCPT TO:"):
+			s.recipients = append(s.recipients, strings.Trim(strings.TrimSpace(line)[8:], "<>"))
+			reply("250 OK")
+		case command == "DATA":
+			reply("354 End data with <CR><LF>.<CR><LF>")
+			var data bytes.Buffer
+			for {
+				l, err := r.ReadString('\n')
+				if err != nil || l == ".\r\n" {
+					break
+				}
+				data.WriteString(strings.TrimPrefix(l, "."))
+			}
+			s.data = data.String()
+			reply("250 OK")
+		case command == "QUIT":
+			reply("221 Bye")
+			s.done <- true
+			return
+		default:
+			reply("250 OK")
+		}
+	}
+}
+
+func TestEmailNotifierSendsMultipartEmail(t *testing.T) {
+	sink := newSMTPSink(t)
+	defer sink.listener.Close()
+	config := EmailConfig{Host: "127.0.0.1", Port: sink.port(), TLS: EMAIL_TLS_NONE, From: "errord@example.com",
+		To: "dev@example.com, ops@example.com", Cc: "lead@example.com", Bcc: "audit@example.com"}
+	notifier, err := NewEmailNotifier(config, nil, newMemNotifyStore())
+	if err != nil {
+		t.Fatalf("Valid email config should not return an error: %v", err)
+	}
+	n := newTestNotification()
+	n.History = []*DaySummary{{Date: time.Now().AddDate(0, 0, -1), Total: 4}, {Date: time.Now(), Total: 9}}
+	if err := notifier.Fire(n); err != nil {
+		t.Fatalf("Email should be sent to the sink: %v", err)
+	}
+	select {
+	case <-sink.done:
+	case <-time.After(5 * time.Second):
+		t.Fatalf("Sink did not receive the email")
+	}
+
+	if strings.Join(sink.recipients, ",") != "dev@example.com,ops@example.com,lead@example.com,audit@example.com" {
+		t.Errorf("Email should be sent to the To, Cc and Bcc addresses. Got %v", sink.recipients)
+	}
+	msg, err := mail.ReadMessage(strings.NewReader(sink.data))
+	if err != nil {
+		t.Fatalf("Email should be a valid message: %v", err)
+	}
+	if msg.Header.Get("Bcc") != "" || msg.Header.Get("Cc") != "lead@example.com" {
+		t.Errorf("Bcc addresses should not be in the headers")
+	}
+	mediaType, params, _ := mime.ParseMediaType(msg.Header.Get("Content-Type"))
+	if mediaType != "multipart/alternative" {
+		t.Fatalf("Email should be multipart/alternative. Got %v", mediaType)
+	}
+	parts := multipart.NewReader(msg.Body, params["boundary"])
+	text, _ := parts.NextPart()
+	content, _ := ioutil.ReadAll(text)
+	if !strings.HasPrefix(text.Header.Get("Content-Type"), "text/plain") || !strings.Contains(string(content), "java.sql.SQLException") {
+		t.Errorf("First part should be the text body. Got %v", string(content))
+	}
+	related, _ := parts.NextPart()
+	mediaType, params, _ = mime.ParseMediaType(related.Header.Get("Content-Type"))
+	if mediaType != "multipart/related" {
+		t.Fatalf("Second part should be multipart/related. Got %v", mediaType)
+	}
+	relatedParts := multipart.NewReader(related, params["boundary"])
+	html, _ := relatedParts.NextPart()
+	content, _ = ioutil.ReadAll(html)
+	if !strings.Contains(string(content), `src="cid:`+CHART_CID+`"`) {
+		t.Errorf("HTML body should show the inline chart. Got %v", string(content))
+	}
+	chart, err := relatedParts.NextPart()
+	if err != nil || chart.Header.Get("Content-Type") != "image/png" || chart.Header.Get("Content-Id") != "<"+CHART_CID+">" {
+		t.Errorf("Chart should be attached as an inline PNG: %v", err)
+	}
+}
+
+func TestEmailNotifierRequiresStartTLS(t *testing.T) {
+	sink := newSMTPSink(t)
+	defer sink.listener.Close()
+	notifier, _ := NewEmailNotifier(EmailConfig{Host: "127.0.0.1", Port: sink.port(), From: "errord@example.com", To: "dev@example.com"}, nil, newMemNotifyStore())
+	if err := notifier.Fire(newTestNotification()); err == nil || !strings.Contains(err.Error(), "STARTTLS") {
+		t.Errorf("Email should not be sent unencrypted when the server does not support STARTTLS. Got %v", err)
+	}
+	if len(sink.recipients) != 0 {
+		t.Errorf("No recipients should be sent before STARTTLS")
+	}
+}
+
+func TestEmailConfigDefaults(t *testing.T) {
+	if c := (EmailConfig{Host: "smtp.example.com"}); c.addr() != "smtp.example.com:587" || c.tls() != EMAIL_TLS_STARTTLS {
+		t.Errorf("Email should default to STARTTLS on port 587. Got %v %v", c.addr(), c.tls())
+	}
+	if c := (EmailConfig{Host: "smtp.example.com", Port: 465}); c.tls() != EMAIL_TLS_IMPLICIT {
+		t.Errorf("Port 465 should default to implicit TLS. Got %v", c.tls())
+	}
+	if _, err := NewEmailNotifier(EmailConfig{Host: "smtp.example.com", From: "errord@example.com", To: "a@example.com", TLS: "ssl"}, nil, nil); err == nil {
+		t.Errorf("Unknown TLS mode should not be valid")
+	}
+	if _, err := NewEmailNotifier(EmailConfig{Host: "smtp.example.com:587", From: "errord@example.com", To: "a@example.com"}, nil, nil); err == nil {
+		t.Errorf("Host with a port should not be valid")
+	}
+}
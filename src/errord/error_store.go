@@ -2,30 +2,108 @@ package errord
 
 import (
 	"database/sql"
+	"errors"
 	"log"
+	"strings"
+	"time"
 )
 
+var ErrDuplicateEvent error = errors.New("Error event is already stored")
+
 type ErrorStore interface {
 	Add(e *ErrorEvent) error
+	FetchErrorEvents(since time.Time) []ErrorEvent
+	FetchExceptionEvents(since time.Time, exceptions []string) []ErrorEvent
+	QueryErrorEvents(q Query) ([]ErrorEvent, int, error)
 }
 
 type errorStore struct {
-	db *sql.DB
+	db      *sql.DB
+	service string
 }
 
 func (store *errorStore) Add(e *ErrorEvent) error {
 	var count int
 	log.Printf("Inserting -> %v : %v\n", *e.Timestamp, e.Exception)
-	store.db.QueryRow(`select count(id) from error_events where event_datetime=? description=? AND exception=? AND excp_description=?`,
+	store.db.QueryRow(`select count(id) from error_events where event_datetime=? AND description=? AND exception=? AND excp_description=?`,
 		e.Timestamp, e.Description, e.Exception, e.Detail).Scan(&count)
 	if count > 0 {
 		log.Printf("[%v : %v] Already exists!\n", *e.Timestamp, e.Exception)
-		return nil
+		return ErrDuplicateEvent
 	}
-	_, err := store.db.Exec(`insert into error_events(event_datetime, level, description, exception, excp_description) 
-	values (?, ?, ?, ?, ?, ?)`, e.Timestamp, string(e.Level), e.Description, e.Exception, e.Detail)
+	defer METRICS.Since("errord_db_write_duration_seconds", time.Now(), "table", "error_events")
+	_, err := store.db.Exec(`insert into error_events(event_datetime, level, description, exception, excp_description, source, release_id) 
+	values (?, ?, ?, ?, ?, ?, (`+SQL_RELEASE_AT+`))`, e.Timestamp, string(e.Level), e.Description, e.Exception, e.Detail, e.Source, e.Timestamp.UTC(), store.service)
 	if err != nil {
 		return err
 	}
 	return nil
 }
+
+func (store *errorStore) FetchErrorEvents(since time.Time) []ErrorEvent {
+	var events []ErrorEvent
+	rows, err := store.db.Query(`select event_datetime, level, description, exception, excp_description, source from error_events
+	where event_datetime >= ? order by event_datetime`, since)
+	if err != nil {
+		log.Printf("Failed fetching Error Events since [%v]: %v\n", since, err)
+		return events
+	}
+	return scanErrorEvents(rows)
+}
+
+// FetchExceptionEvents is like FetchErrorEvents but only fetches the events of the exceptions
+func (store *errorStore) FetchExceptionEvents(since time.Time, exceptions []string) []ErrorEvent {
+	var events []ErrorEvent
+	if len(exceptions) == 0 {
+		return events
+	}
+	args := []interface{}{since}
+	for _, exception := range exceptions {
+		args = append(args, exception)
+	}
+	rows, err := store.db.Query(`select event_datetime, level, description, exception, excp_description, source from error_events
+	where event_datetime >= ? and exception in (?`+strings.Repeat(", ?", len(exceptions)-1)+`) order by event_datetime`, args...)
+	if err != nil {
+		log.Printf("Failed fetching Error Events of %v since [%v]: %v\n", exceptions, since, err)
+		return events
+	}
+	return scanErrorEvents(rows)
+}
+
+// QueryErrorEvents pages the error events, newest first
+func (store *errorStore) QueryErrorEvents(q Query) ([]ErrorEvent, int, error) {
+	where, args := q.where("event_datetime", "exception")
+	total, err := countRows(store.db, "error_events", where, args)
+	if err != nil {
+		return nil, 0, err
+	}
+	rows, err := store.db.Query(`select event_datetime, level, description, exception, excp_description, source from error_events`+where+
+		` order by event_datetime desc, id desc`+q.page(), args...)
+	if err != nil {
+		return nil, 0, err
+	}
+	events := scanErrorEvents(rows)
+	if events == nil {
+		events = []ErrorEvent{}
+	}
+	return events, total, nil
+}
+
+func scanErrorEvents(rows *sql.Rows) []ErrorEvent {
+	var events []ErrorEvent
+	defer rows.Close()
+	for rows.Next() {
+		var e ErrorEvent
+		var timestamp time.Time
+		var level string
+		err := rows.Scan(&timestamp, &level, &e.Description, &e.Exception, &e.Detail, &e.Source)
+		if err != nil {
+			log.Printf("Failed mapping Error Event: %v\n", err)
+			continue
+		}
+		e.Timestamp = &timestamp
+		e.Level = Level(level)
+		events = append(events, e)
+	}
+	return events
+}
@@ -32,7 +32,7 @@ var CAUSED_BY_REGEX = regexp.MustCompile(`Caused by:\s([\w\d\.]+):?\s?(.*)`)
 
 type ErrorParser interface {
 	Parse(src string) ParseStats
-	Watch(src string) chan ErrorEvent
+	Watch(src string, bus *EventBus)
 }
 
 type LogFileParser struct {
@@ -43,6 +43,7 @@ type LogFileParser struct {
 type Event struct {
 	Timestamp   *time.Time
 	Level       Level
+	Source      string
 	Description string
 }
 
@@ -58,14 +59,16 @@ type MetricEvent struct {
 	Value float32
 }
 
+// ParseStats counts the lines of a parsed file. Duplicates are error events that were already stored, for example by an earlier parse
 type ParseStats struct {
-	Lines   int
-	Failed  int
-	Success int
+	Lines      int
+	Failed     int
+	Success    int
+	Duplicates int
 }
 
 func (p ParseStats) string() string {
-	return fmt.Sprintf("Lines [%v] Failed [%v] Succeeded[%v]", p.Lines, p.Failed, p.Success)
+	return fmt.Sprintf("Lines [%v] Failed [%v] Succeeded[%v] Duplicates [%v]", p.Lines, p.Failed, p.Success, p.Duplicates)
 }
 
 func (e *ErrorEvent) string() string {
@@ -92,48 +95,84 @@ func (p *LogFileParser) Parse(src string) ParseStats {
 		return stats
 	}
 	scanner := bufio.NewScanner(file)
+	//Caused by lines are not log lines. They belong to the log line that was logged before them
+	var last *Event
 	for scanner.Scan() {
 		line := scanner.Text()
 		stats.Lines++
 		event, err := parseLogLine(line)
 		if err != nil {
 			stats.Failed++
+		} else {
+			last = event
 		}
-		errorEvent, err := createErrorEvent(line, event)
+		errorEvent, err := createErrorEvent(line, last)
 		if err != nil {
 			continue
 		}
 		err = p.errorStorage.Add(errorEvent)
-		if err != nil {
-			log.Printf("Failed inserting Event[%v - %v]", event.Timestamp, errorEvent.Exception)
+		if err == ErrDuplicateEvent {
+			stats.Duplicates++
+		} else if err != nil {
+			log.Printf("Failed inserting Event[%v - %v]", errorEvent.Timestamp, errorEvent.Exception)
 		} else {
+			METRICS.countEvent(errorEvent)
 			stats.Success++
 		}
 	}
+	METRICS.Add("errord_lines_total", float64(stats.Lines))
+	METRICS.Add("errord_lines_failed_total", float64(stats.Failed))
+	METRICS.Add("errord_events_stored_total", float64(stats.Success))
 	return stats
 }
 
-func (p *LogFileParser) Watch(src string) chan ErrorEvent {
+/*
+Watch tails the file and publishes every error event on the bus once it is stored. Events that are already stored, like the lines
+read again when the file is reopened, and events that failed to store are not published, so that issues only count stored events.
+The bus is closed when the tail stops
+*/
+func (p *LogFileParser) Watch(src string, bus *EventBus) {
 	//Should add some way to stop go routine. Maybe errorStorage the Tail t variable since it might have a stop method ?
-	eventBus := make(chan ErrorEvent)
 	go func() {
+		defer bus.Close()
 		t, _ := tail.TailFile(src, tail.Config{Follow: true, ReOpen: true})
+		var last *Event
 		for l := range t.Lines {
 			line := l.Text
-			event, err := parseLogLine(line)
-			errorEvent, err := createErrorEvent(line, event)
+			METRICS.Add("errord_lines_total", 1)
+			measureTailLag(t, src)
+			if event, err := parseLogLine(line); err == nil {
+				last = event
+			} else {
+				METRICS.Add("errord_lines_failed_total", 1)
+			}
+			errorEvent, err := createErrorEvent(line, last)
 			if err != nil {
 				continue
 			}
 			err = p.errorStorage.Add(errorEvent)
-			if err != nil {
+			if err == ErrDuplicateEvent {
+				continue
+			} else if err != nil {
 				log.Printf("Failed inserting Event[%v - %v] -> %v", errorEvent.Timestamp, errorEvent.Exception, err)
+				continue
 			}
-			log.Printf("Passing Event to ErrorChan!")
-			eventBus <- *errorEvent
+			METRICS.Add("errord_events_stored_total", 1)
+			log.Printf("Publishing Event on the EventBus!")
+			bus.Publish(*errorEvent)
 		}
 	}()
-	return eventBus
+}
+
+// measureTailLag sets how far the tail is behind the end of the file
+func measureTailLag(t *tail.Tail, src string) {
+	offset, err := t.Tell()
+	if err != nil {
+		return
+	}
+	if info, err := os.Stat(src); err == nil {
+		METRICS.Set("errord_tail_lag_bytes", float64(info.Size()-offset))
+	}
 }
 
 func createErrorEvent(line string, event *Event) (*ErrorEvent, error) {
@@ -175,7 +214,7 @@ func parseLogLine(line string) (*Event, error) {
 	}
 	event.Level = level
 
-	//Skipping matches[3] which is supposed to be the source
+	event.Source = toSource(matches[3])
 	event.Description = matches[4]
 	return event, nil
 }
@@ -202,6 +241,14 @@ func containsCausedBy(line string) bool {
 	return false
 }
 
+// The source is logged as class:line. The line number is dropped so that the source stays the same between releases
+func toSource(source string) string {
+	if i := strings.LastIndex(source, ":"); i != -1 {
+		return source[:i]
+	}
+	return source
+}
+
 func toTimestamp(date string) (*time.Time, error) {
 	date = strings.Replace(date, ",", ".", 1)
 	timestamp, err := time.Parse(DATE_FORMAT, date)
@@ -1,6 +1,8 @@
 package errord
 
 import (
+	"io/ioutil"
+	"os"
 	"testing"
 	"time"
 )
@@ -111,6 +113,10 @@ func TestParseLogLineOfERRORLine(t *testing.T) {
 		t.Errorf("Event does not contain the Timestamp as its defined in the ERROR line: [%v] - Error: [%v]", logEvent.Timestamp, err)
 	}
 
+	if logEvent.Source != "client.AirtelService" {
+		t.Errorf("Event source should not contain the line number. Got [%v]", logEvent.Source)
+	}
+
 	expectedDescription := "0833574730 : Encountered an error while querying balance : TranRef[testRef]"
 	if logEvent.Description != expectedDescription {
 		t.Errorf("Event does not contain description as its defined in the ERROR line. Got [%v] Expected [%v]", logEvent.Description, expectedDescription)
@@ -267,3 +273,60 @@ func TestCreateErrorEvent(t *testing.T) {
 	}
 
 }
+
+type memErrorStore struct {
+	events []ErrorEvent
+}
+
+func (s *memErrorStore) Add(e *ErrorEvent) error {
+	for _, stored := range s.events {
+		if stored.Timestamp.Equal(*e.Timestamp) && stored.Description == e.Description && stored.Exception == e.Exception && stored.Detail == e.Detail {
+			return ErrDuplicateEvent
+		}
+	}
+	s.events = append(s.events, *e)
+	return nil
+}
+
+func (s *memErrorStore) FetchErrorEvents(since time.Time) []ErrorEvent {
+	return s.events
+}
+
+func (s *memErrorStore) FetchExceptionEvents(since time.Time, exceptions []string) []ErrorEvent {
+	events := []ErrorEvent{}
+	for _, e := range s.events {
+		for _, exception := range exceptions {
+			if e.Exception == exception && !e.Timestamp.Before(since) {
+				events = append(events, e)
+			}
+		}
+	}
+	return events
+}
+
+func (s *memErrorStore) QueryErrorEvents(q Query) ([]ErrorEvent, int, error) {
+	return s.events, len(s.events), nil
+}
+
+func TestParseCountsDuplicatesSeparately(t *testing.T) {
+	file, err := ioutil.TempFile("", "errord-parse")
+	if err != nil {
+		t.Fatalf("Failed creating log file: %v", err)
+	}
+	defer os.Remove(file.Name())
+	file.WriteString("[2016-03-23 15:41:48,939] ERROR client.AirtelService:54 - Encountered an error while querying balance\n" +
+		"Caused by: java.net.SocketTimeoutException: Read timed out\n")
+	file.Close()
+
+	store := &memErrorStore{}
+	parser := NewLogFileParser(store, nil)
+	if stats := parser.Parse(file.Name()); stats.Success != 1 || stats.Duplicates != 0 {
+		t.Errorf("First parse should store the event. Got %v", stats.string())
+	}
+	if stats := parser.Parse(file.Name()); stats.Success != 0 || stats.Duplicates != 1 {
+		t.Errorf("Parsing the file again should only find duplicates. Got %v", stats.string())
+	}
+	if len(store.events) != 1 {
+		t.Errorf("Duplicate events should not be stored. Got %v events", len(store.events))
+	}
+}
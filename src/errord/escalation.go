@@ -0,0 +1,204 @@
+package errord
+
+import (
+	"crypto/hmac"
+	"errors"
+	"fmt"
+	"log"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const NOTIFY_ESCALATED NotificationKind = "escalated"
+
+var ErrInvalidAckSignature error = errors.New("Acknowledge link is not valid")
+
+// EscalationStep notifies its Targets when an incident has not been acknowledged After it was opened
+type EscalationStep struct {
+	After   string
+	Targets []string
+	after   time.Duration
+}
+
+/*
+EscalationPolicy escalates the incidents of the routes that name it. The targets of the route are notified when the incident opens
+and every step notifies its targets once the incident has been open for the After of the step without being acknowledged
+*/
+type EscalationPolicy struct {
+	Name  string
+	Steps []*EscalationStep
+}
+
+// Escalation is the step of an escalation policy a notification was sent for. Step 0 is the notification of the route itself
+type Escalation struct {
+	Policy string
+	Step   int
+	After  time.Duration
+}
+
+func (p *EscalationPolicy) compile(notifiers map[string]Notifier) error {
+	if p.Name == "" || len(p.Steps) == 0 {
+		return errors.New("Escalation policy requires a Name and at least one step")
+	}
+	var last time.Duration
+	for i, step := range p.Steps {
+		after, err := time.ParseDuration(step.After)
+		if err != nil {
+			return err
+		}
+		if after <= last {
+			return fmt.Errorf("Step %v of escalation policy %v must come after the step before it", i+1, p.Name)
+		}
+		if err := checkTargets(notifiers, step.Targets); err != nil {
+			return err
+		}
+		step.after = after
+		last = after
+	}
+	return nil
+}
+
+// EnableEscalation lets routes escalate incidents that are not acknowledged with the named escalation policies
+func (r *Router) EnableEscalation(policies []*EscalationPolicy, incidents IncidentStore) error {
+	r.escalations = make(map[string]*EscalationPolicy)
+	for _, p := range policies {
+		if err := p.compile(r.notifiers); err != nil {
+			return err
+		}
+		r.escalations[p.Name] = p
+	}
+	for _, route := range r.routes {
+		if _, ok := r.escalations[route.Escalation]; route.Escalation != "" && !ok {
+			return fmt.Errorf("Route escalates with unknown escalation policy: '%v'", route.Escalation)
+		}
+	}
+	r.incidents = incidents
+	return nil
+}
+
+/*
+EscalateThrough sends escalations through the notifier instead of straight to the targets of the step. The notifier is expected to
+hand them back to the router, like the outbox does, so that escalations are retried and silenced like any other notification
+*/
+func (r *Router) EscalateThrough(n Notifier) {
+	r.escalator = n
+}
+
+// Watch escalates the incidents that have not been acknowledged every interval. It does nothing without escalation policies
+func (r *Router) Watch(interval time.Duration) {
+	if len(r.escalations) == 0 {
+		return
+	}
+	go func() {
+		for range time.Tick(interval) {
+			r.escalate(r.now())
+		}
+	}()
+}
+
+// startEscalation records that the incident is escalated by the policy. The record in the notifications table lets escalation
+// continue after a restart
+func (r *Router) startEscalation(route *Route, n *ErrorNotification) {
+	if route.Escalation == "" || n.Incident == nil || n.Incident.State != INCIDENT_OPEN {
+		return
+	}
+	start := &ErrorNotification{ErrorEvent: n.ErrorEvent, Kind: NOTIFY_ESCALATED, Incident: n.Incident, Escalation: &Escalation{Policy: route.Escalation}}
+	if !r.store.HasNotification(start) {
+		log.Printf("Escalating Incident #%v with policy [%v] until it is acknowledged\n", n.Incident.Id, route.Escalation)
+		r.store.UpdateNotificationSent(start)
+	}
+}
+
+func (r *Router) escalate(now time.Time) {
+	if r.incidents == nil {
+		return
+	}
+	for _, incident := range r.incidents.FetchActiveIncidents() {
+		if incident.State != INCIDENT_OPEN {
+			continue
+		}
+		for _, policy := range r.escalations {
+			if !r.store.HasNotification(&ErrorNotification{ErrorEvent: incident.event(), Kind: NOTIFY_ESCALATED, Incident: incident, Escalation: &Escalation{Policy: policy.Name}}) {
+				continue
+			}
+			for i, step := range policy.Steps {
+				if now.Sub(incident.OpenedAt) < step.after {
+					break
+				}
+				n := &ErrorNotification{ErrorEvent: incident.event(), Kind: NOTIFY_ESCALATED, Incident: incident, Escalation: &Escalation{policy.Name, i + 1, step.after}}
+				if r.store.HasNotification(n) {
+					continue
+				}
+				log.Printf("Incident #%v not acknowledged after %v. Escalating to %v\n", incident.Id, step.after, strings.Join(step.Targets, ", "))
+				r.link(n)
+				if err := r.escalator.Fire(n); err != nil {
+					log.Printf("Failed escalating Incident #%v: %v\n", incident.Id, err)
+					continue
+				}
+				// once the escalator has it the step is done, the outbox retries it until the targets got it
+				markSent(r.store, n)
+			}
+		}
+	}
+}
+
+// fireEscalation notifies the targets of the escalation step unless the incident was acknowledged or resolved in the meantime
+func (r *Router) fireEscalation(n *ErrorNotification) error {
+	policy, ok := r.escalations[n.Escalation.Policy]
+	if !ok || n.Escalation.Step > len(policy.Steps) {
+		log.Printf("Dropping escalation of Incident #%v by unknown policy [%v] step %v\n", n.Incident.Id, n.Escalation.Policy, n.Escalation.Step)
+		return nil
+	}
+	if r.incidents != nil {
+		if incident := r.incidents.GetIncident(n.Incident.Id); incident != nil && incident.State != INCIDENT_OPEN {
+			log.Printf("Incident #%v is %v. Not escalating it\n", incident.Id, incident.State)
+			return nil
+		}
+	}
+	failed := []string{}
+	for _, target := range policy.Steps[n.Escalation.Step-1].Targets {
+		if err := r.fire(target, nil, n); err != nil {
+			failed = append(failed, target)
+		}
+	}
+	if len(failed) > 0 {
+		return fmt.Errorf("Failed escalating to %v", strings.Join(failed, ", "))
+	}
+	return nil
+}
+
+// link adds a signed acknowledge link to notifications of open incidents
+func (r *Router) link(n *ErrorNotification) {
+	if r.links != nil && n.Incident != nil && n.Incident.State == INCIDENT_OPEN {
+		n.AckURL = r.links.Link(n.Incident.Id)
+	}
+}
+
+// AckLinks creates and verifies links that acknowledge an incident without logging in. A link is signed with the secret
+type AckLinks struct {
+	url    string
+	secret string
+}
+
+func NewAckLinks(baseURL, secret string) *AckLinks {
+	if baseURL == "" || secret == "" {
+		return nil
+	}
+	return &AckLinks{strings.TrimRight(baseURL, "/"), secret}
+}
+
+func (l *AckLinks) Link(id int) string {
+	return fmt.Sprintf("%v/ack?%v", l.url, url.Values{"incident": {fmt.Sprint(id)}, "signature": {l.sign(id)}}.Encode())
+}
+
+func (l *AckLinks) Verify(id int, signature string) error {
+	if !hmac.Equal([]byte(signature), []byte(l.sign(id))) {
+		return ErrInvalidAckSignature
+	}
+	return nil
+}
+
+func (l *AckLinks) sign(id int) string {
+	return sign(l.secret, []byte(fmt.Sprintf("ack:%v", id)))
+}
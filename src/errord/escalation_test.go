@@ -0,0 +1,116 @@
+package errord
+
+import (
+	"net/url"
+	"testing"
+	"time"
+)
+
+func TestEscalationNotifiesStepsUntilAcknowledged(t *testing.T) {
+	pager, lead, manager := &recordingNotifier{}, &recordingNotifier{}, &recordingNotifier{}
+	routes := []*Route{{Exception: `^java\.sql\.`, Targets: []string{"pager"}, Escalation: "database"}}
+	router, _ := newTestRouter(t, map[string]Notifier{"pager": pager, "lead": lead, "manager": manager}, routes, nil)
+	incidents := &memIncidentStore{}
+	policies := []*EscalationPolicy{{Name: "database", Steps: []*EscalationStep{
+		{After: "15m", Targets: []string{"lead"}},
+		{After: "1h", Targets: []string{"manager"}},
+	}}}
+	if err := router.EnableEscalation(policies, incidents); err != nil {
+		t.Fatalf("Valid escalation policy should not return an error: %v", err)
+	}
+
+	notification := newTestNotification()
+	incident, _ := incidents.Open(notification.ErrorEvent)
+	notification.Kind = NOTIFY_OPENED
+	notification.Incident = incident
+	router.Fire(notification)
+	if len(pager.fired) != 1 {
+		t.Fatalf("Route targets should be notified when the incident opens")
+	}
+
+	router.escalate(incident.OpenedAt.Add(10 * time.Minute))
+	if len(lead.fired) != 0 {
+		t.Errorf("First step should not escalate before its After")
+	}
+	router.escalate(incident.OpenedAt.Add(20 * time.Minute))
+	router.escalate(incident.OpenedAt.Add(25 * time.Minute))
+	if len(lead.fired) != 1 || len(manager.fired) != 0 {
+		t.Fatalf("First step should escalate once. Got %v, %v", len(lead.fired), len(manager.fired))
+	}
+	if e := lead.fired[0].Escalation; lead.fired[0].Kind != NOTIFY_ESCALATED || e.Policy != "database" || e.Step != 1 {
+		t.Errorf("Escalation should name the policy and step. Got %+v", e)
+	}
+
+	incidents.Acknowledge(incident.Id)
+	router.escalate(incident.OpenedAt.Add(2 * time.Hour))
+	if len(manager.fired) != 0 {
+		t.Errorf("Acknowledged incident should not escalate further")
+	}
+}
+
+func TestEscalationPolicyValidation(t *testing.T) {
+	notifiers := map[string]Notifier{"lead": &recordingNotifier{}}
+	if err := (&EscalationPolicy{Name: "p", Steps: []*EscalationStep{{After: "1h", Targets: []string{"lead"}}, {After: "30m", Targets: []string{"lead"}}}}).compile(notifiers); err == nil {
+		t.Errorf("Steps out of order should not be valid")
+	}
+	if err := (&EscalationPolicy{Name: "p", Steps: []*EscalationStep{{After: "1h", Targets: []string{"boss"}}}}).compile(notifiers); err == nil {
+		t.Errorf("Step with an unknown target should not be valid")
+	}
+	router, _ := newTestRouter(t, notifiers, []*Route{{Targets: []string{"lead"}, Escalation: "missing"}}, nil)
+	if err := router.EnableEscalation(nil, &memIncidentStore{}); err == nil {
+		t.Errorf("Route with an unknown escalation policy should not be valid")
+	}
+}
+
+func TestAckLinks(t *testing.T) {
+	if NewAckLinks("https://errord.example.com", "") != nil {
+		t.Errorf("Acknowledge links require a secret")
+	}
+	links := NewAckLinks("https://errord.example.com/", "secret")
+	link, err := url.Parse(links.Link(42))
+	if err != nil {
+		t.Fatalf("Link should be a valid URL: %v", err)
+	}
+	if link.Path != "/ack" || link.Query().Get("incident") != "42" {
+		t.Errorf("Link should acknowledge the incident. Got %v", link)
+	}
+	if err := links.Verify(42, link.Query().Get("signature")); err != nil {
+		t.Errorf("Signature of the link should verify: %v", err)
+	}
+	if err := links.Verify(43, link.Query().Get("signature")); err != ErrInvalidAckSignature {
+		t.Errorf("Signature should not verify for another incident")
+	}
+}
+
+func TestEscalationGoesThroughTheOutbox(t *testing.T) {
+	pager, lead := &recordingNotifier{}, &failingNotifier{}
+	routes := []*Route{{Targets: []string{"pager"}, Escalation: "database"}}
+	router, _ := newTestRouter(t, map[string]Notifier{"pager": pager, "lead": lead}, routes, nil)
+	incidents := &memIncidentStore{}
+	router.EnableEscalation([]*EscalationPolicy{{Name: "database", Steps: []*EscalationStep{{After: "15m", Targets: []string{"lead"}}}}}, incidents)
+	store := &memOutboxStore{}
+	outbox := NewOutboxNotifier(router, store)
+	router.EscalateThrough(outbox)
+
+	notification := newTestNotification()
+	incident, _ := incidents.Open(notification.ErrorEvent)
+	notification.Kind = NOTIFY_OPENED
+	notification.Incident = incident
+	router.Fire(notification)
+
+	router.escalate(incident.OpenedAt.Add(20 * time.Minute))
+	router.escalate(incident.OpenedAt.Add(25 * time.Minute))
+	if len(store.entries) != 1 || lead.attempts != 0 {
+		t.Fatalf("Escalation should be written to the outbox once. Got %v entries, %v attempts", len(store.entries), lead.attempts)
+	}
+	outbox.check(time.Now())
+	if lead.attempts != 1 || store.entries[0].State != OUTBOX_PENDING || store.entries[0].Attempts != 1 {
+		t.Fatalf("Failed escalation should be retried by the outbox. Got %v attempts, %+v", lead.attempts, store.entries[0])
+	}
+
+	incidents.Acknowledge(incident.Id)
+	outbox.check(time.Now().Add(time.Hour))
+	if lead.attempts != 1 || store.entries[0].State != OUTBOX_DELIVERED {
+		t.Errorf("Escalation of an acknowledged incident should not be sent. Got %v attempts, %+v", lead.attempts, store.entries[0])
+	}
+}
@@ -0,0 +1,169 @@
+package errord
+
+import (
+	"errors"
+	"log"
+	"sync"
+	"time"
+)
+
+type IncidentState string
+
+const INCIDENT_OPEN IncidentState = "open"
+const INCIDENT_ACKNOWLEDGED IncidentState = "acknowledged"
+const INCIDENT_RESOLVED IncidentState = "resolved"
+
+var ErrIncidentNotOpen error = errors.New("Incident does not exist or is not open")
+
+type Incident struct {
+	Id             int
+	Exception      string
+	Fingerprint    string
+	Source         string
+	State          IncidentState
+	OpenedAt       time.Time
+	UpdatedAt      time.Time
+	AcknowledgedAt *time.Time
+	// AckNotifiedAt is when the acknowledgement was notified. It is nil until then
+	AckNotifiedAt *time.Time
+	ResolvedAt    *time.Time
+	Count         int
+}
+
+func (i *Incident) isQuiet(now time.Time, quietPeriod time.Duration) bool {
+	return now.Sub(i.UpdatedAt) >= quietPeriod
+}
+
+func (i *Incident) event() *ErrorEvent {
+	updated := i.UpdatedAt
+	return &ErrorEvent{Event: Event{Timestamp: &updated, Level: ERROR_LOG_LEVEL, Source: i.Source}, Exception: i.Exception}
+}
+
+/*
+IncidentNotifier turns the notifications of the detectors into incidents. The first notification for a fingerprint opens
+an incident and is passed on. The stat engine counts every event of the fingerprint on the incident after that, so following
+notifications are only passed on as an ongoing notification every updateInterval. Incidents that keep counting events without
+being notified are notified as ongoing by Watch. Once no event has been seen for the quiet period the incident is resolved.
+*/
+type IncidentNotifier struct {
+	notifier       Notifier
+	store          IncidentStore
+	quietPeriod    time.Duration
+	updateInterval time.Duration
+	lastUpdate     map[int]time.Time
+	links          *AckLinks
+	lock           sync.Mutex
+}
+
+// NewIncidentNotifier creates an IncidentNotifier. When links is not nil the notifications of open incidents link to their acknowledgement
+func NewIncidentNotifier(n Notifier, store IncidentStore, quietPeriod, updateInterval time.Duration, links *AckLinks) *IncidentNotifier {
+	i := new(IncidentNotifier)
+	i.notifier = n
+	i.store = store
+	i.quietPeriod = quietPeriod
+	i.updateInterval = updateInterval
+	i.lastUpdate = make(map[int]time.Time)
+	i.links = links
+	return i
+}
+
+func (i *IncidentNotifier) Fire(n *ErrorNotification) error {
+	i.lock.Lock()
+	defer i.lock.Unlock()
+	incident := i.store.GetActiveIncident(n.ErrorEvent.Fingerprint())
+	if incident == nil {
+		incident, err := i.store.Open(n.ErrorEvent)
+		if err != nil {
+			log.Printf("Failed opening Incident for [%v]: %v\n", n.ErrorEvent.Exception, err)
+			return err
+		}
+		log.Printf("Opened Incident #%v for [%v]\n", incident.Id, incident.Exception)
+		i.lastUpdate[incident.Id] = incident.OpenedAt
+		if n.Kind == NOTIFY_DETECTED {
+			n.Kind = NOTIFY_OPENED
+		}
+		n.Incident = incident
+		return i.fire(n)
+	}
+	if n.Kind != NOTIFY_DETECTED {
+		n.Incident = incident
+		return i.fire(n)
+	}
+	last, ok := i.lastUpdate[incident.Id]
+	if ok && incident.UpdatedAt.Sub(last) < i.updateInterval {
+		return nil
+	}
+	i.lastUpdate[incident.Id] = incident.UpdatedAt
+	n.Kind = NOTIFY_ONGOING
+	n.Incident = incident
+	return i.fire(n)
+}
+
+func (i *IncidentNotifier) fire(n *ErrorNotification) error {
+	if i.links != nil && n.Incident.State == INCIDENT_OPEN {
+		n.AckURL = i.links.Link(n.Incident.Id)
+	}
+	return i.notifier.Fire(n)
+}
+
+// Watch checks the active incidents every interval. Acknowledged incidents are notified once and incidents that have been
+// quiet for the quiet period are resolved
+func (i *IncidentNotifier) Watch(interval time.Duration) {
+	go func() {
+		for range time.Tick(interval) {
+			i.check(time.Now())
+		}
+	}()
+}
+
+func (i *IncidentNotifier) check(now time.Time) {
+	i.lock.Lock()
+	defer i.lock.Unlock()
+	for _, incident := range i.store.FetchActiveIncidents() {
+		if incident.State == INCIDENT_ACKNOWLEDGED && incident.AckNotifiedAt == nil {
+			// a failed acknowledged notification is sent again on the next check
+			if i.notify(NOTIFY_ACKNOWLEDGED, incident) == nil {
+				if err := i.store.MarkAckNotified(incident); err != nil {
+					log.Printf("Failed marking the acknowledgement of Incident #%v notified: %v\n", incident.Id, err)
+				}
+			}
+		}
+		if !incident.isQuiet(now, i.quietPeriod) {
+			i.update(incident)
+			continue
+		}
+		if err := i.store.Resolve(incident); err != nil {
+			log.Printf("Failed resolving Incident #%v: %v\n", incident.Id, err)
+			continue
+		}
+		log.Printf("Resolved Incident #%v for [%v] after %v of quiet\n", incident.Id, incident.Exception, i.quietPeriod)
+		delete(i.lastUpdate, incident.Id)
+		i.notify(NOTIFY_RESOLVED, incident)
+	}
+}
+
+// update notifies an incident that counted events since its last notification as ongoing, at most every updateInterval
+func (i *IncidentNotifier) update(incident *Incident) {
+	last, ok := i.lastUpdate[incident.Id]
+	if !ok {
+		i.lastUpdate[incident.Id] = incident.UpdatedAt
+		return
+	}
+	if incident.UpdatedAt.Sub(last) < i.updateInterval {
+		return
+	}
+	if err := i.fire(&ErrorNotification{ErrorEvent: incident.event(), Kind: NOTIFY_ONGOING, Incident: incident}); err != nil {
+		log.Printf("Failed sending %v notification for Incident #%v: %v\n", NOTIFY_ONGOING, incident.Id, err)
+		return
+	}
+	i.lastUpdate[incident.Id] = incident.UpdatedAt
+}
+
+func (i *IncidentNotifier) notify(kind NotificationKind, incident *Incident) error {
+	n := &ErrorNotification{ErrorEvent: incident.event(), Kind: kind, Incident: incident}
+	err := i.notifier.Fire(n)
+	if err != nil {
+		log.Printf("Failed sending %v notification for Incident #%v: %v\n", kind, incident.Id, err)
+	}
+	return err
+}
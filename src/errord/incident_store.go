@@ -0,0 +1,123 @@
+package errord
+
+import (
+	"database/sql"
+	"log"
+	"time"
+)
+
+type IncidentStore interface {
+	Open(e *ErrorEvent) (*Incident, error)
+	GetIncident(id int) *Incident
+	GetActiveIncident(fingerprint string) *Incident
+	FetchActiveIncidents() []*Incident
+	FetchIncidents(since time.Time) []*Incident
+	Touch(i *Incident) error
+	Acknowledge(id int) error
+	MarkAckNotified(i *Incident) error
+	Resolve(i *Incident) error
+}
+
+type incidentStore struct {
+	db *sql.DB
+}
+
+const incidentColumns string = `id, exception, fingerprint, source, state, opened_at, updated_at, acknowledged_at, ack_notified_at, resolved_at, count`
+
+func (store *incidentStore) Open(e *ErrorEvent) (*Incident, error) {
+	now := time.Now()
+	i := &Incident{Exception: e.Exception, Fingerprint: e.Fingerprint(), Source: e.Source, State: INCIDENT_OPEN, OpenedAt: now, UpdatedAt: now, Count: 1}
+	r, err := store.db.Exec(`insert into incidents(exception, fingerprint, source, state, opened_at, updated_at, count) values (?, ?, ?, ?, ?, ?, ?)`,
+		i.Exception, i.Fingerprint, i.Source, string(i.State), i.OpenedAt, i.UpdatedAt, i.Count)
+	if err != nil {
+		return nil, err
+	}
+	id, err := r.LastInsertId()
+	i.Id = int(id)
+	return i, err
+}
+
+func (store *incidentStore) GetIncident(id int) *Incident {
+	return scanIncident(store.db.QueryRow(`select `+incidentColumns+` from incidents where id = ?`, id))
+}
+
+func (store *incidentStore) GetActiveIncident(fingerprint string) *Incident {
+	return scanIncident(store.db.QueryRow(`select `+incidentColumns+` from incidents where fingerprint = ? and state != ? order by opened_at desc limit 1`,
+		fingerprint, string(INCIDENT_RESOLVED)))
+}
+
+func (store *incidentStore) FetchActiveIncidents() []*Incident {
+	return store.fetch(`select `+incidentColumns+` from incidents where state != ? order by opened_at`, string(INCIDENT_RESOLVED))
+}
+
+func (store *incidentStore) FetchIncidents(since time.Time) []*Incident {
+	return store.fetch(`select `+incidentColumns+` from incidents where updated_at >= ? order by opened_at`, since)
+}
+
+func (store *incidentStore) fetch(query string, args ...interface{}) []*Incident {
+	var incidents []*Incident
+	rows, err := store.db.Query(query, args...)
+	if err != nil {
+		log.Printf("Failed fetching Incidents: %v\n", err)
+		return incidents
+	}
+	defer rows.Close()
+	for rows.Next() {
+		if i := scanIncident(rows); i != nil {
+			incidents = append(incidents, i)
+		}
+	}
+	return incidents
+}
+
+func (store *incidentStore) Touch(i *Incident) error {
+	i.Count++
+	i.UpdatedAt = time.Now()
+	_, err := store.db.Exec(`update incidents set count = ?, updated_at = ? where id = ?`, i.Count, i.UpdatedAt, i.Id)
+	return err
+}
+
+func (store *incidentStore) Acknowledge(id int) error {
+	r, err := store.db.Exec(`update incidents set state = ?, acknowledged_at = ? where id = ? and state = ?`,
+		string(INCIDENT_ACKNOWLEDGED), time.Now(), id, string(INCIDENT_OPEN))
+	if err != nil {
+		return err
+	}
+	if count, _ := r.RowsAffected(); count == 0 {
+		return ErrIncidentNotOpen
+	}
+	return nil
+}
+
+func (store *incidentStore) MarkAckNotified(i *Incident) error {
+	now := time.Now()
+	i.AckNotifiedAt = &now
+	_, err := store.db.Exec(`update incidents set ack_notified_at = ? where id = ?`, i.AckNotifiedAt, i.Id)
+	return err
+}
+
+func (store *incidentStore) Resolve(i *Incident) error {
+	now := time.Now()
+	i.State = INCIDENT_RESOLVED
+	i.ResolvedAt = &now
+	_, err := store.db.Exec(`update incidents set state = ?, resolved_at = ? where id = ?`, string(i.State), i.ResolvedAt, i.Id)
+	return err
+}
+
+type scanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanIncident(row scanner) *Incident {
+	i := new(Incident)
+	var state string
+	err := row.Scan(&i.Id, &i.Exception, &i.Fingerprint, &i.Source, &state, &i.OpenedAt, &i.UpdatedAt, &i.AcknowledgedAt, &i.AckNotifiedAt, &i.ResolvedAt, &i.Count)
+	if err == sql.ErrNoRows {
+		return nil
+	} else if err != nil {
+		log.Printf("Failed mapping Incident: %v\n", err)
+		return nil
+	}
+	i.State = IncidentState(state)
+	return i
+}
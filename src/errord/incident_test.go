@@ -0,0 +1,170 @@
+package errord
+
+import (
+	"testing"
+	"time"
+)
+
+type memIncidentStore struct {
+	incidents []*Incident
+}
+
+func (s *memIncidentStore) Open(e *ErrorEvent) (*Incident, error) {
+	i := &Incident{Id: len(s.incidents) + 1, Exception: e.Exception, Fingerprint: e.Fingerprint(), State: INCIDENT_OPEN, OpenedAt: time.Now(), UpdatedAt: time.Now(), Count: 1}
+	s.incidents = append(s.incidents, i)
+	return i, nil
+}
+
+func (s *memIncidentStore) GetIncident(id int) *Incident {
+	return s.incidents[id-1]
+}
+
+func (s *memIncidentStore) GetActiveIncident(fingerprint string) *Incident {
+	for _, i := range s.incidents {
+		if i.Fingerprint == fingerprint && i.State != INCIDENT_RESOLVED {
+			return i
+		}
+	}
+	return nil
+}
+
+func (s *memIncidentStore) FetchActiveIncidents() []*Incident {
+	active := []*Incident{}
+	for _, i := range s.incidents {
+		if i.State != INCIDENT_RESOLVED {
+			active = append(active, i)
+		}
+	}
+	return active
+}
+
+func (s *memIncidentStore) FetchIncidents(since time.Time) []*Incident {
+	return s.incidents
+}
+
+func (s *memIncidentStore) Touch(i *Incident) error {
+	i.Count++
+	i.UpdatedAt = time.Now()
+	return nil
+}
+
+func (s *memIncidentStore) Acknowledge(id int) error {
+	s.incidents[id-1].State = INCIDENT_ACKNOWLEDGED
+	return nil
+}
+
+func (s *memIncidentStore) MarkAckNotified(i *Incident) error {
+	now := time.Now()
+	i.AckNotifiedAt = &now
+	return nil
+}
+
+func (s *memIncidentStore) Resolve(i *Incident) error {
+	now := time.Now()
+	i.State = INCIDENT_RESOLVED
+	i.ResolvedAt = &now
+	return nil
+}
+
+type recordingNotifier struct {
+	fired []*ErrorNotification
+}
+
+func (r *recordingNotifier) Fire(n *ErrorNotification) error {
+	r.fired = append(r.fired, n)
+	return nil
+}
+
+func TestIncidentNotifierLifecycle(t *testing.T) {
+	store := &memIncidentStore{}
+	recorder := &recordingNotifier{}
+	notifier := NewIncidentNotifier(recorder, store, 30*time.Minute, time.Hour, nil)
+	event := newErrorEvent("SQLException", newTime(2016, 3, 31, 12, 0, 0))
+
+	notifier.Fire(&ErrorNotification{ErrorEvent: &event})
+	if len(recorder.fired) != 1 || recorder.fired[0].Kind != NOTIFY_OPENED {
+		t.Fatalf("First notification should open an incident and be passed on")
+	}
+
+	notifier.Fire(&ErrorNotification{ErrorEvent: &event})
+	if len(recorder.fired) != 1 {
+		t.Errorf("Notifications while the incident is open should only update the incident")
+	}
+	if store.incidents[0].Count != 1 {
+		t.Errorf("Notifications should not count on the incident, the stat engine counts its events. Got %v", store.incidents[0].Count)
+	}
+
+	notifier.check(time.Now())
+	if len(recorder.fired) != 1 || store.incidents[0].State != INCIDENT_OPEN {
+		t.Errorf("Incident should not be resolved before the quiet period has passed")
+	}
+
+	store.Acknowledge(1)
+	notifier.check(time.Now())
+	if len(recorder.fired) != 2 || recorder.fired[1].Kind != NOTIFY_ACKNOWLEDGED {
+		t.Errorf("Acknowledged incident should be notified")
+	}
+	notifier.check(time.Now())
+	if len(recorder.fired) != 2 {
+		t.Errorf("Acknowledged incident should only be notified once. Got %v notifications", len(recorder.fired))
+	}
+
+	notifier.check(time.Now().Add(time.Hour))
+	last := recorder.fired[len(recorder.fired)-1]
+	if last.Kind != NOTIFY_RESOLVED || store.incidents[0].State != INCIDENT_RESOLVED {
+		t.Errorf("Incident should be resolved after the quiet period. Got [%v] [%v]", last.Kind, store.incidents[0].State)
+	}
+
+	notifier.Fire(&ErrorNotification{ErrorEvent: &event})
+	last = recorder.fired[len(recorder.fired)-1]
+	if len(store.incidents) != 2 || last.Kind != NOTIFY_OPENED {
+		t.Errorf("Notification after an incident was resolved should open a new incident")
+	}
+}
+
+func TestIncidentCountsEventsAndIsUpdated(t *testing.T) {
+	store := &memIncidentStore{}
+	recorder := &recordingNotifier{}
+	notifier := NewIncidentNotifier(recorder, store, 30*time.Minute, time.Hour, nil)
+	engine := &statEngine{incidents: store}
+	event := newErrorEvent("SQLException", newTime(2016, 3, 31, 12, 0, 0))
+	if engine.countOnIncident(&event) != nil {
+		t.Errorf("Event without an incident should not be counted")
+	}
+	notifier.Fire(&ErrorNotification{ErrorEvent: &event})
+	for n := 0; n < 4; n++ {
+		if incident := engine.countOnIncident(&event); incident == nil || incident.Id != 1 {
+			t.Fatalf("Event should be counted on the open incident of its fingerprint")
+		}
+	}
+	incident := store.incidents[0]
+	if incident.Count != 5 {
+		t.Errorf("Incident should count every event. Got %v", incident.Count)
+	}
+
+	incident.UpdatedAt = incident.OpenedAt.Add(30 * time.Minute)
+	notifier.check(incident.UpdatedAt)
+	if len(recorder.fired) != 1 {
+		t.Errorf("Incident should not be updated before the update interval")
+	}
+	incident.UpdatedAt = incident.OpenedAt.Add(70 * time.Minute)
+	notifier.check(incident.UpdatedAt)
+	notifier.check(incident.UpdatedAt)
+	if len(recorder.fired) != 2 || recorder.fired[1].Kind != NOTIFY_ONGOING || recorder.fired[1].Incident.Count != 5 {
+		t.Errorf("Incident that counted events should be notified as ongoing once per update interval. Got %v notifications", len(recorder.fired))
+	}
+}
+
+func TestIncidentNotificationKeys(t *testing.T) {
+	event := newErrorEvent("SQLException", newTime(2016, 3, 31, 12, 0, 0))
+	incident := &Incident{Id: 3, Count: 10}
+	if key := (&ErrorNotification{ErrorEvent: &event}).key(); key != "SQLException" {
+		t.Errorf("Detected notifications should be keyed on the exception. Got %v", key)
+	}
+	if key := (&ErrorNotification{ErrorEvent: &event, Kind: NOTIFY_RESOLVED, Incident: incident}).key(); key != "resolved:3" {
+		t.Errorf("Incident notifications should be keyed on the kind and incident. Got %v", key)
+	}
+	if key := (&ErrorNotification{ErrorEvent: &event, Kind: NOTIFY_ONGOING, Incident: incident}).key(); key != "ongoing:3:10" {
+		t.Errorf("Ongoing notifications should be keyed on the rolling count. Got %v", key)
+	}
+}
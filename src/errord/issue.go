@@ -0,0 +1,85 @@
+package errord
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"regexp"
+	"time"
+)
+
+type IssueStatus string
+
+const ISSUE_UNRESOLVED IssueStatus = "unresolved"
+const ISSUE_RESOLVED IssueStatus = "resolved"
+const ISSUE_IGNORED IssueStatus = "ignored"
+const ISSUE_MUTED IssueStatus = "muted"
+
+var ErrUnknownIssueStatus error = errors.New("Issue status must be one of 'unresolved', 'resolved', 'ignored' or 'muted'")
+var ErrIssueNotFound error = errors.New("No issue found with the given fingerprint")
+
+var QUOTED_REGEX = regexp.MustCompile(`'[^']*'|"[^"]*"`)
+var NUMBER_REGEX = regexp.MustCompile(`\d+`)
+
+// An Issue is every occurrence of an exception with the same fingerprint
+type Issue struct {
+	Fingerprint string
+	Exception   string
+	Detail      string
+	FirstSeen   time.Time
+	LastSeen    time.Time
+	Count       int
+	Status      IssueStatus
+	MutedUntil  *time.Time
+	ResolvedAt  *time.Time
+}
+
+/*
+Fingerprint identifies an exception regardless of the values in its detail. Quoted values and numbers are removed from the
+detail so that "denied to user 'app'@'10.0.1.231'" and "denied to user 'batch'@'10.0.1.12'" have the same fingerprint
+*/
+func (e *ErrorEvent) Fingerprint() string {
+	hash := sha1.Sum([]byte(e.Exception + "|" + normalizeDetail(e.Detail)))
+	return hex.EncodeToString(hash[:])[:12]
+}
+
+func normalizeDetail(detail string) string {
+	detail = QUOTED_REGEX.ReplaceAllString(detail, "?")
+	return NUMBER_REGEX.ReplaceAllString(detail, "#")
+}
+
+// isSilenced is true when notifications for the issue should not be sent
+func (i *Issue) isSilenced(now time.Time) bool {
+	switch i.Status {
+	case ISSUE_IGNORED:
+		return true
+	case ISSUE_MUTED:
+		return i.MutedUntil != nil && now.Before(*i.MutedUntil)
+	}
+	return false
+}
+
+// isRegression is true when the event happened after the issue was resolved
+func (i *Issue) isRegression(e *ErrorEvent) bool {
+	if i.Status != ISSUE_RESOLVED || i.ResolvedAt == nil {
+		return false
+	}
+	return e.Timestamp != nil && e.Timestamp.After(*i.ResolvedAt)
+}
+
+func (i *Issue) describe() string {
+	description := fmt.Sprintf("Issue = %v\nFirst seen = %v\nLast seen = %v\nSeen = %v times\n", i.Fingerprint, i.FirstSeen, i.LastSeen, i.Count)
+	if i.ResolvedAt != nil {
+		description += fmt.Sprintf("Resolved at = %v\n", *i.ResolvedAt)
+	}
+	return description
+}
+
+func (s IssueStatus) isValid() bool {
+	switch s {
+	case ISSUE_UNRESOLVED, ISSUE_RESOLVED, ISSUE_IGNORED, ISSUE_MUTED:
+		return true
+	}
+	return false
+}
@@ -0,0 +1,143 @@
+package errord
+
+import (
+	"database/sql"
+	"log"
+	"time"
+)
+
+type IssueStore interface {
+	Track(e *ErrorEvent) (issue *Issue, regressed bool, err error)
+	GetIssue(fingerprint string) *Issue
+	FetchIssues() []*Issue
+	SetStatus(fingerprint string, status IssueStatus, mutedUntil *time.Time) error
+	Rebuild() error
+}
+
+type issueStore struct {
+	db *sql.DB
+}
+
+const issueColumns string = `fingerprint, exception, detail, first_seen, last_seen, count, status, muted_until, resolved_at`
+
+// Track adds the event to its issue. When the issue was resolved before the event happened it is a regression and the issue is unresolved again
+func (store *issueStore) Track(e *ErrorEvent) (*Issue, bool, error) {
+	fingerprint := e.Fingerprint()
+	issue := store.GetIssue(fingerprint)
+	if issue == nil {
+		issue = &Issue{fingerprint, e.Exception, normalizeDetail(e.Detail), *e.Timestamp, *e.Timestamp, 1, ISSUE_UNRESOLVED, nil, nil}
+		_, err := store.db.Exec(`insert into issues(fingerprint, exception, detail, first_seen, last_seen, count, status) values (?, ?, ?, ?, ?, ?, ?)`,
+			issue.Fingerprint, issue.Exception, issue.Detail, issue.FirstSeen, issue.LastSeen, issue.Count, string(issue.Status))
+		return issue, false, err
+	}
+	regressed := issue.isRegression(e)
+	if regressed {
+		log.Printf("Issue [%v] %v was resolved at %v and has regressed\n", issue.Fingerprint, issue.Exception, issue.ResolvedAt)
+		issue.Status = ISSUE_UNRESOLVED
+	}
+	issue.Count++
+	if e.Timestamp.After(issue.LastSeen) {
+		issue.LastSeen = *e.Timestamp
+	}
+	_, err := store.db.Exec(`update issues set last_seen = ?, count = ?, status = ? where fingerprint = ?`,
+		issue.LastSeen, issue.Count, string(issue.Status), issue.Fingerprint)
+	return issue, regressed, err
+}
+
+func (store *issueStore) GetIssue(fingerprint string) *Issue {
+	return scanIssue(store.db.QueryRow(`select `+issueColumns+` from issues where fingerprint = ?`, fingerprint))
+}
+
+func (store *issueStore) FetchIssues() []*Issue {
+	var issues []*Issue
+	rows, err := store.db.Query(`select ` + issueColumns + ` from issues order by last_seen desc`)
+	if err != nil {
+		log.Printf("Failed fetching Issues: %v\n", err)
+		return issues
+	}
+	defer rows.Close()
+	for rows.Next() {
+		if i := scanIssue(rows); i != nil {
+			issues = append(issues, i)
+		}
+	}
+	return issues
+}
+
+func (store *issueStore) SetStatus(fingerprint string, status IssueStatus, mutedUntil *time.Time) error {
+	if !status.isValid() {
+		return ErrUnknownIssueStatus
+	}
+	var resolvedAt *time.Time
+	if status == ISSUE_RESOLVED {
+		now := time.Now()
+		resolvedAt = &now
+	}
+	r, err := store.db.Exec(`update issues set status = ?, muted_until = ?, resolved_at = coalesce(?, resolved_at) where fingerprint = ?`,
+		string(status), mutedUntil, resolvedAt, fingerprint)
+	if err != nil {
+		return err
+	}
+	if count, _ := r.RowsAffected(); count == 0 {
+		return ErrIssueNotFound
+	}
+	return nil
+}
+
+// Rebuild recalculates first seen, last seen and count of every issue from error_events. The status of existing issues is kept
+func (store *issueStore) Rebuild() error {
+	rows, err := store.db.Query(`select event_datetime, exception, excp_description from error_events`)
+	if err != nil {
+		return err
+	}
+	issues := make(map[string]*Issue)
+	for rows.Next() {
+		var e ErrorEvent
+		var timestamp time.Time
+		if err := rows.Scan(&timestamp, &e.Exception, &e.Detail); err != nil {
+			log.Printf("Failed mapping Error Event: %v\n", err)
+			continue
+		}
+		fingerprint := e.Fingerprint()
+		issue, ok := issues[fingerprint]
+		if !ok {
+			issues[fingerprint] = &Issue{fingerprint, e.Exception, normalizeDetail(e.Detail), timestamp, timestamp, 1, ISSUE_UNRESOLVED, nil, nil}
+			continue
+		}
+		issue.Count++
+		if timestamp.Before(issue.FirstSeen) {
+			issue.FirstSeen = timestamp
+		}
+		if timestamp.After(issue.LastSeen) {
+			issue.LastSeen = timestamp
+		}
+	}
+	rows.Close()
+	for _, i := range issues {
+		_, err := store.db.Exec(`insert or ignore into issues(fingerprint, exception, detail, first_seen, last_seen, count, status) values (?, ?, ?, ?, ?, ?, ?)`,
+			i.Fingerprint, i.Exception, i.Detail, i.FirstSeen, i.LastSeen, i.Count, string(i.Status))
+		if err != nil {
+			return err
+		}
+		_, err = store.db.Exec(`update issues set first_seen = ?, last_seen = ?, count = ? where fingerprint = ?`, i.FirstSeen, i.LastSeen, i.Count, i.Fingerprint)
+		if err != nil {
+			return err
+		}
+	}
+	log.Printf("Rebuilt %v Issues from Error Events\n", len(issues))
+	return nil
+}
+
+func scanIssue(row scanner) *Issue {
+	i := new(Issue)
+	var status string
+	err := row.Scan(&i.Fingerprint, &i.Exception, &i.Detail, &i.FirstSeen, &i.LastSeen, &i.Count, &status, &i.MutedUntil, &i.ResolvedAt)
+	if err == sql.ErrNoRows {
+		return nil
+	} else if err != nil {
+		log.Printf("Failed mapping Issue: %v\n", err)
+		return nil
+	}
+	i.Status = IssueStatus(status)
+	return i
+}
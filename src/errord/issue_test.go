@@ -0,0 +1,62 @@
+package errord
+
+import (
+	"testing"
+	"time"
+)
+
+func TestFingerprintIgnoresValuesInDetail(t *testing.T) {
+	first := ErrorEvent{Exception: "com.mysql.jdbc.exceptions.jdbc4.MySQLSyntaxErrorException", Detail: "UPDATE command denied to user 'fsi_app'@'10.0.1.231' for table 'recharge_provider_setting'"}
+	second := ErrorEvent{Exception: "com.mysql.jdbc.exceptions.jdbc4.MySQLSyntaxErrorException", Detail: "UPDATE command denied to user 'batch'@'10.0.1.12' for table 'dealer'"}
+	if first.Fingerprint() != second.Fingerprint() {
+		t.Errorf("Events that only differ in quoted values should have the same fingerprint")
+	}
+
+	other := ErrorEvent{Exception: "com.mysql.jdbc.exceptions.jdbc4.MySQLSyntaxErrorException", Detail: "SELECT command denied to user 'batch'@'10.0.1.12' for table 'dealer'"}
+	if first.Fingerprint() == other.Fingerprint() {
+		t.Errorf("Events with different details should have different fingerprints")
+	}
+
+	excp := ErrorEvent{Exception: "java.sql.SQLException", Detail: first.Detail}
+	if first.Fingerprint() == excp.Fingerprint() {
+		t.Errorf("Events with different exceptions should have different fingerprints")
+	}
+}
+
+func TestIssueIsSilenced(t *testing.T) {
+	now := time.Now()
+	issue := &Issue{Status: ISSUE_UNRESOLVED}
+	if issue.isSilenced(now) {
+		t.Errorf("Unresolved issue should not be silenced")
+	}
+	issue.Status = ISSUE_IGNORED
+	if !issue.isSilenced(now) {
+		t.Errorf("Ignored issue should be silenced")
+	}
+	later := now.Add(time.Hour)
+	issue.Status = ISSUE_MUTED
+	issue.MutedUntil = &later
+	if !issue.isSilenced(now) {
+		t.Errorf("Muted issue should be silenced until it is unmuted")
+	}
+	if issue.isSilenced(later.Add(time.Second)) {
+		t.Errorf("Muted issue should not be silenced after it is unmuted")
+	}
+}
+
+func TestIssueIsRegression(t *testing.T) {
+	resolvedAt := newTime(2016, 3, 31, 12, 0, 0)
+	issue := &Issue{Status: ISSUE_RESOLVED, ResolvedAt: resolvedAt}
+	before := newErrorEvent("SQLException", newTime(2016, 3, 31, 11, 0, 0))
+	after := newErrorEvent("SQLException", newTime(2016, 3, 31, 13, 0, 0))
+	if issue.isRegression(&before) {
+		t.Errorf("Event from before the issue was resolved is not a regression")
+	}
+	if !issue.isRegression(&after) {
+		t.Errorf("Event from after the issue was resolved is a regression")
+	}
+	issue.Status = ISSUE_UNRESOLVED
+	if issue.isRegression(&after) {
+		t.Errorf("Unresolved issue cannot regress")
+	}
+}
@@ -0,0 +1,242 @@
+package errord
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"log"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const METRIC_COUNTER string = "counter"
+const METRIC_GAUGE string = "gauge"
+const METRIC_HISTOGRAM string = "histogram"
+
+var LATENCY_BUCKETS = []float64{0.001, 0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5}
+
+// METRICS are the metrics errord exposes on /metrics of the HTTP API
+var METRICS = newErrordMetrics()
+
+func newErrordMetrics() *Metrics {
+	m := NewMetrics()
+	m.Counter("errord_events_total", "Error events ingested by exception, source and level")
+	m.Counter("errord_lines_total", "Log lines read")
+	m.Counter("errord_lines_failed_total", "Log lines that are not log lines or caused by lines")
+	m.Counter("errord_events_stored_total", "Error events written to the database")
+	m.Gauge("errord_tail_lag_bytes", "Bytes of the tailed file that have not been read yet")
+	m.Histogram("errord_db_write_duration_seconds", "Time taken to write to the database by table", LATENCY_BUCKETS)
+	m.Counter("errord_notifications_total", "Notifications sent by notifier and result")
+	m.Gauge("errord_exception_day_total", "Times the exception was seen today")
+	m.Gauge("errord_exception_threshold", "Day total above which the exception is notified")
+	m.Counter("errord_bus_dropped_total", "Events the event bus dropped because the subscriber was behind")
+	m.Gauge("errord_bus_queue_length", "Events buffered for the subscriber of the event bus")
+	return m
+}
+
+/*
+Metrics is a registry of counters, gauges and histograms that is written in the Prometheus text exposition format. Samples are
+identified by their label values, which are given as name, value pairs
+*/
+type Metrics struct {
+	families map[string]*metricFamily
+	lock     sync.Mutex
+}
+
+type metricFamily struct {
+	name    string
+	help    string
+	kind    string
+	buckets []float64
+	samples map[string]*metricSample
+}
+
+type metricSample struct {
+	labels string
+	value  float64
+	counts []uint64
+	sum    float64
+	count  uint64
+}
+
+func NewMetrics() *Metrics {
+	return &Metrics{families: make(map[string]*metricFamily)}
+}
+
+func (m *Metrics) Counter(name, help string) {
+	m.register(name, help, METRIC_COUNTER, nil)
+}
+
+func (m *Metrics) Gauge(name, help string) {
+	m.register(name, help, METRIC_GAUGE, nil)
+}
+
+func (m *Metrics) Histogram(name, help string, buckets []float64) {
+	m.register(name, help, METRIC_HISTOGRAM, buckets)
+}
+
+func (m *Metrics) register(name, help, kind string, buckets []float64) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	m.families[name] = &metricFamily{name, help, kind, buckets, make(map[string]*metricSample)}
+}
+
+// Add adds to a counter or gauge
+func (m *Metrics) Add(name string, value float64, labels ...string) {
+	m.update(name, labels, func(s *metricSample) { s.value += value })
+}
+
+// Set sets a gauge
+func (m *Metrics) Set(name string, value float64, labels ...string) {
+	m.update(name, labels, func(s *metricSample) { s.value = value })
+}
+
+// Observe adds an observation to a histogram
+func (m *Metrics) Observe(name string, value float64, labels ...string) {
+	m.update(name, labels, func(s *metricSample) {
+		f := m.families[name]
+		if s.counts == nil {
+			s.counts = make([]uint64, len(f.buckets))
+		}
+		for i, bound := range f.buckets {
+			if value <= bound {
+				s.counts[i]++
+			}
+		}
+		s.sum += value
+		s.count++
+	})
+}
+
+// Since observes the time since start in seconds
+func (m *Metrics) Since(name string, start time.Time, labels ...string) {
+	m.Observe(name, time.Since(start).Seconds(), labels...)
+}
+
+func (m *Metrics) update(name string, labels []string, update func(s *metricSample)) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	f, ok := m.families[name]
+	if !ok {
+		log.Printf("Unknown metric: %v\n", name)
+		return
+	}
+	key := formatLabels(labels)
+	s, ok := f.samples[key]
+	if !ok {
+		s = &metricSample{labels: key}
+		f.samples[key] = s
+	}
+	update(s)
+}
+
+// formatLabels formats the label pairs as {name="value",...} with the values escaped
+func formatLabels(labels []string) string {
+	if len(labels) < 2 {
+		return ""
+	}
+	pairs := []string{}
+	for i := 0; i+1 < len(labels); i += 2 {
+		value := strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(labels[i+1])
+		pairs = append(pairs, fmt.Sprintf(`%v="%v"`, labels[i], value))
+	}
+	return "{" + strings.Join(pairs, ",") + "}"
+}
+
+// WriteTo writes the metrics in the Prometheus text exposition format, sorted by name and labels
+func (m *Metrics) WriteTo(w io.Writer) (int64, error) {
+	m.lock.Lock()
+	var b bytes.Buffer
+	names := []string{}
+	for name := range m.families {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		f := m.families[name]
+		fmt.Fprintf(&b, "# HELP %v %v\n# TYPE %v %v\n", f.name, f.help, f.name, f.kind)
+		keys := []string{}
+		for key := range f.samples {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			f.write(&b, f.samples[key])
+		}
+	}
+	m.lock.Unlock()
+	return b.WriteTo(w)
+}
+
+func (f *metricFamily) write(b *bytes.Buffer, s *metricSample) {
+	if f.kind != METRIC_HISTOGRAM {
+		fmt.Fprintf(b, "%v%v %v\n", f.name, s.labels, formatValue(s.value))
+		return
+	}
+	// the le label is added to the labels of the sample
+	labels := strings.TrimSuffix(strings.TrimPrefix(s.labels, "{"), "}")
+	if labels != "" {
+		labels += ","
+	}
+	for i, bound := range f.buckets {
+		fmt.Fprintf(b, "%v_bucket{%vle=\"%v\"} %v\n", f.name, labels, formatValue(bound), s.counts[i])
+	}
+	fmt.Fprintf(b, "%v_bucket{%vle=\"+Inf\"} %v\n", f.name, labels, s.count)
+	fmt.Fprintf(b, "%v_sum%v %v\n", f.name, s.labels, formatValue(s.sum))
+	fmt.Fprintf(b, "%v_count%v %v\n", f.name, s.labels, s.count)
+}
+
+func formatValue(v float64) string {
+	if math.IsInf(v, 1) {
+		return "+Inf"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+// CountEvents counts the error events read from the event bus until it is closed
+func (m *Metrics) CountEvents(events chan ErrorEvent) {
+	for e := range events {
+		m.countEvent(&e)
+	}
+}
+
+func (m *Metrics) countEvent(e *ErrorEvent) {
+	m.Add("errord_events_total", 1, "exception", e.Exception, "source", e.Source, "level", string(e.Level))
+}
+
+func (m *Metrics) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	if _, err := m.WriteTo(w); err != nil {
+		log.Printf("Failed writing metrics: %v\n", err)
+	}
+}
+
+// MetricsNotifier counts the notifications the named notifier sent and failed to send
+type MetricsNotifier struct {
+	notifier Notifier
+	name     string
+	metrics  *Metrics
+}
+
+func NewMetricsNotifier(n Notifier, name string, metrics *Metrics) Notifier {
+	m := new(MetricsNotifier)
+	m.notifier = n
+	m.name = name
+	m.metrics = metrics
+	return m
+}
+
+func (m *MetricsNotifier) Fire(n *ErrorNotification) error {
+	err := m.notifier.Fire(n)
+	result := "success"
+	if err != nil {
+		result = "failure"
+	}
+	m.metrics.Add("errord_notifications_total", 1, "notifier", m.name, "result", result)
+	return err
+}
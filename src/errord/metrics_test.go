@@ -0,0 +1,58 @@
+package errord
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestMetricsExpositionFormat(t *testing.T) {
+	m := NewMetrics()
+	m.Counter("errord_events_total", "Error events")
+	m.Gauge("errord_exception_threshold", "Threshold")
+	m.Histogram("errord_db_write_duration_seconds", "Write time", []float64{0.01, 0.1})
+	m.Add("errord_events_total", 1, "exception", "java.sql.SQLException", "level", "ERROR")
+	m.Add("errord_events_total", 2, "exception", "java.sql.SQLException", "level", "ERROR")
+	m.Add("errord_events_total", 1, "exception", `Quoted "detail"`, "level", "ERROR")
+	m.Set("errord_exception_threshold", 12, "exception", "java.sql.SQLException")
+	m.Set("errord_exception_threshold", 14, "exception", "java.sql.SQLException")
+	m.Observe("errord_db_write_duration_seconds", 0.005, "table", "error_events")
+	m.Observe("errord_db_write_duration_seconds", 0.05, "table", "error_events")
+
+	var b bytes.Buffer
+	m.WriteTo(&b)
+	expected := `# HELP errord_db_write_duration_seconds Write time
+# TYPE errord_db_write_duration_seconds histogram
+errord_db_write_duration_seconds_bucket{table="error_events",le="0.01"} 1
+errord_db_write_duration_seconds_bucket{table="error_events",le="0.1"} 2
+errord_db_write_duration_seconds_bucket{table="error_events",le="+Inf"} 2
+errord_db_write_duration_seconds_sum{table="error_events"} 0.055
+errord_db_write_duration_seconds_count{table="error_events"} 2
+# HELP errord_events_total Error events
+# TYPE errord_events_total counter
+errord_events_total{exception="Quoted \"detail\"",level="ERROR"} 1
+errord_events_total{exception="java.sql.SQLException",level="ERROR"} 3
+# HELP errord_exception_threshold Threshold
+# TYPE errord_exception_threshold gauge
+errord_exception_threshold{exception="java.sql.SQLException"} 14
+`
+	if b.String() != expected {
+		t.Errorf("Metrics should be written in the exposition format. Got\n%v", b.String())
+	}
+}
+
+func TestMetricsNotifierCountsResults(t *testing.T) {
+	m := newErrordMetrics()
+	NewMetricsNotifier(&recordingNotifier{}, "slack", m).Fire(newTestNotification())
+	failing := NewMetricsNotifier(&failingNotifier{}, "email", m)
+	if err := failing.Fire(newTestNotification()); err == nil || err.Error() != errors.New("unavailable").Error() {
+		t.Errorf("Error of the notifier should be returned. Got %v", err)
+	}
+	var b bytes.Buffer
+	m.WriteTo(&b)
+	if !strings.Contains(b.String(), `errord_notifications_total{notifier="slack",result="success"} 1`) ||
+		!strings.Contains(b.String(), `errord_notifications_total{notifier="email",result="failure"} 1`) {
+		t.Errorf("Notifications should be counted per notifier and result. Got\n%v", b.String())
+	}
+}
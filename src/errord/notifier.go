@@ -1,14 +1,20 @@
 package errord
 
 import (
-	"database/sql"
 	"fmt"
-	_ "github.com/go-sql-driver/mysql"
 	"log"
-	"net/smtp"
 	"time"
 )
 
+type NotificationKind string
+
+const NOTIFY_DETECTED NotificationKind = ""
+const NOTIFY_OPENED NotificationKind = "opened"
+const NOTIFY_REGRESSION NotificationKind = "regression"
+const NOTIFY_ONGOING NotificationKind = "ongoing"
+const NOTIFY_ACKNOWLEDGED NotificationKind = "acknowledged"
+const NOTIFY_RESOLVED NotificationKind = "resolved"
+
 type Notifier interface {
 	Fire(n *ErrorNotification) error
 }
@@ -17,48 +23,25 @@ type ErrorNotification struct {
 	ErrorEvent *ErrorEvent
 	DaySummary *DaySummary
 	Stats      *StatItem
-}
-
-type EmailNotifier struct {
-	host     string
-	from     string
-	password string
-	to       string
-	store    NotifyStore
+	Sigma      float64
+	Rule       *Rule
+	Related    []*ErrorNotification
+	Kind       NotificationKind
+	Incident   *Incident
+	Issue      *Issue
+	History    []*DaySummary
+	Release    *Release
+	Digest     []*DigestEntry
+	Report     *Report
+	Escalation *Escalation
+	AckURL     string
+	rendered   *Rendered
 }
 
 type ConsoleNotifier struct {
 	store NotifyStore
 }
 
-type DatabaseNotifier struct {
-	host     string
-	username string
-	password string
-	to       string
-	store    NotifyStore
-}
-
-func NewDatabaseNotifier(host, username, password, to string, store NotifyStore) Notifier {
-	n := new(DatabaseNotifier)
-	n.host = host
-	n.username = username
-	n.password = password
-	n.to = to
-	n.store = store
-	return n
-}
-
-func NewEmailNotifier(host, from, pass, to string, store NotifyStore) Notifier {
-	n := new(EmailNotifier)
-	n.host = host
-	n.from = from
-	n.to = to
-	n.password = pass
-	n.store = store
-	return n
-}
-
 func NewConsoleNotifier(store NotifyStore) Notifier {
 	c := new(ConsoleNotifier)
 	c.store = store
@@ -66,71 +49,166 @@ func NewConsoleNotifier(store NotifyStore) Notifier {
 }
 
 func (c *ConsoleNotifier) Fire(n *ErrorNotification) error {
-	if c.store.HasNotification(n.ErrorEvent) {
+	if c.store.HasNotification(n) {
 		log.Printf("Notification already sent for %v\n", n.ErrorEvent)
 		return nil
 	}
 
 	subject, body := n.describe()
 	fmt.Printf("\n*** NOTIFICATION ***\nTime: %v\nSubject: %v\nBody: %v\n\n*** END OF NOTIFICATION ***\n", time.Now(), subject, body)
-	c.store.UpdateNotificationSent(n.ErrorEvent)
+	markSent(c.store, n)
 	return nil
 }
 
-func (n *EmailNotifier) Fire(notification *ErrorNotification) error {
-	if n.store.HasNotification(notification.ErrorEvent) {
-		log.Printf("Notification already sent for %v\n", notification.ErrorEvent)
-		return nil
+// markSent records the notification and all of its related notifications as sent
+func markSent(store NotifyStore, n *ErrorNotification) {
+	store.UpdateNotificationSent(n)
+	for _, r := range n.Related {
+		store.UpdateNotificationSent(r)
 	}
+}
 
-	subject, body := notification.describe()
-	msg := fmt.Sprintf("From: %v\r\nTo: %v\r\nSubject: %v\r\n\r\n%v\r\n", n.from, n.to, subject, body)
-	log.Printf("Sending Notifcation via Email\n")
-	if err := smtp.SendMail(n.host+":587", smtp.PlainAuth("", n.from, n.password, n.host), n.from, []string{n.to}, []byte(msg)); err != nil {
-		log.Printf("Failed sending email -> %v\n", err)
-		return err
-	} else {
-		log.Printf("Notification Sent! Updating Store\n")
-		n.store.UpdateNotificationSent(notification.ErrorEvent)
-		return nil
+// fingerprint is the fingerprint of the incident when there is one since events created from an incident have no detail
+func (n *ErrorNotification) fingerprint() string {
+	if n.Incident != nil && n.Incident.Fingerprint != "" {
+		return n.Incident.Fingerprint
 	}
+	return n.ErrorEvent.Fingerprint()
 }
 
-func (d *DatabaseNotifier) Fire(n *ErrorNotification) error {
-	db, err := sql.Open("mysql", fmt.Sprintf("%v:%v@tcp(%v:3306)/", d.username, d.password, d.host))
-	if err != nil {
-		return err
-	}
-	defer db.Close()
-	err = db.Ping()
-	if err != nil {
-		return err
+// key identifies the notification when checking if it has already been sent
+func (n *ErrorNotification) key() string {
+	switch n.Kind {
+	case NOTIFY_DETECTED:
+		return n.ErrorEvent.Exception
+	case NOTIFY_REGRESSION:
+		if n.Incident == nil {
+			return fmt.Sprintf("%v:%v:%v", n.Kind, n.Issue.Fingerprint, n.Issue.ResolvedAt.Unix())
+		}
+		return fmt.Sprintf("%v:%v", n.Kind, n.Incident.Id)
+	case NOTIFY_ONGOING:
+		return fmt.Sprintf("%v:%v:%v", n.Kind, n.Incident.Id, n.Incident.Count)
+	case NOTIFY_DIGEST:
+		return fmt.Sprintf("%v:%v", n.Kind, n.ErrorEvent.Timestamp.UnixNano())
+	case NOTIFY_REPORT:
+		return fmt.Sprintf("%v:%v:%v", n.Kind, n.Report.Name, n.Report.Until.Unix())
+	case NOTIFY_ESCALATED:
+		return fmt.Sprintf("%v:%v:%v:%v", n.Kind, n.Incident.Id, n.Escalation.Policy, n.Escalation.Step)
+	default:
+		return fmt.Sprintf("%v:%v", n.Kind, n.Incident.Id)
 	}
-	subject, body := n.describe()
+}
 
-	_, err = db.Query("call common.sp_create_email_request(?, ?, ?, ?, ?, ?, ?, ?)", d.to, "", "", subject, body, "N", "test", "")
-	if err != nil {
-		return err
-	}
-	d.store.UpdateNotificationSent(n.ErrorEvent)
-	return nil
+// Subject and Body are exported so that they can be used in templates
+func (n *ErrorNotification) Subject() string {
+	subject, _ := n.describe()
+	return subject
+}
+
+func (n *ErrorNotification) Body() string {
+	_, body := n.describe()
+	return body
 }
 
 func (n *ErrorNotification) isNewError() bool {
-	return n.DaySummary == nil && n.Stats == nil
+	return n.DaySummary == nil && n.Stats == nil && n.Rule == nil
+}
+
+func (n *ErrorNotification) limit() int {
+	if n.Sigma == 0 {
+		return n.Stats.StdDevMax()
+	}
+	return n.Stats.StdDevLimit(n.Sigma)
 }
 
+// describe is the subject and body of the notification, rendered with templates when the notifier has them
 func (n *ErrorNotification) describe() (title string, description string) {
+	if n.rendered != nil {
+		return n.rendered.Subject, n.rendered.Text
+	}
+	subject, body := n.describeKind()
+	if n.AckURL != "" {
+		body += fmt.Sprintf("\nAcknowledge: %v\n", n.AckURL)
+	}
+	return subject, body
+}
+
+func (n *ErrorNotification) describeKind() (title string, description string) {
+	switch n.Kind {
+	case NOTIFY_ONGOING, NOTIFY_ACKNOWLEDGED, NOTIFY_RESOLVED, NOTIFY_ESCALATED:
+		return n.describeIncident()
+	case NOTIFY_DIGEST:
+		return n.describeDigest()
+	case NOTIFY_REPORT:
+		return n.Report.Subject(), n.Report.Text()
+	}
+	subject, body := n.describeEvent()
+	if n.Incident != nil {
+		body += fmt.Sprintf("\nIncident #%v is %v\n", n.Incident.Id, n.Incident.State)
+	}
+	if len(n.Related) == 0 {
+		return subject, body
+	}
+	subject = fmt.Sprintf("%v and %v related exceptions. %v", n.ErrorEvent.Exception, len(n.Related), subject)
+	body = fmt.Sprintf("Probable leading exception: [%v]\n\n%v\n\nRelated exceptions:\n", n.ErrorEvent.Exception, body)
+	for _, r := range n.Related {
+		body += fmt.Sprintf("[%v] : [%v] - [%v]\n", r.ErrorEvent.Timestamp, r.ErrorEvent.Exception, r.ErrorEvent.Detail)
+	}
+	return subject, body
+}
+
+func (n *ErrorNotification) describeEvent() (title string, description string) {
 	subject := ""
 	body := ""
-	if n.isNewError() {
+	if n.Kind == NOTIFY_REGRESSION {
+		err := n.ErrorEvent
+		subject = fmt.Sprintf("Regression: %v", err.Exception)
+		body = fmt.Sprintf("Resolved Error seen again: [%v] : [%v]\nCaused by: [%v] - [%v]\n", err.Timestamp, err.Description, err.Exception, err.Detail)
+		if n.Release != nil {
+			body += fmt.Sprintf("Seen again in release %v of %v\n", n.Release.Version, n.Release.Service)
+		}
+		body += n.Issue.describe()
+		if len(n.History) > 0 {
+			body += "\nHistory:\n"
+			for _, day := range n.History {
+				body += fmt.Sprintf("%v = %v\n", day.Date.Format("2006-01-02"), day.Total)
+			}
+		}
+	} else if n.isNewError() {
 		err := n.ErrorEvent
 		subject = fmt.Sprintf("New Error: %v", err.Exception)
 		body = fmt.Sprintf("New Error Event: [%v] : [%v]\nCaused by: [%v] - [%v]\n", err.Timestamp, err.Description, err.Exception, err.Detail)
+		if n.Release != nil {
+			body += fmt.Sprintf("First seen in release %v of %v\n", n.Release.Version, n.Release.Service)
+		}
+	} else if n.Rule != nil {
+		err := n.ErrorEvent
+		subject = fmt.Sprintf("[%v] matched Rule: %v", err.Exception, n.Rule.describe())
+		body = fmt.Sprintf("Error Event: [%v] : [%v]\nSource: [%v]\nCaused by: [%v] - [%v]\nRule = %v", err.Timestamp, err.Description, err.Source, err.Exception, err.Detail, n.Rule.describe())
 	} else {
 		err := n.ErrorEvent
-		subject = fmt.Sprintf("[%v] exceeds Statistical Limit: %v", err.Exception, n.Stats.StdDevMax())
-		body = fmt.Sprintf("Error Event: [%v] : [%v]\nCaused by: [%v] - [%v]\nSeen today = %v\nMax = %v", err.Timestamp, err.Description, err.Exception, err.Detail, n.DaySummary.Total, n.Stats.StdDevMax())
+		subject = fmt.Sprintf("[%v] exceeds Statistical Limit: %v", err.Exception, n.limit())
+		body = fmt.Sprintf("Error Event: [%v] : [%v]\nCaused by: [%v] - [%v]\nSeen today = %v\nMax = %v", err.Timestamp, err.Description, err.Exception, err.Detail, n.DaySummary.Total, n.limit())
+	}
+	return subject, body
+}
+
+func (n *ErrorNotification) describeIncident() (title string, description string) {
+	i := n.Incident
+	subject := fmt.Sprintf("Incident #%v %v: %v", i.Id, n.Kind, i.Exception)
+	body := fmt.Sprintf("Incident #%v [%v] is %v\nOpened at = %v\nLast seen = %v\nSeen since opened = %v\n", i.Id, i.Exception, i.State, i.OpenedAt, i.UpdatedAt, i.Count)
+	if i.AcknowledgedAt != nil {
+		body += fmt.Sprintf("Acknowledged at = %v\n", *i.AcknowledgedAt)
+	}
+	if i.ResolvedAt != nil {
+		body += fmt.Sprintf("Resolved at = %v\n", *i.ResolvedAt)
+	}
+	if n.Kind == NOTIFY_ESCALATED {
+		body += fmt.Sprintf("Not acknowledged %v after it was opened. Escalated by policy [%v]\n", n.Escalation.After, n.Escalation.Policy)
+	}
+	if n.Kind == NOTIFY_ONGOING {
+		err := n.ErrorEvent
+		body += fmt.Sprintf("\nLatest Error Event: [%v] : [%v]\nCaused by: [%v] - [%v]\n", err.Timestamp, err.Description, err.Exception, err.Detail)
 	}
 	return subject, body
 }
@@ -0,0 +1,359 @@
+package errord
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+const NOTIFIER_CONSOLE string = "console"
+const NOTIFIER_EMAIL string = "email"
+const NOTIFIER_WEBHOOK string = "webhook"
+const NOTIFIER_SLACK string = "slack"
+const NOTIFIER_MATTERMOST string = "mattermost"
+const NOTIFIER_PAGERDUTY string = "pagerduty"
+const NOTIFIER_OPSGENIE string = "opsgenie"
+const NOTIFIER_ALERTMANAGER string = "alertmanager"
+const NOTIFIER_SQL string = "sql"
+
+// NotifierConfig configures any of the notifiers. Type selects the notifier and only the fields of that notifier are used
+type NotifierConfig struct {
+	Type string
+	// Name is how routes refer to the notifier. It defaults to Type
+	Name string
+	// Digest is the window notifications are collected in and sent as one digest. Empty sends every notification on its own
+	Digest string
+
+	// email. To, Cc and Bcc are comma separated lists of addresses and TLS is starttls, tls or none
+	Host     string
+	Port     int
+	TLS      string
+	Username string
+	From     string
+	Pass     string
+	To       string
+	Cc       string
+	Bcc      string
+
+	// webhook
+	URL          string
+	Template     string
+	TemplateFile string
+	Headers      map[string]string
+	Secret       string
+	Timeout      string
+
+	// slack and mattermost. URL and Timeout are shared with webhook. For mattermost the channels are channel ids
+	Token    string
+	Channel  string
+	Channels []ChannelRoute
+
+	// pagerduty and opsgenie. URL and Timeout are shared with webhook. Source defaults to the hostname
+	RoutingKey string
+	Source     string
+
+	// alertmanager. URL and Timeout are shared with webhook and Source is used as the host label
+	Service string
+	Refresh string
+
+	// sql. Driver defaults to mysql. Statement has :name parameters bound from the notification and Params. Timeout is shared with webhook
+	Driver          string
+	DSN             string
+	Statement       string
+	StatementFile   string
+	Params          map[string]string
+	MaxOpenConns    int
+	MaxIdleConns    int
+	ConnMaxLifetime string
+}
+
+/*
+NotificationConfig configures several named notifiers and the routes that pick the notifiers of each notification. Notifications
+that match no route go to the Default notifiers, or to every notifier when Default is empty. Service is matched by the Service of
+the routes and BusinessHours by their Hours
+*/
+type NotificationConfig struct {
+	Service       string
+	BusinessHours *BusinessHours
+	Notifiers     []NotifierConfig
+	Routes        []*Route
+	Default       []string
+	Escalations   []*EscalationPolicy
+	Templates     string
+	templates     *Templates
+}
+
+func ReadNotifierConfig(path string) (NotifierConfig, error) {
+	var config NotifierConfig
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return config, err
+	}
+	err = json.Unmarshal(content, &config)
+	return config, err
+}
+
+// ReadNotificationConfig reads a NotificationConfig. A file with a single notifier config is read as a config with only that notifier
+func ReadNotificationConfig(path string) (NotificationConfig, error) {
+	var config NotificationConfig
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return config, err
+	}
+	if err = json.Unmarshal(content, &config); err != nil {
+		return config, err
+	}
+	if config.templates, err = config.loadTemplates(path); err != nil || len(config.Notifiers) > 0 {
+		return config, err
+	}
+	var single NotifierConfig
+	err = json.Unmarshal(content, &single)
+	config.Notifiers = []NotifierConfig{single}
+	return config, err
+}
+
+// loadTemplates loads the notification templates. The directory is relative to the config file and defaults to templates next to it
+func (c NotificationConfig) loadTemplates(path string) (*Templates, error) {
+	dir := c.Templates
+	if dir == "" {
+		dir = "templates"
+	}
+	if !filepath.IsAbs(dir) {
+		dir = filepath.Join(filepath.Dir(path), dir)
+	}
+	return LoadTemplates(dir)
+}
+
+/*
+NewNotifierFromNotificationConfig creates a Router over the notifiers, or only the notifier when there is one and nothing to route.
+With escalation policies the router starts escalating the incidents that are not acknowledged. When links is not nil notifications
+of open incidents have a link that acknowledges the incident
+*/
+func NewNotifierFromNotificationConfig(c NotificationConfig, s Store, links *AckLinks) (Notifier, error) {
+	if len(c.Notifiers) == 0 {
+		return nil, errors.New("Notification config has no notifiers")
+	}
+	if len(c.Notifiers) == 1 && len(c.Routes) == 0 {
+		c.Notifiers[0].Name = ""
+		return NewNotifierFromConfig(c.Notifiers[0], s, c.templates)
+	}
+	notifiers := make(map[string]Notifier)
+	names := []string{}
+	for _, nc := range c.Notifiers {
+		if nc.Name == "" {
+			nc.Name = nc.Type
+		}
+		if _, ok := notifiers[nc.Name]; ok {
+			return nil, fmt.Errorf("Duplicate notifier name: '%v'", nc.Name)
+		}
+		n, err := NewNotifierFromConfig(nc, s, c.templates)
+		if err != nil {
+			return nil, fmt.Errorf("Failed creating notifier %v: %v", nc.Name, err)
+		}
+		notifiers[nc.Name] = n
+		names = append(names, nc.Name)
+	}
+	defaults := c.Default
+	if len(defaults) == 0 {
+		defaults = names
+	}
+	router, err := NewRouter(notifiers, c.Routes, defaults, c.Service, c.BusinessHours, s.Notifications(), links)
+	if err != nil {
+		return nil, err
+	}
+	if err := router.EnableEscalation(c.Escalations, s.Incidents()); err != nil {
+		return nil, err
+	}
+	return router, nil
+}
+
+/*
+NewNotifierFromConfig creates the notifier. A named notifier records its notifications in its own scope. With templates the
+notifications are rendered with the templates of the notifier name, or of the notifier type when it has no name
+*/
+func NewNotifierFromConfig(c NotifierConfig, s Store, templates *Templates) (Notifier, error) {
+	store := s.ScopedNotifications(c.Name)
+	n, err := newNotifier(c, s, store)
+	if err != nil {
+		return nil, err
+	}
+	name := c.Name
+	if name == "" {
+		name = c.Type
+	}
+	n = NewMetricsNotifier(n, name, METRICS)
+	if templates != nil {
+		n = NewTemplateNotifier(n, templates, name)
+	}
+	if c.Digest == "" {
+		return n, nil
+	}
+	window, err := time.ParseDuration(c.Digest)
+	if err != nil {
+		return nil, err
+	}
+	return NewDigestNotifier(n, window, store, s.Outbox(), "digest:"+name), nil
+}
+
+/*
+NewTestNotifiers creates every notifier of the config on its own, without digests, for sending test notifications. The notifiers
+neither deduplicate nor record what they send. The names are in the order of the config
+*/
+func NewTestNotifiers(c NotificationConfig, s Store) ([]string, map[string]Notifier, error) {
+	store := NewUnrecordedStore(s)
+	names := []string{}
+	notifiers := make(map[string]Notifier)
+	for _, nc := range c.Notifiers {
+		if nc.Name == "" {
+			nc.Name = nc.Type
+		}
+		if _, ok := notifiers[nc.Name]; ok {
+			return nil, nil, fmt.Errorf("Duplicate notifier name: '%v'", nc.Name)
+		}
+		nc.Digest = ""
+		n, err := NewNotifierFromConfig(nc, store, c.templates)
+		if err != nil {
+			return nil, nil, fmt.Errorf("Failed creating notifier %v: %v", nc.Name, err)
+		}
+		names = append(names, nc.Name)
+		notifiers[nc.Name] = n
+	}
+	return names, notifiers, nil
+}
+
+// unrecordedStore is a Store whose notification stores let every notification through without recording it
+type unrecordedStore struct {
+	Store
+}
+
+// NewUnrecordedStore wraps the store so that notifiers created with it neither deduplicate nor record notifications
+func NewUnrecordedStore(s Store) Store {
+	return unrecordedStore{s}
+}
+
+func (s unrecordedStore) Notifications() NotifyStore {
+	return unrecordedNotifyStore{s.Store.Notifications()}
+}
+
+func (s unrecordedStore) ScopedNotifications(scope string) NotifyStore {
+	return unrecordedNotifyStore{s.Store.ScopedNotifications(scope)}
+}
+
+type unrecordedNotifyStore struct {
+	NotifyStore
+}
+
+func (s unrecordedNotifyStore) UpdateNotificationSent(n *ErrorNotification) error {
+	return nil
+}
+
+func (s unrecordedNotifyStore) HasNotification(n *ErrorNotification) bool {
+	return false
+}
+
+func (s unrecordedNotifyStore) Decide(n *ErrorNotification) bool {
+	return true
+}
+
+func newNotifier(c NotifierConfig, s Store, store NotifyStore) (Notifier, error) {
+	switch c.Type {
+	case NOTIFIER_CONSOLE:
+		return NewConsoleNotifier(store), nil
+	case NOTIFIER_EMAIL:
+		return NewEmailNotifier(c.email(), s.Stats(), store)
+	case NOTIFIER_WEBHOOK:
+		payload, err := c.template()
+		if err != nil {
+			return nil, err
+		}
+		timeout, err := c.timeout()
+		if err != nil {
+			return nil, err
+		}
+		return NewWebhookNotifier(c.URL, payload, c.Headers, c.Secret, timeout, store)
+	case NOTIFIER_SLACK, NOTIFIER_MATTERMOST:
+		timeout, err := c.timeout()
+		if err != nil {
+			return nil, err
+		}
+		return NewSlackNotifier(c.Type, c.URL, c.Token, c.Channel, c.Channels, timeout, s.Stats(), store)
+	case NOTIFIER_PAGERDUTY, NOTIFIER_OPSGENIE:
+		if c.Type == NOTIFIER_OPSGENIE && c.URL == "" {
+			return nil, errors.New("Opsgenie notifier requires the URL of the PagerDuty compatible integration")
+		}
+		timeout, err := c.timeout()
+		if err != nil {
+			return nil, err
+		}
+		return NewPagerDutyNotifier(c.URL, c.RoutingKey, c.source(), timeout, store), nil
+	case NOTIFIER_ALERTMANAGER:
+		timeout, err := c.timeout()
+		if err != nil {
+			return nil, err
+		}
+		refresh := time.Minute
+		if c.Refresh != "" {
+			if refresh, err = time.ParseDuration(c.Refresh); err != nil {
+				return nil, err
+			}
+		}
+		return NewAlertmanagerNotifier(c.URL, c.Service, c.source(), timeout, refresh, store), nil
+	case NOTIFIER_SQL:
+		config, err := c.sql()
+		if err != nil {
+			return nil, err
+		}
+		return NewSQLNotifier(config, store)
+	}
+	return nil, fmt.Errorf("Unknown notifier type: '%v'", c.Type)
+}
+
+func (c NotifierConfig) template() (string, error) {
+	if c.TemplateFile == "" {
+		return c.Template, nil
+	}
+	content, err := ioutil.ReadFile(c.TemplateFile)
+	return string(content), err
+}
+
+func (c NotifierConfig) email() EmailConfig {
+	return EmailConfig{Host: c.Host, Port: c.Port, TLS: c.TLS, Username: c.Username, Pass: c.Pass, From: c.From, To: c.To, Cc: c.Cc, Bcc: c.Bcc}
+}
+
+func (c NotifierConfig) sql() (SQLConfig, error) {
+	config := SQLConfig{Driver: c.Driver, DSN: c.DSN, Statement: c.Statement, Params: c.Params, MaxOpenConns: c.MaxOpenConns, MaxIdleConns: c.MaxIdleConns}
+	var err error
+	if c.StatementFile != "" {
+		content, err := ioutil.ReadFile(c.StatementFile)
+		if err != nil {
+			return config, err
+		}
+		config.Statement = string(content)
+	}
+	if config.Timeout, err = c.timeout(); err != nil {
+		return config, err
+	}
+	if c.ConnMaxLifetime != "" {
+		config.ConnMaxLifetime, err = time.ParseDuration(c.ConnMaxLifetime)
+	}
+	return config, err
+}
+
+func (c NotifierConfig) timeout() (time.Duration, error) {
+	if c.Timeout == "" {
+		return 10 * time.Second, nil
+	}
+	return time.ParseDuration(c.Timeout)
+}
+
+func (c NotifierConfig) source() string {
+	if c.Source != "" {
+		return c.Source
+	}
+	host, _ := os.Hostname()
+	return host
+}
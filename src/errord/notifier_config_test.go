@@ -0,0 +1,43 @@
+package errord
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestTestNotifiersSendEveryNotificationWithoutDigest(t *testing.T) {
+	received := map[string]int{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received[r.URL.Path]++
+	}))
+	defer server.Close()
+
+	config := NotificationConfig{Notifiers: []NotifierConfig{
+		{Type: NOTIFIER_WEBHOOK, Name: "ops", URL: server.URL + "/ops", Digest: "1h"},
+		{Type: NOTIFIER_WEBHOOK, URL: server.URL + "/webhook"},
+	}}
+	names, notifiers, err := NewTestNotifiers(config, NewStore())
+	if err != nil {
+		t.Fatalf("Expected the notifiers to be created: %v", err)
+	}
+	if len(names) != 2 || names[0] != "ops" || names[1] != NOTIFIER_WEBHOOK {
+		t.Errorf("Expected the notifiers in the order of the config, got %v", names)
+	}
+	for _, name := range names {
+		// the same notification twice is not deduplicated
+		for i := 0; i < 2; i++ {
+			if err := notifiers[name].Fire(newTestNotification()); err != nil {
+				t.Errorf("Expected %v to send: %v", name, err)
+			}
+		}
+	}
+	if received["/ops"] != 2 || received["/webhook"] != 2 {
+		t.Errorf("Expected every notification to be sent right away, got %v", received)
+	}
+
+	config.Notifiers[1].Name = "ops"
+	if _, _, err := NewTestNotifiers(config, NewStore()); err == nil {
+		t.Errorf("Expected duplicate names to be refused")
+	}
+}
@@ -7,26 +7,140 @@ import (
 )
 
 type NotifyStore interface {
-	UpdateNotificationSent(e *ErrorEvent) error
-	HasNotification(e *ErrorEvent) bool
+	UpdateNotificationSent(n *ErrorNotification) error
+	HasNotification(n *ErrorNotification) bool
+	Decide(n *ErrorNotification) bool
+	FetchNotifications(since time.Time) []*NotificationRecord
+	QueryNotifications(q Query) ([]*NotificationRecord, int, error)
 }
 
+// notifyStore records sent notifications. A scoped store records the notifications of one named notifier separately from the others
 type notifyStore struct {
-	db *sql.DB
+	db     *sql.DB
+	scope  string
+	policy NotifyPolicy
 }
 
-func (s *notifyStore) UpdateNotificationSent(e *ErrorEvent) error {
-	_, err := s.db.Exec("insert into notifications(created_at, subject) values(DATE(?), ?)", time.Now(), e.Exception)
-	return err
+const notificationColumns string = `id, subject, exception, dedup_key, sent_at, severity, decision, reason, decisions`
+
+func (s *notifyStore) UpdateNotificationSent(n *ErrorNotification) error {
+	return s.record(n, DECISION_SENT, "")
+}
+
+// HasNotification is true when the NotifyPolicy decides the notification should not be sent
+func (s *notifyStore) HasNotification(n *ErrorNotification) bool {
+	notify, _ := s.decide(n)
+	return !notify
+}
+
+/*
+Decide is like HasNotification but records the decision and is true when the notification should be sent. Suppress decisions that
+follow each other for a dedup key are counted on one record, so an exception that keeps being seen does not add a row per event
+*/
+func (s *notifyStore) Decide(n *ErrorNotification) bool {
+	notify, reason := s.decide(n)
+	var err error
+	if notify {
+		err = s.record(n, DECISION_NOTIFY, reason)
+	} else {
+		err = s.suppress(n, reason)
+	}
+	if err != nil {
+		log.Printf("Failed recording notification decision for [%v]: %v\n", s.key(n), err)
+	}
+	return notify
 }
 
-func (s *notifyStore) HasNotification(e *ErrorEvent) bool {
-	r := s.db.QueryRow(`select count(*) from notifications where created_at = DATE(?) and subject = ?`, time.Now(), e.Exception)
-	var count int
-	err := r.Scan(&count)
+func (s *notifyStore) FetchNotifications(since time.Time) []*NotificationRecord {
+	rows, err := s.db.Query(`select `+notificationColumns+` from notifications where sent_at >= ? order by id`, since)
 	if err != nil {
+		log.Printf("Failed fetching Notifications: %v\n", err)
+		return []*NotificationRecord{}
+	}
+	return s.scanNotifications(rows)
+}
+
+// QueryNotifications pages the notifications and decisions, newest first
+func (s *notifyStore) QueryNotifications(q Query) ([]*NotificationRecord, int, error) {
+	where, args := q.where("sent_at", "exception")
+	total, err := countRows(s.db, "notifications", where, args)
+	if err != nil {
+		return nil, 0, err
+	}
+	rows, err := s.db.Query(`select `+notificationColumns+` from notifications`+where+` order by sent_at desc, id desc`+q.page(), args...)
+	if err != nil {
+		return nil, 0, err
+	}
+	return s.scanNotifications(rows), total, nil
+}
+
+func (s *notifyStore) scanNotifications(rows *sql.Rows) []*NotificationRecord {
+	records := []*NotificationRecord{}
+	defer rows.Close()
+	for rows.Next() {
+		r := new(NotificationRecord)
+		if err := rows.Scan(&r.Id, &r.Subject, &r.Exception, &r.DedupKey, &r.SentAt, &r.Severity, &r.Decision, &r.Reason, &r.Decisions); err != nil {
+			log.Printf("Failed mapping Notification: %v\n", err)
+			continue
+		}
+		records = append(records, r)
+	}
+	return records
+}
+
+func (s *notifyStore) decide(n *ErrorNotification) (bool, string) {
+	var sent int
+	if err := s.db.QueryRow(`select count(*) from notifications where subject = ? and decision = ?`, s.key(n), DECISION_SENT).Scan(&sent); err != nil {
 		log.Printf("Failed mapping notification count: %v\n", err)
-		return true
+		return false, err.Error()
+	}
+	last := new(NotificationRecord)
+	err := s.db.QueryRow(`select `+notificationColumns+` from notifications where dedup_key = ? and decision = ? order by sent_at desc limit 1`,
+		s.scoped(s.policy.dedupKey(n)), DECISION_SENT).Scan(&last.Id, &last.Subject, &last.Exception, &last.DedupKey, &last.SentAt, &last.Severity, &last.Decision, &last.Reason, &last.Decisions)
+	if err == sql.ErrNoRows {
+		last = nil
+	} else if err != nil {
+		log.Printf("Failed mapping last notification: %v\n", err)
+		return false, err.Error()
+	}
+	return s.policy.decide(n, last, sent > 0, time.Now())
+}
+
+// suppress counts the decision on the suppress record of the dedup key since its last notification, or records it when there is none
+func (s *notifyStore) suppress(n *ErrorNotification, reason string) error {
+	now := time.Now()
+	key := s.scoped(s.policy.dedupKey(n))
+	r, err := s.db.Exec(`update notifications set decisions = decisions + 1, sent_at = ?, reason = ? where id = (select max(id) from notifications
+	where dedup_key = ? and decision = ? and id > coalesce((select max(id) from notifications where dedup_key = ? and decision in (?, ?)), 0))`,
+		now, reason, key, DECISION_SUPPRESS, key, DECISION_SENT, DECISION_NOTIFY)
+	if err != nil {
+		return err
+	}
+	if count, _ := r.RowsAffected(); count > 0 {
+		return nil
+	}
+	return s.record(n, DECISION_SUPPRESS, reason)
+}
+
+func (s *notifyStore) record(n *ErrorNotification, decision, reason string) error {
+	now := time.Now()
+	defer METRICS.Since("errord_db_write_duration_seconds", now, "table", "notifications")
+	exception := ""
+	if n.ErrorEvent != nil {
+		exception = n.ErrorEvent.Exception
+	}
+	_, err := s.db.Exec(`insert into notifications(created_at, subject, exception, dedup_key, sent_at, severity, decision, reason) values(DATE(?), ?, ?, ?, ?, ?, ?, ?)`,
+		now, s.key(n), exception, s.scoped(s.policy.dedupKey(n)), now, n.Severity(), decision, reason)
+	return err
+}
+
+func (s *notifyStore) key(n *ErrorNotification) string {
+	return s.scoped(n.key())
+}
+
+func (s *notifyStore) scoped(key string) string {
+	if s.scope == "" {
+		return key
 	}
-	return count > 0
+	return s.scope + "/" + key
 }
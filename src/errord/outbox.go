@@ -0,0 +1,220 @@
+package errord
+
+import (
+	"fmt"
+	"log"
+	"math/rand"
+	"sync"
+	"time"
+)
+
+type OutboxState string
+
+const OUTBOX_PENDING OutboxState = "pending"
+const OUTBOX_DELIVERED OutboxState = "delivered"
+const OUTBOX_EXPIRED OutboxState = "expired"
+const OUTBOX_HELD OutboxState = "held"
+
+const OUTBOX_MIN_BACKOFF time.Duration = 30 * time.Second
+const OUTBOX_MAX_BACKOFF time.Duration = 30 * time.Minute
+const DEFAULT_OUTBOX_MAX_AGE time.Duration = 24 * time.Hour
+
+// OutboxEntry is a notification that is delivered, or still has to be delivered, through the outbox
+type OutboxEntry struct {
+	Id            int
+	Scope         string
+	Subject       string
+	Notification  *ErrorNotification
+	State         OutboxState
+	Attempts      int
+	CreatedAt     time.Time
+	NextAttemptAt time.Time
+	DeliveredAt   *time.Time
+	LastError     string
+}
+
+func (e *OutboxEntry) String() string {
+	return fmt.Sprintf("Outbox #%v [%v] %v after %v attempt(s)", e.Id, e.State, e.Subject, e.Attempts)
+}
+
+/*
+OutboxNotifier writes every notification to the outbox, from where Watch passes it on to the notifier. A notification that fails is
+retried with exponential backoff and jitter until it is delivered or older than the max age of the store. Since the outbox is stored, notifications that
+were not delivered when errord stopped are delivered once it is started again
+*/
+type OutboxNotifier struct {
+	notifier Notifier
+	store    OutboxStore
+	maxAge   time.Duration
+	now      func() time.Time
+	wake     chan struct{}
+}
+
+func NewOutboxNotifier(n Notifier, store OutboxStore) *OutboxNotifier {
+	o := new(OutboxNotifier)
+	o.notifier = n
+	o.store = store
+	o.maxAge = store.MaxAge()
+	o.now = time.Now
+	o.wake = make(chan struct{}, 1)
+	return o
+}
+
+// Fire only writes the notification to the outbox, so it does not wait for the notifier. It is delivered and retried by Watch
+func (o *OutboxNotifier) Fire(n *ErrorNotification) error {
+	if _, err := o.store.Enqueue(n); err != nil {
+		log.Printf("Failed writing notification for [%v] to outbox: %v\n", n.ErrorEvent.Exception, err)
+		return err
+	}
+	select {
+	case o.wake <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+/*
+Watch delivers the entries that are due every interval and as soon as a notification is written to the outbox, starting with the
+entries left over from before errord was started
+*/
+func (o *OutboxNotifier) Watch(interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		for {
+			o.check(o.now())
+			select {
+			case <-ticker.C:
+			case <-o.wake:
+			}
+		}
+	}()
+}
+
+func (o *OutboxNotifier) check(now time.Time) {
+	for _, entry := range o.store.FetchDue(now) {
+		o.deliver(entry)
+	}
+}
+
+func (o *OutboxNotifier) deliver(entry *OutboxEntry) {
+	err := o.notifier.Fire(entry.Notification)
+	if err == nil {
+		err = o.store.Delivered(entry)
+	} else {
+		err = retryLater(o.store, entry, err, o.now(), o.maxAge)
+	}
+	if err != nil {
+		log.Printf("Failed updating %v: %v\n", entry, err)
+	}
+}
+
+// retryLater tries the entry again after a backoff, or gives up on it once it is older than maxAge
+func retryLater(store OutboxStore, entry *OutboxEntry, cause error, now time.Time, maxAge time.Duration) error {
+	if now.Sub(entry.CreatedAt) >= maxAge {
+		log.Printf("Giving up on %v: %v\n", entry, cause)
+		return store.Expire(entry, cause)
+	}
+	wait := backoff(entry.Attempts)
+	log.Printf("Failed delivering %v. Retrying in %v: %v\n", entry, wait, cause)
+	return store.Failed(entry, cause, now.Add(wait))
+}
+
+// backoff doubles the wait after every failed attempt up to OUTBOX_MAX_BACKOFF. Half of the wait is random so that retries spread out
+func backoff(attempts int) time.Duration {
+	wait := OUTBOX_MIN_BACKOFF
+	for i := 0; i < attempts && wait < OUTBOX_MAX_BACKOFF; i++ {
+		wait *= 2
+	}
+	if wait > OUTBOX_MAX_BACKOFF {
+		wait = OUTBOX_MAX_BACKOFF
+	}
+	return wait/2 + time.Duration(rand.Int63n(int64(wait/2)))
+}
+
+/*
+heldNotifications are the notifications a notifier holds back, like the cluster and digest notifiers for a window and the silence
+notifier for a maintenance window. They are held in the outbox under the scope of the notifier, so that they are not lost when errord
+stops. flush is called once the window has passed, and again after a backoff when passing them on failed, until they are older than
+the max age of the outbox
+*/
+type heldNotifications struct {
+	store  OutboxStore
+	scope  string
+	window time.Duration
+	flush  func()
+	timer  *time.Timer
+	lock   sync.Mutex
+}
+
+func newHeldNotifications(store OutboxStore, scope string, window time.Duration, flush func()) *heldNotifications {
+	h := &heldNotifications{store: store, scope: scope, window: window, flush: flush}
+	if held := store.FetchHeld(scope); len(held) > 0 {
+		log.Printf("Sending %v notification(s) held back by %v before errord was started in %v\n", len(held), scope, window)
+		h.schedule(window)
+	}
+	return h
+}
+
+// hold stores the notification and flushes after the window. Without a window the notifier flushes on its own
+func (h *heldNotifications) hold(n *ErrorNotification) error {
+	if _, err := h.store.Hold(h.scope, n); err != nil {
+		return err
+	}
+	if h.window > 0 {
+		h.schedule(h.window)
+	}
+	return nil
+}
+
+// schedule flushes after wait, unless a flush is already scheduled
+func (h *heldNotifications) schedule(wait time.Duration) {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	if h.timer == nil {
+		h.timer = time.AfterFunc(wait, h.flush)
+	}
+}
+
+// fetch returns the held notifications to flush. Notifications held from now on are flushed after the next window
+func (h *heldNotifications) fetch() []*OutboxEntry {
+	h.lock.Lock()
+	if h.timer != nil {
+		h.timer.Stop()
+		h.timer = nil
+	}
+	h.lock.Unlock()
+	return h.store.FetchHeld(h.scope)
+}
+
+func (h *heldNotifications) sent(entries []*OutboxEntry) {
+	for _, entry := range entries {
+		if err := h.store.Delivered(entry); err != nil {
+			log.Printf("Failed updating %v: %v\n", entry, err)
+		}
+	}
+}
+
+// failed keeps the entries held and flushes them again after a backoff. Entries older than the max age of the store are given up on
+func (h *heldNotifications) failed(entries []*OutboxEntry, cause error) {
+	now := time.Now()
+	var next time.Time
+	for _, entry := range entries {
+		if err := retryLater(h.store, entry, cause, now, h.store.MaxAge()); err != nil {
+			log.Printf("Failed updating %v: %v\n", entry, err)
+		}
+		if entry.State == OUTBOX_HELD && (next.IsZero() || entry.NextAttemptAt.Before(next)) {
+			next = entry.NextAttemptAt
+		}
+	}
+	if !next.IsZero() {
+		h.schedule(next.Sub(now))
+	}
+}
+
+func notificationsOf(entries []*OutboxEntry) []*ErrorNotification {
+	notifications := make([]*ErrorNotification, len(entries))
+	for i, entry := range entries {
+		notifications[i] = entry.Notification
+	}
+	return notifications
+}
@@ -0,0 +1,154 @@
+package errord
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"log"
+	"time"
+)
+
+var ErrOutboxEntryNotFound error = errors.New("Outbox entry not found")
+
+type OutboxStore interface {
+	Enqueue(n *ErrorNotification) (*OutboxEntry, error)
+	Hold(scope string, n *ErrorNotification) (*OutboxEntry, error)
+	FetchHeld(scope string) []*OutboxEntry
+	FetchDue(now time.Time) []*OutboxEntry
+	FetchEntries(since time.Time) []*OutboxEntry
+	Delivered(entry *OutboxEntry) error
+	Failed(entry *OutboxEntry, err error, next time.Time) error
+	Expire(entry *OutboxEntry, err error) error
+	Retry(id int) error
+	MaxAge() time.Duration
+}
+
+type outboxStore struct {
+	db     *sql.DB
+	maxAge time.Duration
+}
+
+const outboxColumns string = `id, scope, subject, payload, state, attempts, created_at, next_attempt_at, delivered_at, last_error`
+
+func (store *outboxStore) Enqueue(n *ErrorNotification) (*OutboxEntry, error) {
+	return store.insert("", n, OUTBOX_PENDING)
+}
+
+// Hold writes a notification that is held back by the notifier of the scope. Held notifications are not delivered by the outbox
+func (store *outboxStore) Hold(scope string, n *ErrorNotification) (*OutboxEntry, error) {
+	return store.insert(scope, n, OUTBOX_HELD)
+}
+
+func (store *outboxStore) insert(scope string, n *ErrorNotification, state OutboxState) (*OutboxEntry, error) {
+	payload, err := json.Marshal(n)
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	entry := &OutboxEntry{Scope: scope, Subject: n.key(), Notification: n, State: state, CreatedAt: now, NextAttemptAt: now}
+	r, err := store.db.Exec(`insert into outbox(scope, subject, payload, state, attempts, created_at, next_attempt_at, last_error) values (?, ?, ?, ?, 0, ?, ?, '')`,
+		entry.Scope, entry.Subject, string(payload), string(entry.State), entry.CreatedAt, entry.NextAttemptAt)
+	if err != nil {
+		return nil, err
+	}
+	id, err := r.LastInsertId()
+	entry.Id = int(id)
+	return entry, err
+}
+
+func (store *outboxStore) FetchDue(now time.Time) []*OutboxEntry {
+	return store.fetch(`select `+outboxColumns+` from outbox where state = ? and next_attempt_at <= ? order by id`, string(OUTBOX_PENDING), now)
+}
+
+func (store *outboxStore) FetchHeld(scope string) []*OutboxEntry {
+	return store.fetch(`select `+outboxColumns+` from outbox where state = ? and scope = ? order by id`, string(OUTBOX_HELD), scope)
+}
+
+func (store *outboxStore) FetchEntries(since time.Time) []*OutboxEntry {
+	return store.fetch(`select `+outboxColumns+` from outbox where created_at >= ? order by id`, since)
+}
+
+func (store *outboxStore) fetch(query string, args ...interface{}) []*OutboxEntry {
+	var entries []*OutboxEntry
+	rows, err := store.db.Query(query, args...)
+	if err != nil {
+		log.Printf("Failed fetching Outbox entries: %v\n", err)
+		return entries
+	}
+	defer rows.Close()
+	for rows.Next() {
+		if entry := scanOutboxEntry(rows); entry != nil {
+			entries = append(entries, entry)
+		}
+	}
+	return entries
+}
+
+func (store *outboxStore) Delivered(entry *OutboxEntry) error {
+	now := time.Now()
+	entry.Attempts++
+	entry.State = OUTBOX_DELIVERED
+	entry.DeliveredAt = &now
+	_, err := store.db.Exec(`update outbox set state = ?, attempts = ?, delivered_at = ? where id = ?`, string(entry.State), entry.Attempts, now, entry.Id)
+	return err
+}
+
+func (store *outboxStore) Failed(entry *OutboxEntry, cause error, next time.Time) error {
+	entry.Attempts++
+	entry.NextAttemptAt = next
+	entry.LastError = cause.Error()
+	_, err := store.db.Exec(`update outbox set attempts = ?, next_attempt_at = ?, last_error = ? where id = ?`, entry.Attempts, next, entry.LastError, entry.Id)
+	return err
+}
+
+func (store *outboxStore) Expire(entry *OutboxEntry, cause error) error {
+	entry.Attempts++
+	entry.State = OUTBOX_EXPIRED
+	entry.LastError = cause.Error()
+	_, err := store.db.Exec(`update outbox set state = ?, attempts = ?, last_error = ? where id = ?`, string(entry.State), entry.Attempts, entry.LastError, entry.Id)
+	return err
+}
+
+/*
+Retry makes an entry due immediately again. An expired entry gets a new max age. Held entries are left to the notifier that holds
+them back
+*/
+func (store *outboxStore) Retry(id int) error {
+	now := time.Now()
+	r, err := store.db.Exec(`update outbox set state = ?, next_attempt_at = ?, created_at = case when state = ? then ? else created_at end
+	where id = ? and state != ? and state != ?`, string(OUTBOX_PENDING), now, string(OUTBOX_EXPIRED), now, id, string(OUTBOX_DELIVERED), string(OUTBOX_HELD))
+	if err != nil {
+		return err
+	}
+	if count, _ := r.RowsAffected(); count == 0 {
+		return ErrOutboxEntryNotFound
+	}
+	return nil
+}
+
+// MaxAge is how long failed notifications are retried before they are given up on
+func (store *outboxStore) MaxAge() time.Duration {
+	if store.maxAge <= 0 {
+		return DEFAULT_OUTBOX_MAX_AGE
+	}
+	return store.maxAge
+}
+
+func scanOutboxEntry(row scanner) *OutboxEntry {
+	entry := new(OutboxEntry)
+	var state, payload string
+	err := row.Scan(&entry.Id, &entry.Scope, &entry.Subject, &payload, &state, &entry.Attempts, &entry.CreatedAt, &entry.NextAttemptAt, &entry.DeliveredAt, &entry.LastError)
+	if err == sql.ErrNoRows {
+		return nil
+	} else if err != nil {
+		log.Printf("Failed mapping Outbox entry: %v\n", err)
+		return nil
+	}
+	entry.State = OutboxState(state)
+	entry.Notification = new(ErrorNotification)
+	if err := json.Unmarshal([]byte(payload), entry.Notification); err != nil {
+		log.Printf("Failed decoding notification of Outbox entry #%v: %v\n", entry.Id, err)
+		return nil
+	}
+	return entry
+}
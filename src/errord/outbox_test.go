@@ -0,0 +1,236 @@
+package errord
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+type memOutboxStore struct {
+	entries []*OutboxEntry
+	maxAge  time.Duration
+}
+
+func (s *memOutboxStore) Enqueue(n *ErrorNotification) (*OutboxEntry, error) {
+	entry := &OutboxEntry{Id: len(s.entries) + 1, Subject: n.key(), Notification: n, State: OUTBOX_PENDING, CreatedAt: time.Now(), NextAttemptAt: time.Now()}
+	s.entries = append(s.entries, entry)
+	return entry, nil
+}
+
+func (s *memOutboxStore) Hold(scope string, n *ErrorNotification) (*OutboxEntry, error) {
+	entry, _ := s.Enqueue(n)
+	entry.Scope = scope
+	entry.State = OUTBOX_HELD
+	return entry, nil
+}
+
+func (s *memOutboxStore) FetchHeld(scope string) []*OutboxEntry {
+	held := []*OutboxEntry{}
+	for _, entry := range s.entries {
+		if entry.State == OUTBOX_HELD && entry.Scope == scope {
+			held = append(held, entry)
+		}
+	}
+	return held
+}
+
+func (s *memOutboxStore) FetchDue(now time.Time) []*OutboxEntry {
+	due := []*OutboxEntry{}
+	for _, entry := range s.entries {
+		if entry.State == OUTBOX_PENDING && !entry.NextAttemptAt.After(now) {
+			due = append(due, entry)
+		}
+	}
+	return due
+}
+
+func (s *memOutboxStore) FetchEntries(since time.Time) []*OutboxEntry {
+	return s.entries
+}
+
+func (s *memOutboxStore) Delivered(entry *OutboxEntry) error {
+	now := time.Now()
+	entry.Attempts++
+	entry.State = OUTBOX_DELIVERED
+	entry.DeliveredAt = &now
+	return nil
+}
+
+func (s *memOutboxStore) Failed(entry *OutboxEntry, err error, next time.Time) error {
+	entry.Attempts++
+	entry.NextAttemptAt = next
+	entry.LastError = err.Error()
+	return nil
+}
+
+func (s *memOutboxStore) Expire(entry *OutboxEntry, err error) error {
+	entry.Attempts++
+	entry.State = OUTBOX_EXPIRED
+	entry.LastError = err.Error()
+	return nil
+}
+
+func (s *memOutboxStore) MaxAge() time.Duration {
+	if s.maxAge == 0 {
+		return DEFAULT_OUTBOX_MAX_AGE
+	}
+	return s.maxAge
+}
+
+func (s *memOutboxStore) Retry(id int) error {
+	s.entries[id-1].State = OUTBOX_PENDING
+	return nil
+}
+
+func TestOutboxRetriesFailedNotifications(t *testing.T) {
+	failing := &failingNotifier{}
+	store := &memOutboxStore{maxAge: time.Hour}
+	outbox := NewOutboxNotifier(failing, store)
+
+	if err := outbox.Fire(newTestNotification()); err != nil {
+		t.Errorf("Fire should not fail once the notification is in the outbox: %v", err)
+	}
+	entry := store.entries[0]
+	if failing.attempts != 0 || entry.State != OUTBOX_PENDING {
+		t.Fatalf("Fire should only write the notification to the outbox. Got %v", entry)
+	}
+
+	outbox.check(time.Now())
+	if failing.attempts != 1 || entry.State != OUTBOX_PENDING || entry.LastError != "unavailable" {
+		t.Fatalf("Failed notification should stay pending. Got %v", entry)
+	}
+	if entry.NextAttemptAt.Before(time.Now().Add(OUTBOX_MIN_BACKOFF / 2)) {
+		t.Errorf("Failed notification should only be retried after a backoff. Got %v", entry.NextAttemptAt)
+	}
+
+	outbox.check(time.Now())
+	if failing.attempts != 1 {
+		t.Errorf("Notification should not be retried before its next attempt")
+	}
+	outbox.check(entry.NextAttemptAt)
+	if failing.attempts != 2 || entry.Attempts != 2 {
+		t.Errorf("Notification should be retried once its next attempt is due")
+	}
+
+	recorder := &recordingNotifier{}
+	outbox.notifier = recorder
+	outbox.check(entry.NextAttemptAt)
+	if len(recorder.fired) != 1 || entry.State != OUTBOX_DELIVERED || recorder.fired[0].key() != "java.sql.SQLException" {
+		t.Errorf("Notification should be delivered once the notifier recovers. Got %v", entry)
+	}
+}
+
+func TestOutboxExpiresOldNotifications(t *testing.T) {
+	store := &memOutboxStore{maxAge: time.Hour}
+	outbox := NewOutboxNotifier(&failingNotifier{}, store)
+	outbox.Fire(newTestNotification())
+	outbox.check(time.Now())
+
+	outbox.now = func() time.Time { return time.Now().Add(2 * time.Hour) }
+	outbox.check(outbox.now())
+	if store.entries[0].State != OUTBOX_EXPIRED {
+		t.Errorf("Notification older than the max age should expire. Got %v", store.entries[0])
+	}
+}
+
+func TestClusterNotificationsAreHeldInTheOutbox(t *testing.T) {
+	store := &memOutboxStore{}
+	failing := &failingNotifier{}
+	cluster := NewClusterNotifier(failing, time.Hour, nil, newMemNotifyStore(), store).(*ClusterNotifier)
+	n := newTestNotification()
+	n.Kind = NOTIFY_DETECTED
+	cluster.Fire(n)
+	entry := store.entries[0]
+	if failing.attempts != 0 || entry.State != OUTBOX_HELD || entry.Scope != CLUSTER_SCOPE {
+		t.Fatalf("Notification should be held in the outbox for the window. Got %v", entry)
+	}
+
+	cluster.flush()
+	if failing.attempts != 1 || entry.State != OUTBOX_HELD || entry.Attempts != 1 {
+		t.Errorf("Notification that failed should stay held to be retried. Got %v", entry)
+	}
+
+	recorder := &recordingNotifier{}
+	restarted := NewClusterNotifier(recorder, time.Hour, nil, newMemNotifyStore(), store).(*ClusterNotifier)
+	restarted.flush()
+	if len(recorder.fired) != 1 || entry.State != OUTBOX_DELIVERED {
+		t.Errorf("Held notification should be sent after a restart. Got %v", entry)
+	}
+}
+
+func TestHeldNotificationsExpire(t *testing.T) {
+	store := &memOutboxStore{maxAge: time.Hour}
+	cluster := NewClusterNotifier(&failingNotifier{}, time.Hour, nil, newMemNotifyStore(), store).(*ClusterNotifier)
+	n := newTestNotification()
+	n.Kind = NOTIFY_DETECTED
+	cluster.Fire(n)
+	entry := store.entries[0]
+	entry.CreatedAt = time.Now().Add(-2 * time.Hour)
+
+	cluster.flush()
+	if entry.State != OUTBOX_EXPIRED {
+		t.Errorf("Held notification older than the max age should expire when it fails. Got %v", entry)
+	}
+}
+
+func TestBackoffGrowsUpToTheMaximum(t *testing.T) {
+	for attempts, max := range []time.Duration{OUTBOX_MIN_BACKOFF, 2 * OUTBOX_MIN_BACKOFF, 4 * OUTBOX_MIN_BACKOFF} {
+		if wait := backoff(attempts); wait < max/2 || wait >= max {
+			t.Errorf("Backoff after %v attempts should be between %v and %v. Got %v", attempts, max/2, max, wait)
+		}
+	}
+	if wait := backoff(100); wait >= OUTBOX_MAX_BACKOFF {
+		t.Errorf("Backoff should not exceed %v. Got %v", OUTBOX_MAX_BACKOFF, wait)
+	}
+}
+
+func TestOutboxPayloadKeepsNotificationKey(t *testing.T) {
+	n := newTestNotification()
+	n.Kind = NOTIFY_ONGOING
+	n.Incident = &Incident{Id: 4, Count: 12}
+	payload, _ := json.Marshal(n)
+	decoded := new(ErrorNotification)
+	if err := json.Unmarshal(payload, decoded); err != nil {
+		t.Fatalf("Notification should decode from the outbox payload: %v", err)
+	}
+	if decoded.key() != n.key() || decoded.ErrorEvent.Detail != n.ErrorEvent.Detail {
+		t.Errorf("Decoded notification should have the same key. Got %v want %v", decoded.key(), n.key())
+	}
+}
+
+type exceptionsErrorStore struct {
+	memErrorStore
+	fetched []string
+}
+
+func (s *exceptionsErrorStore) FetchExceptionEvents(since time.Time, exceptions []string) []ErrorEvent {
+	s.fetched = exceptions
+	return s.memErrorStore.FetchExceptionEvents(since, exceptions)
+}
+
+func TestClusterOnlyCorrelatesHeldExceptions(t *testing.T) {
+	errorStore := &exceptionsErrorStore{}
+	seen := time.Now().Add(-time.Hour).Truncate(time.Minute)
+	connection, sql, unmarshal := seen, seen.Add(10*time.Second), seen.Add(2*time.Minute)
+	for _, e := range []ErrorEvent{
+		newErrorEvent("ConnectionException", &connection),
+		newErrorEvent("SQLException", &sql),
+		newErrorEvent("UnmarshalException", &unmarshal),
+	} {
+		errorStore.Add(&e)
+	}
+	recorder := &recordingNotifier{}
+	cluster := NewClusterNotifier(recorder, time.Hour, errorStore, newMemNotifyStore(), &memOutboxStore{}).(*ClusterNotifier)
+	for _, e := range errorStore.events[:2] {
+		event := e
+		cluster.Fire(&ErrorNotification{ErrorEvent: &event, Kind: NOTIFY_DETECTED})
+	}
+
+	cluster.flush()
+	if len(errorStore.fetched) != 2 || errorStore.fetched[0] != "ConnectionException" || errorStore.fetched[1] != "SQLException" {
+		t.Errorf("Only the held exceptions should be fetched to correlate. Got %v", errorStore.fetched)
+	}
+	if len(recorder.fired) != 1 || len(recorder.fired[0].Related) != 1 {
+		t.Errorf("Correlated held exceptions should be sent as one notification. Got %v", len(recorder.fired))
+	}
+}
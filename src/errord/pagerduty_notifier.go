@@ -0,0 +1,133 @@
+package errord
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+)
+
+const PAGERDUTY_EVENTS_URL string = "https://events.pagerduty.com/v2/enqueue"
+
+const SEVERITY_CRITICAL string = "critical"
+const SEVERITY_ERROR string = "error"
+const SEVERITY_WARNING string = "warning"
+const SEVERITY_INFO string = "info"
+
+// CRITICAL_SCORE is how many times over its limit an exception must be seen to be critical
+const CRITICAL_SCORE float64 = 2
+
+/*
+PagerDutyNotifier sends PagerDuty Events API v2 trigger, acknowledge and resolve events. The dedup key is derived from the fingerprint
+of the exception so that every notification of the same exception updates one alert. Opsgenie accepts the same events on the URL of
+its PagerDuty compatible integration
+*/
+type PagerDutyNotifier struct {
+	url        string
+	routingKey string
+	source     string
+	client     *http.Client
+	store      NotifyStore
+}
+
+type pagerDutyEvent struct {
+	RoutingKey  string            `json:"routing_key"`
+	EventAction string            `json:"event_action"`
+	DedupKey    string            `json:"dedup_key"`
+	Payload     *pagerDutyPayload `json:"payload,omitempty"`
+}
+
+type pagerDutyPayload struct {
+	Summary       string            `json:"summary"`
+	Source        string            `json:"source"`
+	Severity      string            `json:"severity"`
+	Timestamp     string            `json:"timestamp,omitempty"`
+	Component     string            `json:"component,omitempty"`
+	Class         string            `json:"class"`
+	CustomDetails map[string]string `json:"custom_details"`
+}
+
+func NewPagerDutyNotifier(url, routingKey, source string, timeout time.Duration, store NotifyStore) Notifier {
+	if url == "" {
+		url = PAGERDUTY_EVENTS_URL
+	}
+	n := new(PagerDutyNotifier)
+	n.url = url
+	n.routingKey = routingKey
+	n.source = source
+	n.client = &http.Client{Timeout: timeout}
+	n.store = store
+	return n
+}
+
+func (n *PagerDutyNotifier) Fire(notification *ErrorNotification) error {
+	if n.store.HasNotification(notification) {
+		log.Printf("Notification already sent for %v\n", notification.ErrorEvent)
+		return nil
+	}
+	payload, err := json.Marshal(n.event(notification))
+	if err != nil {
+		return err
+	}
+	resp, err := n.client.Post(n.url, "application/json", bytes.NewReader(payload))
+	if err != nil {
+		log.Printf("Failed sending PagerDuty event -> %v\n", err)
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("PagerDuty responded with %v", resp.Status)
+	}
+	markSent(n.store, notification)
+	return nil
+}
+
+func (n *PagerDutyNotifier) event(notification *ErrorNotification) pagerDutyEvent {
+	event := pagerDutyEvent{RoutingKey: n.routingKey, EventAction: "trigger", DedupKey: "errord-" + notification.fingerprint()}
+	switch notification.Kind {
+	case NOTIFY_RESOLVED:
+		event.EventAction = "resolve"
+		return event
+	case NOTIFY_ACKNOWLEDGED:
+		event.EventAction = "acknowledge"
+		return event
+	}
+	subject, body := notification.describe()
+	e := notification.ErrorEvent
+	event.Payload = &pagerDutyPayload{
+		Summary:       subject,
+		Source:        n.source,
+		Severity:      notification.Severity(),
+		Component:     e.Source,
+		Class:         e.Exception,
+		CustomDetails: map[string]string{"description": e.Description, "detail": e.Detail, "body": body},
+	}
+	if e.Timestamp != nil {
+		event.Payload.Timestamp = e.Timestamp.Format(time.RFC3339)
+	}
+	return event
+}
+
+// score is how many times over its limit the exception has been seen. Notifications without a limit score 1
+func (n *ErrorNotification) score() float64 {
+	if n.Stats != nil && n.DaySummary != nil && n.limit() > 0 {
+		return float64(n.DaySummary.Total) / float64(n.limit())
+	}
+	return 1
+}
+
+// Severity maps the log level and the score of the notification to critical, error, warning or info
+func (n *ErrorNotification) Severity() string {
+	if n.score() >= CRITICAL_SCORE || (n.Rule != nil && n.Rule.Action == RULE_ALWAYS) {
+		return SEVERITY_CRITICAL
+	}
+	switch n.ErrorEvent.Level {
+	case ERROR_LOG_LEVEL, EMPTY_LOG_LEVEL:
+		return SEVERITY_ERROR
+	case INFO_LOG_LEVEL, DEBUG_LOG_LEVEL, TRACE_LOG_LEVEL:
+		return SEVERITY_INFO
+	}
+	return SEVERITY_WARNING
+}
@@ -0,0 +1,68 @@
+package errord
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestPagerDutyNotifierTriggersAndResolvesOneAlert(t *testing.T) {
+	events := []pagerDutyEvent{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var e pagerDutyEvent
+		json.NewDecoder(r.Body).Decode(&e)
+		events = append(events, e)
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	defer server.Close()
+
+	notifier := NewPagerDutyNotifier(server.URL, "routing", "errord-host", time.Second, newMemNotifyStore())
+	opened := newTestNotification()
+	incident := &Incident{Id: 1, Exception: opened.ErrorEvent.Exception, Fingerprint: opened.ErrorEvent.Fingerprint(), State: INCIDENT_OPEN}
+	opened.Kind = NOTIFY_OPENED
+	opened.Incident = incident
+	if err := notifier.Fire(opened); err != nil {
+		t.Fatalf("Fire should not fail when the event is accepted: %v", err)
+	}
+	incident.State = INCIDENT_RESOLVED
+	notifier.Fire(&ErrorNotification{ErrorEvent: incident.event(), Kind: NOTIFY_RESOLVED, Incident: incident})
+
+	if len(events) != 2 {
+		t.Fatalf("Every notification should send an event. Got %v", len(events))
+	}
+	if events[0].EventAction != "trigger" || events[1].EventAction != "resolve" {
+		t.Errorf("Opened incident should trigger and resolved incident should resolve. Got %v and %v", events[0].EventAction, events[1].EventAction)
+	}
+	if events[0].DedupKey != events[1].DedupKey || events[0].DedupKey != "errord-"+opened.ErrorEvent.Fingerprint() {
+		t.Errorf("Events of one exception should have the same dedup key. Got %v and %v", events[0].DedupKey, events[1].DedupKey)
+	}
+	if events[0].RoutingKey != "routing" || events[0].Payload.Source != "errord-host" || events[0].Payload.Severity != SEVERITY_ERROR {
+		t.Errorf("Trigger should contain the routing key, source and severity. Got %+v %+v", events[0], events[0].Payload)
+	}
+	if events[1].Payload != nil {
+		t.Errorf("Resolve event should not have a payload")
+	}
+}
+
+func TestNotificationSeverity(t *testing.T) {
+	n := newTestNotification()
+	if n.Severity() != SEVERITY_ERROR {
+		t.Errorf("New ERROR should have error severity. Got %v", n.Severity())
+	}
+	n.Stats = &StatItem{Mean: 10, StdDev: 0}
+	n.DaySummary = &DaySummary{Total: 20}
+	if n.Severity() != SEVERITY_CRITICAL {
+		t.Errorf("Exception seen twice its limit should be critical. Got %v", n.Severity())
+	}
+	n.DaySummary.Total = 11
+	n.ErrorEvent.Level = INFO_LOG_LEVEL
+	if n.Severity() != SEVERITY_INFO {
+		t.Errorf("INFO level exception just over its limit should have info severity. Got %v", n.Severity())
+	}
+	n.Rule = &Rule{Action: RULE_ALWAYS}
+	if n.Severity() != SEVERITY_CRITICAL {
+		t.Errorf("Exception that always alerts should be critical. Got %v", n.Severity())
+	}
+}
@@ -0,0 +1,116 @@
+package errord
+
+import (
+	"fmt"
+	"log"
+	"time"
+)
+
+const DEDUP_EXCEPTION string = "exception"
+const DEDUP_FINGERPRINT string = "fingerprint"
+
+const DECISION_SENT string = "sent"
+const DECISION_NOTIFY string = "notify"
+const DECISION_SUPPRESS string = "suppress"
+
+/*
+NotifyPolicy decides whether a notification is sent again. Notifications are deduplicated on the exception, or on the fingerprint
+with DedupBy fingerprint. Without Renotify a notification is sent once per day and incident notifications are sent once. With
+Renotify the detected, opened and ongoing notifications of an exception are sent again once Renotify has passed since the last one.
+With Escalation a notification is always sent when its severity is higher than the severity of the last one
+*/
+type NotifyPolicy struct {
+	DedupBy    string
+	Renotify   time.Duration
+	Escalation bool
+}
+
+// NotificationRecord is a notification that was sent or a decision of the NotifyPolicy. Decisions counts repeated suppress decisions
+type NotificationRecord struct {
+	Id        int
+	Subject   string
+	Exception string
+	DedupKey  string
+	SentAt    time.Time
+	Severity  string
+	Decision  string
+	Reason    string
+	Decisions int
+}
+
+func (p NotifyPolicy) validate() error {
+	if p.DedupBy != "" && p.DedupBy != DEDUP_EXCEPTION && p.DedupBy != DEDUP_FINGERPRINT {
+		return fmt.Errorf("Dedup must be by '%v' or '%v'. Got '%v'", DEDUP_EXCEPTION, DEDUP_FINGERPRINT, p.DedupBy)
+	}
+	return nil
+}
+
+// governs is true for the notifications of an exception that is still seen. The other notifications are only sent once
+func (p NotifyPolicy) governs(n *ErrorNotification) bool {
+	return n.Kind == NOTIFY_DETECTED || n.Kind == NOTIFY_OPENED || n.Kind == NOTIFY_ONGOING
+}
+
+func (p NotifyPolicy) dedupKey(n *ErrorNotification) string {
+	switch {
+	case !p.governs(n):
+		return n.key()
+	case p.DedupBy == DEDUP_FINGERPRINT:
+		return "fingerprint:" + n.fingerprint()
+	}
+	return n.ErrorEvent.Exception
+}
+
+// decide is given the last notification sent with the same dedup key and whether a notification with the same key was ever sent
+func (p NotifyPolicy) decide(n *ErrorNotification, last *NotificationRecord, sent bool, now time.Time) (bool, string) {
+	if !p.governs(n) {
+		if sent {
+			return false, "already sent"
+		}
+		return true, "not sent before"
+	}
+	if last == nil {
+		return true, "first notification"
+	}
+	severity := n.Severity()
+	if p.Escalation && SEVERITY_RANK[severity] > SEVERITY_RANK[last.Severity] {
+		return true, fmt.Sprintf("severity escalated from %v to %v", last.Severity, severity)
+	}
+	since := now.Sub(last.SentAt).Truncate(time.Second)
+	if p.Renotify > 0 {
+		if since >= p.Renotify {
+			return true, fmt.Sprintf("still seen %v after the last notification", since)
+		}
+		return false, fmt.Sprintf("notified %v ago", since)
+	}
+	if n.Incident != nil {
+		if sent {
+			return false, "already sent"
+		}
+		return true, "not sent before"
+	}
+	if last.SentAt.UTC().Format("2006-01-02") == now.UTC().Format("2006-01-02") {
+		return false, "already sent today"
+	}
+	return true, "not sent today"
+}
+
+// PolicyNotifier only passes on the notifications the NotifyPolicy of the store decides to send
+type PolicyNotifier struct {
+	notifier Notifier
+	store    NotifyStore
+}
+
+func NewPolicyNotifier(n Notifier, store NotifyStore) Notifier {
+	p := new(PolicyNotifier)
+	p.notifier = n
+	p.store = store
+	return p
+}
+
+func (p *PolicyNotifier) Fire(n *ErrorNotification) error {
+	if !p.store.Decide(n) {
+		log.Printf("Notification for [%v] suppressed by policy\n", n.ErrorEvent.Exception)
+		return nil
+	}
+	return p.notifier.Fire(n)
+}
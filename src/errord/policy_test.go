@@ -0,0 +1,88 @@
+package errord
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestNotifyPolicyOncePerDayByDefault(t *testing.T) {
+	now := time.Date(2016, 3, 31, 12, 0, 0, 0, time.UTC)
+	policy := NotifyPolicy{}
+	n := newTestNotification()
+
+	if notify, reason := policy.decide(n, nil, false, now); !notify || reason != "first notification" {
+		t.Errorf("First notification should be sent. Got %v %v", notify, reason)
+	}
+	last := &NotificationRecord{SentAt: now.Add(-time.Hour), Severity: SEVERITY_ERROR}
+	if notify, _ := policy.decide(n, last, true, now); notify {
+		t.Errorf("Notification already sent today should be suppressed")
+	}
+	last.SentAt = now.Add(-24 * time.Hour)
+	if notify, _ := policy.decide(n, last, true, now); !notify {
+		t.Errorf("Notification sent yesterday should be sent again")
+	}
+
+	n.Kind = NOTIFY_ONGOING
+	n.Incident = &Incident{Id: 1, Count: 5}
+	if notify, _ := policy.decide(n, last, false, now); !notify {
+		t.Errorf("Ongoing notification with a new count should be sent")
+	}
+	n.Kind = NOTIFY_RESOLVED
+	if notify, _ := policy.decide(n, nil, true, now); notify {
+		t.Errorf("Resolved notification should only be sent once")
+	}
+}
+
+func TestNotifyPolicyRenotifiesAndEscalates(t *testing.T) {
+	now := time.Date(2016, 3, 31, 12, 0, 0, 0, time.UTC)
+	policy := NotifyPolicy{Renotify: 4 * time.Hour, Escalation: true}
+	n := newTestNotification()
+	last := &NotificationRecord{SentAt: now.Add(-time.Hour), Severity: SEVERITY_ERROR}
+
+	if notify, reason := policy.decide(n, last, true, now); notify || reason != "notified 1h0m0s ago" {
+		t.Errorf("Notification within the renotify period should be suppressed. Got %v %v", notify, reason)
+	}
+	last.SentAt = now.Add(-5 * time.Hour)
+	if notify, _ := policy.decide(n, last, true, now); !notify {
+		t.Errorf("Notification should be sent again after the renotify period")
+	}
+
+	last.SentAt = now.Add(-time.Minute)
+	n.Stats = &StatItem{Mean: 10, StdDev: 2}
+	n.DaySummary = &DaySummary{Total: 500}
+	notify, reason := policy.decide(n, last, true, now)
+	if !notify || !strings.Contains(reason, "escalated from error to critical") {
+		t.Errorf("Escalated notification should be sent. Got %v %v", notify, reason)
+	}
+	last.Severity = SEVERITY_CRITICAL
+	if notify, _ := policy.decide(n, last, true, now); notify {
+		t.Errorf("Notification with the same severity should be suppressed within the renotify period")
+	}
+}
+
+func TestNotifyPolicyDedupKey(t *testing.T) {
+	n := newTestNotification()
+	if key := (NotifyPolicy{}).dedupKey(n); key != "java.sql.SQLException" {
+		t.Errorf("Notifications should be deduplicated on the exception by default. Got %v", key)
+	}
+	if key := (NotifyPolicy{DedupBy: DEDUP_FINGERPRINT}).dedupKey(n); key != "fingerprint:"+n.fingerprint() {
+		t.Errorf("Notifications should be deduplicated on the fingerprint. Got %v", key)
+	}
+	if err := (NotifyPolicy{DedupBy: "class"}).validate(); err == nil {
+		t.Errorf("Unknown dedup should not be valid")
+	}
+}
+
+func TestPolicyNotifierSuppresses(t *testing.T) {
+	store := newMemNotifyStore()
+	recorder := &recordingNotifier{}
+	notifier := NewPolicyNotifier(recorder, store)
+	n := newTestNotification()
+	notifier.Fire(n)
+	markSent(store, n)
+	notifier.Fire(n)
+	if len(recorder.fired) != 1 {
+		t.Errorf("Notification the policy decides against should not be passed on. Got %v", len(recorder.fired))
+	}
+}
@@ -0,0 +1,130 @@
+package errord
+
+import (
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const QUERY_DEFAULT_LIMIT int = 100
+const QUERY_MAX_LIMIT int = 1000
+
+// Query filters the rows the read API returns to a time range and an exception, and pages them with Limit and Offset
+type Query struct {
+	Since     time.Time
+	Until     time.Time
+	Exception string
+	Limit     int
+	Offset    int
+}
+
+// Page is a page of the rows matching a query. Total counts all the matching rows
+type Page struct {
+	Items  interface{}
+	Total  int
+	Limit  int
+	Offset int
+}
+
+/*
+ParseQuery reads a query from URL parameters. since and until are RFC3339 times or periods before now like 24h or 7d. limit
+defaults to 100 and is at most 1000
+*/
+func ParseQuery(values url.Values, now time.Time) (Query, error) {
+	q := Query{Exception: values.Get("exception"), Limit: QUERY_DEFAULT_LIMIT}
+	var err error
+	if q.Since, err = parseQueryTime(values.Get("since"), now); err != nil {
+		return q, fmt.Errorf("Invalid since: %v", err)
+	}
+	if q.Until, err = parseQueryTime(values.Get("until"), now); err != nil {
+		return q, fmt.Errorf("Invalid until: %v", err)
+	}
+	if v := values.Get("limit"); v != "" {
+		if q.Limit, err = strconv.Atoi(v); err != nil || q.Limit < 1 || q.Limit > QUERY_MAX_LIMIT {
+			return q, fmt.Errorf("Invalid limit: must be between 1 and %v", QUERY_MAX_LIMIT)
+		}
+	}
+	if v := values.Get("offset"); v != "" {
+		if q.Offset, err = strconv.Atoi(v); err != nil || q.Offset < 0 {
+			return q, fmt.Errorf("Invalid offset: %v", v)
+		}
+	}
+	return q, nil
+}
+
+func parseQueryTime(value string, now time.Time) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+	period, err := ParsePeriod(value)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("'%v' is not an RFC3339 time or a period", value)
+	}
+	return now.Add(-period), nil
+}
+
+// where is the where clause of the query over the time and exception columns, with its arguments
+func (q Query) where(timeColumn, exceptionColumn string) (string, []interface{}) {
+	var since, until interface{}
+	if !q.Since.IsZero() {
+		since = q.Since
+	}
+	if !q.Until.IsZero() {
+		until = q.Until
+	}
+	return q.clause(timeColumn, since, "<", until, exceptionColumn)
+}
+
+// formattedWhere is like where for a column of times stored as text in the layout, in local time
+func (q Query) formattedWhere(timeColumn, layout, exceptionColumn string) (string, []interface{}) {
+	var since, until interface{}
+	if !q.Since.IsZero() {
+		since = q.Since.Local().Format(layout)
+	}
+	if !q.Until.IsZero() {
+		until = q.Until.Local().Format(layout)
+	}
+	return q.clause(timeColumn, since, "<", until, exceptionColumn)
+}
+
+// dateWhere is like where for a column of dates. The day of Until is included
+func (q Query) dateWhere(dateColumn, exceptionColumn string) (string, []interface{}) {
+	var since, until interface{}
+	if !q.Since.IsZero() {
+		since = q.Since.Format("2006-01-02")
+	}
+	if !q.Until.IsZero() {
+		until = q.Until.Format("2006-01-02")
+	}
+	return q.clause(dateColumn, since, "<=", until, exceptionColumn)
+}
+
+func (q Query) clause(timeColumn string, since interface{}, untilOperator string, until interface{}, exceptionColumn string) (string, []interface{}) {
+	conditions := []string{}
+	args := []interface{}{}
+	if since != nil {
+		conditions = append(conditions, timeColumn+" >= ?")
+		args = append(args, since)
+	}
+	if until != nil {
+		conditions = append(conditions, fmt.Sprintf("%v %v ?", timeColumn, untilOperator))
+		args = append(args, until)
+	}
+	if q.Exception != "" {
+		conditions = append(conditions, exceptionColumn+" = ?")
+		args = append(args, q.Exception)
+	}
+	if len(conditions) == 0 {
+		return "", args
+	}
+	return " where " + strings.Join(conditions, " and "), args
+}
+
+func (q Query) page() string {
+	return fmt.Sprintf(" limit %d offset %d", q.Limit, q.Offset)
+}
@@ -0,0 +1,46 @@
+package errord
+
+import (
+	"net/url"
+	"testing"
+	"time"
+)
+
+func TestParseQuery(t *testing.T) {
+	now := time.Date(2016, 3, 31, 12, 0, 0, 0, time.UTC)
+	q, err := ParseQuery(url.Values{"since": {"7d"}, "until": {"2016-03-31T10:00:00Z"}, "exception": {"java.sql.SQLException"}, "offset": {"200"}}, now)
+	if err != nil {
+		t.Fatalf("Valid query should parse: %v", err)
+	}
+	if !q.Since.Equal(now.AddDate(0, 0, -7)) || !q.Until.Equal(now.Add(-2*time.Hour)) {
+		t.Errorf("Since and until should be periods before now or times. Got %v - %v", q.Since, q.Until)
+	}
+	if q.Limit != QUERY_DEFAULT_LIMIT || q.Offset != 200 || q.Exception != "java.sql.SQLException" {
+		t.Errorf("Limit should default and offset and exception should be read. Got %+v", q)
+	}
+	for _, values := range []url.Values{{"limit": {"0"}}, {"limit": {"5000"}}, {"offset": {"-1"}}, {"since": {"yesterday"}}} {
+		if _, err := ParseQuery(values, now); err == nil {
+			t.Errorf("Query %v should not be valid", values)
+		}
+	}
+}
+
+func TestQueryWhere(t *testing.T) {
+	since := time.Date(2016, 3, 24, 12, 0, 0, 0, time.UTC)
+	q := Query{Since: since, Exception: "java.sql.SQLException", Limit: 50, Offset: 100}
+	where, args := q.where("event_datetime", "exception")
+	if where != " where event_datetime >= ? and exception = ?" || len(args) != 2 || args[0] != since {
+		t.Errorf("Where should filter on the time range and exception. Got %v %v", where, args)
+	}
+	q.Until = time.Date(2016, 3, 31, 8, 0, 0, 0, time.UTC)
+	where, args = q.dateWhere("created_at", "name")
+	if where != " where created_at >= ? and created_at <= ? and name = ?" || args[0] != "2016-03-24" || args[1] != "2016-03-31" {
+		t.Errorf("Dates should be compared as dates including the day of until. Got %v %v", where, args)
+	}
+	if where, args := (Query{}).where("sent_at", "exception"); where != "" || len(args) != 0 {
+		t.Errorf("Empty query should not filter. Got %v", where)
+	}
+	if q.page() != " limit 50 offset 100" {
+		t.Errorf("Page should limit and offset. Got %v", q.page())
+	}
+}
@@ -0,0 +1,113 @@
+package errord
+
+import (
+	"errors"
+	"sort"
+	"time"
+)
+
+var ErrEmptyRelease error = errors.New("Release requires a Version and a Service")
+
+type Release struct {
+	Id         int
+	Version    string
+	Service    string
+	DeployedAt time.Time
+}
+
+// ReleaseChange compares how often an exception was seen per hour during a release with the release before it
+type ReleaseChange struct {
+	Exception string
+	Count     int
+	Before    float64
+	After     float64
+}
+
+type ReleaseReport struct {
+	Release   *Release
+	New       []ReleaseChange
+	Increased []ReleaseChange
+}
+
+// releaseCount is the number of times an exception was seen while a release was active
+type releaseCount struct {
+	releaseId int
+	exception string
+	count     int
+	firstSeen time.Time
+}
+
+func (r *Release) validate() error {
+	if r.Version == "" || r.Service == "" {
+		return ErrEmptyRelease
+	}
+	return nil
+}
+
+/*
+createReleaseReports finds the exceptions that were first seen during each release and the exceptions that were seen more often per hour
+than during the release of the same service before it. Releases must be ordered by the time they were deployed
+*/
+func createReleaseReports(releases []*Release, counts []releaseCount, now time.Time) []ReleaseReport {
+	firstSeen := make(map[string]time.Time)
+	byRelease := make(map[int]map[string]releaseCount)
+	for _, c := range counts {
+		if first, ok := firstSeen[c.exception]; !ok || c.firstSeen.Before(first) {
+			firstSeen[c.exception] = c.firstSeen
+		}
+		if _, ok := byRelease[c.releaseId]; !ok {
+			byRelease[c.releaseId] = make(map[string]releaseCount)
+		}
+		byRelease[c.releaseId][c.exception] = c
+	}
+	// the release before and after each release of the same service, since deploys of services are interleaved
+	previousOf, nextOf := make(map[*Release]*Release), make(map[*Release]*Release)
+	last := make(map[string]*Release)
+	for _, r := range releases {
+		if previous, ok := last[r.Service]; ok {
+			previousOf[r], nextOf[previous] = previous, r
+		}
+		last[r.Service] = r
+	}
+	reports := []ReleaseReport{}
+	for _, r := range releases {
+		report := ReleaseReport{Release: r, New: []ReleaseChange{}, Increased: []ReleaseChange{}}
+		end := now
+		if next, ok := nextOf[r]; ok {
+			end = next.DeployedAt
+		}
+		hours := end.Sub(r.DeployedAt).Hours()
+		for excp, c := range byRelease[r.Id] {
+			change := ReleaseChange{Exception: excp, Count: c.count, After: perHour(c.count, hours)}
+			if !firstSeen[excp].Before(r.DeployedAt) {
+				report.New = append(report.New, change)
+				continue
+			}
+			previous, ok := previousOf[r]
+			if !ok {
+				continue
+			}
+			change.Before = perHour(byRelease[previous.Id][excp].count, r.DeployedAt.Sub(previous.DeployedAt).Hours())
+			if change.After > change.Before {
+				report.Increased = append(report.Increased, change)
+			}
+		}
+		sort.Sort(byCount(report.New))
+		sort.Sort(byCount(report.Increased))
+		reports = append(reports, report)
+	}
+	return reports
+}
+
+func perHour(count int, hours float64) float64 {
+	if hours <= 0 {
+		return float64(count)
+	}
+	return float64(count) / hours
+}
+
+type byCount []ReleaseChange
+
+func (c byCount) Len() int           { return len(c) }
+func (c byCount) Swap(i, j int)      { c[i], c[j] = c[j], c[i] }
+func (c byCount) Less(i, j int) bool { return c[i].Count > c[j].Count }
@@ -0,0 +1,104 @@
+package errord
+
+import (
+	"database/sql"
+	"log"
+	"time"
+)
+
+// SQL_RELEASE_AT selects the release of a service that was active at a time
+const SQL_RELEASE_AT string = `select id from releases where deployed_at <= ? and service = ? order by deployed_at desc limit 1`
+
+type ReleaseStore interface {
+	Add(r *Release) error
+	ReleaseAt(t time.Time) *Release
+	FetchReleases() []*Release
+	FetchReleaseReports() []ReleaseReport
+}
+
+type releaseStore struct {
+	db      *sql.DB
+	service string
+}
+
+/*
+Add records the release. When it is a release of the service of the store, the error events that happened while it was active are
+associated with it
+*/
+func (store *releaseStore) Add(r *Release) error {
+	if err := r.validate(); err != nil {
+		return err
+	}
+	r.DeployedAt = r.DeployedAt.UTC()
+	result, err := store.db.Exec(`insert into releases(version, service, deployed_at) values (?, ?, ?)`, r.Version, r.Service, r.DeployedAt)
+	if err != nil {
+		return err
+	}
+	id, err := result.LastInsertId()
+	if err != nil {
+		return err
+	}
+	r.Id = int(id)
+	if r.Service != store.service {
+		return nil
+	}
+	_, err = store.db.Exec(`update error_events set release_id = (select id from releases where deployed_at <= error_events.event_datetime
+	and service = ? order by deployed_at desc limit 1) where event_datetime >= ?`, store.service, r.DeployedAt)
+	return err
+}
+
+func (store *releaseStore) ReleaseAt(t time.Time) *Release {
+	r := new(Release)
+	err := store.db.QueryRow(`select id, version, service, deployed_at from releases where id = (`+SQL_RELEASE_AT+`)`, t.UTC(), store.service).
+		Scan(&r.Id, &r.Version, &r.Service, &r.DeployedAt)
+	if err == sql.ErrNoRows {
+		return nil
+	} else if err != nil {
+		log.Printf("Failed mapping Release at [%v]: %v\n", t, err)
+		return nil
+	}
+	return r
+}
+
+func (store *releaseStore) FetchReleases() []*Release {
+	var releases []*Release
+	rows, err := store.db.Query(`select id, version, service, deployed_at from releases order by deployed_at`)
+	if err != nil {
+		log.Printf("Failed fetching Releases: %v\n", err)
+		return releases
+	}
+	defer rows.Close()
+	for rows.Next() {
+		r := new(Release)
+		if err := rows.Scan(&r.Id, &r.Version, &r.Service, &r.DeployedAt); err != nil {
+			log.Printf("Failed mapping Release: %v\n", err)
+			continue
+		}
+		releases = append(releases, r)
+	}
+	return releases
+}
+
+func (store *releaseStore) FetchReleaseReports() []ReleaseReport {
+	var counts []releaseCount
+	rows, err := store.db.Query(`select coalesce(release_id, 0), exception, count(*), min(event_datetime) from error_events group by release_id, exception`)
+	if err != nil {
+		log.Printf("Failed counting Error Events per Release: %v\n", err)
+		return []ReleaseReport{}
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var c releaseCount
+		var firstSeen string
+		if err := rows.Scan(&c.releaseId, &c.exception, &c.count, &firstSeen); err != nil {
+			log.Printf("Failed mapping Error Event count: %v\n", err)
+			continue
+		}
+		if c.firstSeen, err = toSQLiteTime(firstSeen); err != nil {
+			log.Printf("Unknown Date format: %v", firstSeen)
+			continue
+		}
+		counts = append(counts, c)
+	}
+	return createReleaseReports(store.FetchReleases(), counts, time.Now())
+}
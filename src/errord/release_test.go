@@ -0,0 +1,117 @@
+package errord
+
+import (
+	"database/sql"
+	"testing"
+)
+
+func TestCreateReleaseReports(t *testing.T) {
+	first := &Release{1, "4.12.0", "recharge", *newTime(2016, 3, 30, 12, 0, 0)}
+	second := &Release{2, "4.12.1", "recharge", *newTime(2016, 3, 31, 12, 0, 0)}
+	now := *newTime(2016, 4, 1, 12, 0, 0)
+	counts := []releaseCount{
+		{1, "SQLException", 24, *newTime(2016, 3, 30, 13, 0, 0)},
+		{2, "SQLException", 48, *newTime(2016, 3, 31, 13, 0, 0)},
+		{1, "UnmarshalException", 24, *newTime(2016, 3, 30, 14, 0, 0)},
+		{2, "UnmarshalException", 12, *newTime(2016, 3, 31, 14, 0, 0)},
+		{2, "SocketTimeoutException", 5, *newTime(2016, 3, 31, 15, 0, 0)},
+	}
+
+	reports := createReleaseReports([]*Release{first, second}, counts, now)
+	if len(reports) != 2 {
+		t.Fatalf("Should create a report per release. Got %v", len(reports))
+	}
+	if len(reports[0].New) != 2 || len(reports[0].Increased) != 0 {
+		t.Errorf("Exceptions seen during the first release are all new. Got %v new and %v increased", len(reports[0].New), len(reports[0].Increased))
+	}
+
+	report := reports[1]
+	if len(report.New) != 1 || report.New[0].Exception != "SocketTimeoutException" {
+		t.Errorf("SocketTimeoutException was first seen in the second release and should be new. Got %v", report.New)
+	}
+	if len(report.Increased) != 1 || report.Increased[0].Exception != "SQLException" {
+		t.Fatalf("SQLException doubled in the second release and should be increased. Got %v", report.Increased)
+	}
+	if report.Increased[0].Before != 1 || report.Increased[0].After != 2 {
+		t.Errorf("SQLException should go from 1/hour to 2/hour. Got %v -> %v", report.Increased[0].Before, report.Increased[0].After)
+	}
+}
+
+func TestReleaseReportsCompareReleasesOfTheSameService(t *testing.T) {
+	first := &Release{1, "4.12.0", "recharge", *newTime(2016, 3, 30, 12, 0, 0)}
+	billing := &Release{2, "2.0.0", "billing", *newTime(2016, 3, 31, 0, 0, 0)}
+	second := &Release{3, "4.12.1", "recharge", *newTime(2016, 3, 31, 12, 0, 0)}
+	nextBilling := &Release{4, "2.0.1", "billing", *newTime(2016, 3, 31, 18, 0, 0)}
+	now := *newTime(2016, 4, 1, 12, 0, 0)
+	counts := []releaseCount{
+		{1, "SQLException", 24, *newTime(2016, 3, 30, 13, 0, 0)},
+		{3, "SQLException", 48, *newTime(2016, 3, 31, 13, 0, 0)},
+	}
+
+	reports := createReleaseReports([]*Release{first, billing, second, nextBilling}, counts, now)
+	report := reports[2]
+	if len(report.Increased) != 1 || report.Increased[0].Before != 1 || report.Increased[0].After != 2 {
+		t.Fatalf("Second release of recharge should be compared with the first one over its whole day. Got %v", report.Increased)
+	}
+	if len(reports[1].New) != 0 || len(reports[3].Increased) != 0 {
+		t.Errorf("Releases of billing should not take the error events of recharge")
+	}
+}
+
+func TestReleaseRequiresVersionAndService(t *testing.T) {
+	if (&Release{Version: "4.12.1"}).validate() != ErrEmptyRelease {
+		t.Errorf("Release without a service should be invalid")
+	}
+	if (&Release{Version: "4.12.1", Service: "recharge"}).validate() != nil {
+		t.Errorf("Release with a version and service should be valid")
+	}
+}
+
+func TestReleasesAreLookedUpPerService(t *testing.T) {
+	db, err := sql.Open("errord-test-releases", "releases")
+	if err != nil {
+		t.Fatalf("Failed opening database: %v", err)
+	}
+	defer db.Close()
+	releasesDriver.execs = nil
+	store := &dbStore{db: db, service: "recharge"}
+
+	if err := store.Releases().Add(&Release{Version: "2.0.0", Service: "billing", DeployedAt: *newTime(2016, 3, 30, 12, 0, 0)}); err != nil {
+		t.Fatalf("Failed adding release of billing: %v", err)
+	}
+	if len(releasesDriver.execs) != 1 {
+		t.Errorf("A release of another service should not be associated with the error events. Got %v statements", len(releasesDriver.execs))
+	}
+
+	releasesDriver.execs = nil
+	if err := store.Releases().Add(&Release{Version: "4.12.1", Service: "recharge", DeployedAt: *newTime(2016, 3, 31, 12, 0, 0)}); err != nil {
+		t.Fatalf("Failed adding release of recharge: %v", err)
+	}
+	if len(releasesDriver.execs) != 2 || !hasArg(releasesDriver.execs[1], "recharge") {
+		t.Errorf("Error events should be associated with the releases of recharge only. Got %v", releasesDriver.execs)
+	}
+
+	releasesDriver.execs = nil
+	now := newTime(2016, 3, 31, 13, 0, 0)
+	if err := store.Errors().Add(&ErrorEvent{Event: Event{Timestamp: now, Level: ERROR_LOG_LEVEL}, Exception: "SQLException"}); err != nil {
+		t.Fatalf("Failed adding error event: %v", err)
+	}
+	if len(releasesDriver.execs) != 1 || !hasArg(releasesDriver.execs[0], "recharge") {
+		t.Errorf("An error event should be associated with the release of recharge at its time. Got %v", releasesDriver.execs)
+	}
+}
+
+var releasesDriver = &recordingDriver{}
+
+func init() {
+	sql.Register("errord-test-releases", releasesDriver)
+}
+
+func hasArg(exec recordedExec, arg string) bool {
+	for _, a := range exec.args {
+		if a == arg {
+			return true
+		}
+	}
+	return false
+}
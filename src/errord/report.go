@@ -0,0 +1,237 @@
+package errord
+
+import (
+	"bytes"
+	"fmt"
+	"html/template"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+const NOTIFY_REPORT NotificationKind = "report"
+
+// REPORT_SOURCE is the source of report notifications so that routes can send reports to their own notifiers
+const REPORT_SOURCE string = "errord.report"
+
+// REPORT_SIZE is how many exceptions are listed in the top exceptions and the biggest movers
+const REPORT_SIZE int = 10
+
+const REPORT_HTML_TEMPLATE string = `<html>
+<body style="font-family: sans-serif">
+<h2>{{.Name}}: {{.Since.Format "2006-01-02 15:04"}} to {{.Until.Format "2006-01-02 15:04"}}</h2>
+<h3>Top exceptions</h3>
+<table border="1" cellpadding="4" cellspacing="0">
+<tr><th>Exception</th><th>Count</th><th>Per day</th><th>Baseline per day</th></tr>
+{{range .Top}}<tr><td>{{.Exception}}</td><td>{{.Count}}</td><td>{{printf "%.1f" .PerDay}}</td><td>{{printf "%.1f" .Baseline}}</td></tr>
+{{else}}<tr><td colspan="4">No exceptions</td></tr>
+{{end}}</table>
+<h3>New exceptions</h3>
+<table border="1" cellpadding="4" cellspacing="0">
+<tr><th>Exception</th><th>Count</th></tr>
+{{range .New}}<tr><td>{{.Exception}}</td><td>{{.Count}}</td></tr>
+{{else}}<tr><td colspan="2">No new exceptions</td></tr>
+{{end}}</table>
+<h3>Biggest movers</h3>
+<table border="1" cellpadding="4" cellspacing="0">
+<tr><th>Exception</th><th>Per day</th><th>Baseline per day</th><th>Change</th></tr>
+{{range .Movers}}<tr><td>{{.Exception}}</td><td>{{printf "%.1f" .PerDay}}</td><td>{{printf "%.1f" .Baseline}}</td><td>{{printf "%.1f" .Change}}x</td></tr>
+{{else}}<tr><td colspan="4">No exceptions above their baseline</td></tr>
+{{end}}</table>
+<h3>Clusters</h3>
+<table border="1" cellpadding="4" cellspacing="0">
+<tr><th>Leading exception</th><th>Related exceptions</th></tr>
+{{range .Clusters}}<tr><td>{{.Lead}}</td><td>{{range $i, $e := .Related}}{{if $i}}, {{end}}{{$e}}{{end}}</td></tr>
+{{else}}<tr><td colspan="2">No correlated exceptions</td></tr>
+{{end}}</table>
+<h3>Resolved issues</h3>
+<table border="1" cellpadding="4" cellspacing="0">
+<tr><th>Fingerprint</th><th>Exception</th><th>Resolved at</th></tr>
+{{range .Resolved}}<tr><td>{{.Fingerprint}}</td><td>{{.Exception}}</td><td>{{.ResolvedAt.Format "2006-01-02 15:04"}}</td></tr>
+{{else}}<tr><td colspan="3">No resolved issues</td></tr>
+{{end}}</table>
+</body>
+</html>
+`
+
+var reportTemplate = template.Must(template.New("report").Parse(REPORT_HTML_TEMPLATE))
+
+// ReportEntry is how often an exception was seen during the report compared to its baseline, the daily mean in event_stats
+type ReportEntry struct {
+	Exception string
+	Count     int
+	PerDay    float64
+	Baseline  float64
+	Change    float64
+}
+
+// ReportCluster is a group of top exceptions that are correlated, led by the exception that was seen first
+type ReportCluster struct {
+	Lead    string
+	Related []string
+}
+
+// Report sums up the exceptions seen between Since and Until
+type Report struct {
+	Name     string
+	Since    time.Time
+	Until    time.Time
+	Top      []ReportEntry
+	New      []ReportEntry
+	Movers   []ReportEntry
+	Clusters []ReportCluster
+	Resolved []*Issue
+}
+
+func CreateReport(name string, stats StatStore, issues IssueStore, errorStore ErrorStore, since, until time.Time) *Report {
+	summaries := stats.FetchSummaries()
+	baselines := make(map[string]*StatItem)
+	for _, s := range summaries {
+		if item := stats.GetStatItem(s.Name); item != nil {
+			baselines[s.Name] = item
+		}
+	}
+	r := createReport(name, summaries, baselines, issues.FetchIssues(), since, until)
+	exceptions := make([]string, len(r.Top))
+	for i, e := range r.Top {
+		exceptions[i] = e.Exception
+	}
+	r.cluster(errorStore.FetchExceptionEvents(since, exceptions))
+	return r
+}
+
+func createReport(name string, summaries []Summary, baselines map[string]*StatItem, issues []*Issue, since, until time.Time) *Report {
+	r := &Report{Name: name, Since: since, Until: until, Top: []ReportEntry{}, New: []ReportEntry{}, Movers: []ReportEntry{}, Clusters: []ReportCluster{}, Resolved: []*Issue{}}
+	days := until.Sub(since).Hours() / 24
+	if days < 1 {
+		days = 1
+	}
+	for _, s := range summaries {
+		entry := ReportEntry{Exception: s.Name}
+		for _, d := range s.DaySummaries {
+			if !d.Date.Before(since.Truncate(24*time.Hour)) && d.Date.Before(until) {
+				entry.Count += d.Total
+			}
+		}
+		if entry.Count == 0 {
+			continue
+		}
+		entry.PerDay = float64(entry.Count) / days
+		if item, ok := baselines[s.Name]; ok && item.Mean > 0 {
+			entry.Baseline = item.Mean
+			entry.Change = entry.PerDay / item.Mean
+		}
+		r.Top = append(r.Top, entry)
+		if !s.StartDate.Before(since.Truncate(24 * time.Hour)) {
+			r.New = append(r.New, entry)
+		}
+		if entry.Change > 1 {
+			r.Movers = append(r.Movers, entry)
+		}
+	}
+	sort.SliceStable(r.Top, func(i, j int) bool { return r.Top[i].Count > r.Top[j].Count })
+	sort.SliceStable(r.New, func(i, j int) bool { return r.New[i].Count > r.New[j].Count })
+	sort.SliceStable(r.Movers, func(i, j int) bool { return r.Movers[i].Change > r.Movers[j].Change })
+	if len(r.Top) > REPORT_SIZE {
+		r.Top = r.Top[:REPORT_SIZE]
+	}
+	if len(r.Movers) > REPORT_SIZE {
+		r.Movers = r.Movers[:REPORT_SIZE]
+	}
+	for _, i := range issues {
+		if i.Status == ISSUE_RESOLVED && i.ResolvedAt != nil && !i.ResolvedAt.Before(since) && i.ResolvedAt.Before(until) {
+			r.Resolved = append(r.Resolved, i)
+		}
+	}
+	return r
+}
+
+// cluster groups the top exceptions whose events of the report are correlated, the same way the ClusterNotifier groups notifications
+func (r *Report) cluster(events []ErrorEvent) {
+	seen := []ErrorEvent{}
+	first := make(map[string]*ErrorNotification)
+	for i, e := range events {
+		if e.Timestamp.Before(r.Since) || !e.Timestamp.Before(r.Until) {
+			continue
+		}
+		seen = append(seen, e)
+		if _, ok := first[e.Exception]; !ok {
+			first[e.Exception] = &ErrorNotification{ErrorEvent: &events[i]}
+		}
+	}
+	notifications := []*ErrorNotification{}
+	for _, e := range r.Top {
+		if n, ok := first[e.Exception]; ok {
+			notifications = append(notifications, n)
+		}
+	}
+	for _, group := range cluster(notifications, Correlate(seen, CORRELATION_BUCKET)) {
+		if len(group) < 2 {
+			continue
+		}
+		c := ReportCluster{Lead: group[0].ErrorEvent.Exception}
+		for _, n := range group[1:] {
+			c.Related = append(c.Related, n.ErrorEvent.Exception)
+		}
+		r.Clusters = append(r.Clusters, c)
+	}
+}
+
+func (r *Report) Subject() string {
+	return fmt.Sprintf("%v: %v to %v", r.Name, r.Since.Format("2006-01-02 15:04"), r.Until.Format("2006-01-02 15:04"))
+}
+
+func (r *Report) Text() string {
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "%v\n", r.Subject())
+	w := tabwriter.NewWriter(&b, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(w, "\nTop exceptions\nEXCEPTION\tCOUNT\tPER DAY\tBASELINE PER DAY")
+	for _, e := range r.Top {
+		fmt.Fprintf(w, "%v\t%v\t%.1f\t%.1f\n", e.Exception, e.Count, e.PerDay, e.Baseline)
+	}
+	fmt.Fprintln(w, "\nNew exceptions\nEXCEPTION\tCOUNT")
+	for _, e := range r.New {
+		fmt.Fprintf(w, "%v\t%v\n", e.Exception, e.Count)
+	}
+	fmt.Fprintln(w, "\nBiggest movers\nEXCEPTION\tPER DAY\tBASELINE PER DAY\tCHANGE")
+	for _, e := range r.Movers {
+		fmt.Fprintf(w, "%v\t%.1f\t%.1f\t%.1fx\n", e.Exception, e.PerDay, e.Baseline, e.Change)
+	}
+	fmt.Fprintln(w, "\nClusters\nLEADING EXCEPTION\tRELATED EXCEPTIONS")
+	for _, c := range r.Clusters {
+		fmt.Fprintf(w, "%v\t%v\n", c.Lead, strings.Join(c.Related, ", "))
+	}
+	fmt.Fprintln(w, "\nResolved issues\nFINGERPRINT\tEXCEPTION\tRESOLVED AT")
+	for _, i := range r.Resolved {
+		fmt.Fprintf(w, "%v\t%v\t%v\n", i.Fingerprint, i.Exception, i.ResolvedAt.Format("2006-01-02 15:04"))
+	}
+	w.Flush()
+	return b.String()
+}
+
+func (r *Report) HTML() (string, error) {
+	var b bytes.Buffer
+	err := reportTemplate.Execute(&b, r)
+	return b.String(), err
+}
+
+// Notification wraps the report so that it can be sent by any notifier
+func (r *Report) Notification() *ErrorNotification {
+	until := r.Until
+	event := &ErrorEvent{Event: Event{Timestamp: &until, Level: INFO_LOG_LEVEL, Source: REPORT_SOURCE, Description: r.Subject()}, Exception: r.Name}
+	return &ErrorNotification{ErrorEvent: event, Kind: NOTIFY_REPORT, Report: r}
+}
+
+// ParsePeriod parses a duration like time.ParseDuration but also accepts days, for example 7d
+func ParsePeriod(s string) (time.Duration, error) {
+	if strings.HasSuffix(s, "d") {
+		days, err := strconv.Atoi(strings.TrimSuffix(s, "d"))
+		if err != nil {
+			return 0, fmt.Errorf("Invalid period: '%v'", s)
+		}
+		return time.Duration(days) * 24 * time.Hour, nil
+	}
+	return time.ParseDuration(s)
+}
@@ -0,0 +1,85 @@
+package errord
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"log"
+	"time"
+)
+
+// ReportSchedule sends a report of the last Period every time the Cron expression matches
+type ReportSchedule struct {
+	Name     string
+	Cron     string
+	Period   string
+	schedule *CronSchedule
+	period   time.Duration
+}
+
+type ReportScheduler struct {
+	schedules  []*ReportSchedule
+	notifier   Notifier
+	stats      StatStore
+	issues     IssueStore
+	errorStore ErrorStore
+}
+
+func ReadReportSchedules(path string) ([]*ReportSchedule, error) {
+	var schedules []*ReportSchedule
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return schedules, err
+	}
+	err = json.Unmarshal(content, &schedules)
+	return schedules, err
+}
+
+func NewReportScheduler(schedules []*ReportSchedule, n Notifier, stats StatStore, issues IssueStore, errorStore ErrorStore) (*ReportScheduler, error) {
+	for _, s := range schedules {
+		var err error
+		if s.schedule, err = ParseCron(s.Cron); err != nil {
+			return nil, err
+		}
+		if s.Period == "" {
+			s.Period = "24h"
+		}
+		if s.period, err = ParsePeriod(s.Period); err != nil {
+			return nil, err
+		}
+		if s.Name == "" {
+			s.Name = "Error report"
+		}
+	}
+	r := new(ReportScheduler)
+	r.schedules = schedules
+	r.notifier = n
+	r.stats = stats
+	r.issues = issues
+	r.errorStore = errorStore
+	return r, nil
+}
+
+// Watch sends the reports of every schedule when they are due
+func (r *ReportScheduler) Watch() {
+	for _, s := range r.schedules {
+		go func(s *ReportSchedule) {
+			for {
+				next := s.schedule.Next(time.Now())
+				if next.IsZero() {
+					log.Printf("Report [%v] with schedule [%v] will never be sent\n", s.Name, s.Cron)
+					return
+				}
+				log.Printf("Next report [%v] at %v\n", s.Name, next)
+				time.Sleep(time.Until(next))
+				r.send(s, next)
+			}
+		}(s)
+	}
+}
+
+func (r *ReportScheduler) send(s *ReportSchedule, at time.Time) {
+	report := CreateReport(s.Name, r.stats, r.issues, r.errorStore, at.Add(-s.period), at)
+	if err := r.notifier.Fire(report.Notification()); err != nil {
+		log.Printf("Failed sending report [%v]: %v\n", s.Name, err)
+	}
+}
@@ -0,0 +1,86 @@
+package errord
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func newTestSummary(name string, first time.Time, totals ...int) Summary {
+	s := Summary{Name: name, StartDate: first}
+	for i, total := range totals {
+		s.DaySummaries = append(s.DaySummaries, &DaySummary{Date: first.AddDate(0, 0, i), Name: name, Total: total})
+	}
+	return s
+}
+
+func TestCreateReport(t *testing.T) {
+	until := time.Date(2016, 4, 8, 0, 0, 0, 0, time.UTC)
+	since := until.AddDate(0, 0, -7)
+	resolvedAt := time.Date(2016, 4, 5, 10, 0, 0, 0, time.UTC)
+	summaries := []Summary{
+		newTestSummary("SQLException", time.Date(2016, 3, 1, 0, 0, 0, 0, time.UTC), 10, 10, 10),
+		newTestSummary("TimeoutException", time.Date(2016, 3, 30, 0, 0, 0, 0, time.UTC), 1, 1, 1, 1, 1, 1, 1, 1, 70),
+		newTestSummary("NullPointerException", time.Date(2016, 4, 6, 0, 0, 0, 0, time.UTC), 3),
+	}
+	baselines := map[string]*StatItem{"TimeoutException": {Mean: 2}, "SQLException": {Mean: 10}}
+	issues := []*Issue{
+		{Fingerprint: "abc", Exception: "SQLException", Status: ISSUE_RESOLVED, ResolvedAt: &resolvedAt},
+		{Fingerprint: "def", Exception: "TimeoutException", Status: ISSUE_UNRESOLVED},
+	}
+
+	report := createReport("Weekly", summaries, baselines, issues, since, until)
+	if len(report.Top) != 2 || report.Top[0].Exception != "TimeoutException" || report.Top[0].Count != 76 {
+		t.Errorf("Top exceptions should only count days in the report, most seen first. Got %v", report.Top)
+	}
+	if len(report.New) != 1 || report.New[0].Exception != "NullPointerException" {
+		t.Errorf("Only exceptions first seen during the report should be new. Got %v", report.New)
+	}
+	if len(report.Movers) != 1 || report.Movers[0].Exception != "TimeoutException" || report.Movers[0].Change < 5 {
+		t.Errorf("Exceptions seen more than their baseline should be movers. Got %v", report.Movers)
+	}
+	if len(report.Resolved) != 1 || report.Resolved[0].Fingerprint != "abc" {
+		t.Errorf("Issues resolved during the report should be listed. Got %v", report.Resolved)
+	}
+
+	if text := report.Text(); !strings.Contains(text, "Biggest movers") || !strings.Contains(text, "NullPointerException") {
+		t.Errorf("Text report should list the sections. Got %v", text)
+	}
+	html, err := report.HTML()
+	if err != nil || !strings.Contains(html, "<td>TimeoutException</td><td>76</td>") {
+		t.Errorf("HTML report should have a table of the top exceptions. Got %v %v", err, html)
+	}
+	if n := report.Notification(); n.Subject() != report.Subject() || n.ErrorEvent.Source != REPORT_SOURCE {
+		t.Errorf("Report notification should describe the report. Got %v", n.Subject())
+	}
+}
+
+func TestParsePeriod(t *testing.T) {
+	if d, err := ParsePeriod("7d"); err != nil || d != 7*24*time.Hour {
+		t.Errorf("7d should be a week. Got %v %v", d, err)
+	}
+	if d, err := ParsePeriod("36h"); err != nil || d != 36*time.Hour {
+		t.Errorf("Durations should still parse. Got %v %v", d, err)
+	}
+}
+
+func TestReportClustersTopExceptions(t *testing.T) {
+	since := *newTime(2016, 3, 31, 0, 0, 0)
+	report := &Report{Since: since, Until: since.AddDate(0, 0, 1), Clusters: []ReportCluster{}}
+	for _, name := range []string{"SQLException", "ConnectionException", "UnmarshalException"} {
+		report.Top = append(report.Top, ReportEntry{Exception: name})
+	}
+	report.cluster([]ErrorEvent{
+		newErrorEvent("ConnectionException", newTime(2016, 3, 31, 12, 0, 0)),
+		newErrorEvent("SQLException", newTime(2016, 3, 31, 12, 0, 10)),
+		newErrorEvent("UnmarshalException", newTime(2016, 3, 31, 12, 2, 0)),
+		newErrorEvent("ConnectionException", newTime(2016, 3, 31, 12, 5, 0)),
+		newErrorEvent("SQLException", newTime(2016, 3, 31, 12, 5, 10)),
+	})
+	if len(report.Clusters) != 1 || report.Clusters[0].Lead != "ConnectionException" || len(report.Clusters[0].Related) != 1 {
+		t.Fatalf("Correlated exceptions should be a cluster led by the exception seen first. Got %+v", report.Clusters)
+	}
+	if text := report.Text(); !strings.Contains(text, "ConnectionException  SQLException") {
+		t.Errorf("Text report should list the clusters. Got %v", text)
+	}
+}
@@ -0,0 +1,246 @@
+package errord
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"regexp"
+	"strings"
+	"time"
+)
+
+const HOURS_BUSINESS string = "business"
+const HOURS_AFTER string = "after"
+
+var SEVERITY_RANK = map[string]int{SEVERITY_INFO: 0, SEVERITY_WARNING: 1, SEVERITY_ERROR: 2, SEVERITY_CRITICAL: 3}
+
+/*
+A Route sends the notifications it matches to its Targets. Exception and Source are regular expressions, Level must match exactly
+and Severity is the lowest severity that matches. Hours is "business" or "after" to only match during or outside of business hours.
+Empty fields match anything. When a target fails the Fallbacks are tried in order until one succeeds. Escalation names the
+escalation policy that escalates the incidents of the route until they are acknowledged.
+
+Routes are matched in order and the first route that matches wins unless it has Continue set
+*/
+type Route struct {
+	Exception  string
+	Source     string
+	Level      Level
+	Service    string
+	Severity   string
+	Hours      string
+	Targets    []string
+	Fallbacks  []string
+	Continue   bool
+	Escalation string
+	exception  *regexp.Regexp
+	source     *regexp.Regexp
+}
+
+type BusinessHours struct {
+	Start string
+	End   string
+	Days  []string
+	start time.Duration
+	end   time.Duration
+}
+
+/*
+Router dispatches each notification to the named notifiers of the routes it matches. Notifications that match no route go to the
+default notifiers. A notification is only recorded as sent once every target, or its fallback, succeeded so that failed targets are
+tried again while targets that succeeded skip it through their own scoped NotifyStore
+*/
+type Router struct {
+	notifiers   map[string]Notifier
+	routes      []*Route
+	defaults    []string
+	service     string
+	hours       *BusinessHours
+	store       NotifyStore
+	escalations map[string]*EscalationPolicy
+	incidents   IncidentStore
+	links       *AckLinks
+	escalator   Notifier
+	now         func() time.Time
+}
+
+func NewRouter(notifiers map[string]Notifier, routes []*Route, defaults []string, service string, hours *BusinessHours, store NotifyStore, links *AckLinks) (*Router, error) {
+	for _, r := range routes {
+		if err := r.compile(); err != nil {
+			return nil, err
+		}
+		if err := checkTargets(notifiers, r.Targets, r.Fallbacks); err != nil {
+			return nil, err
+		}
+	}
+	if err := checkTargets(notifiers, defaults); err != nil {
+		return nil, err
+	}
+	if hours == nil {
+		hours = new(BusinessHours)
+	}
+	if err := hours.parse(); err != nil {
+		return nil, err
+	}
+	r := new(Router)
+	r.notifiers = notifiers
+	r.routes = routes
+	r.defaults = defaults
+	r.service = service
+	r.hours = hours
+	r.store = store
+	r.links = links
+	r.escalator = r
+	r.now = time.Now
+	return r, nil
+}
+
+func (r *Router) Fire(n *ErrorNotification) error {
+	if n.Kind == NOTIFY_ESCALATED && n.Escalation != nil && n.Escalation.Step > 0 {
+		return r.fireEscalation(n)
+	}
+	failed := []string{}
+	for _, route := range r.match(n) {
+		r.startEscalation(route, n)
+		for _, target := range route.Targets {
+			if err := r.fire(target, route.Fallbacks, n); err != nil {
+				failed = append(failed, target)
+			}
+		}
+	}
+	if len(failed) > 0 {
+		return fmt.Errorf("Failed notifying %v", strings.Join(failed, ", "))
+	}
+	// Every target records what it sent in its own scope. Recording it unscoped as well keeps the cluster notifier from regrouping it
+	markSent(r.store, n)
+	return nil
+}
+
+// fire notifies the target and falls back to the fallbacks in order when it fails
+func (r *Router) fire(target string, fallbacks []string, n *ErrorNotification) error {
+	err := r.notifiers[target].Fire(n)
+	if err == nil {
+		return nil
+	}
+	log.Printf("Notifier [%v] failed: %v\n", target, err)
+	for _, fallback := range fallbacks {
+		if fallback == target {
+			continue
+		}
+		log.Printf("Falling back to notifier [%v]\n", fallback)
+		if err = r.notifiers[fallback].Fire(n); err == nil {
+			return nil
+		}
+		log.Printf("Fallback notifier [%v] failed: %v\n", fallback, err)
+	}
+	return err
+}
+
+func checkTargets(notifiers map[string]Notifier, targets ...[]string) error {
+	for _, names := range targets {
+		for _, name := range names {
+			if _, ok := notifiers[name]; !ok {
+				return fmt.Errorf("Unknown notifier: '%v'", name)
+			}
+		}
+	}
+	return nil
+}
+
+func (r *Router) match(n *ErrorNotification) []*Route {
+	matched := []*Route{}
+	now := r.now()
+	for _, route := range r.routes {
+		if !route.matches(n, r.service, r.hours.contains(now)) {
+			continue
+		}
+		matched = append(matched, route)
+		if !route.Continue {
+			return matched
+		}
+	}
+	if len(matched) == 0 {
+		matched = append(matched, &Route{Targets: r.defaults})
+	}
+	return matched
+}
+
+func (route *Route) compile() error {
+	var err error
+	if route.Exception != "" {
+		if route.exception, err = regexp.Compile(route.Exception); err != nil {
+			return err
+		}
+	}
+	if route.Source != "" {
+		if route.source, err = regexp.Compile(route.Source); err != nil {
+			return err
+		}
+	}
+	if _, ok := SEVERITY_RANK[route.Severity]; route.Severity != "" && !ok {
+		return fmt.Errorf("Unknown route severity: '%v'", route.Severity)
+	}
+	if route.Hours != "" && route.Hours != HOURS_BUSINESS && route.Hours != HOURS_AFTER {
+		return fmt.Errorf("Route hours must be '%v' or '%v'. Got '%v'", HOURS_BUSINESS, HOURS_AFTER, route.Hours)
+	}
+	if len(route.Targets) == 0 {
+		return errors.New("Route requires at least one target")
+	}
+	return nil
+}
+
+func (route *Route) matches(n *ErrorNotification, service string, businessHours bool) bool {
+	e := n.ErrorEvent
+	switch {
+	case route.exception != nil && !route.exception.MatchString(e.Exception):
+		return false
+	case route.source != nil && !route.source.MatchString(e.Source):
+		return false
+	case route.Level != EMPTY_LOG_LEVEL && route.Level != e.Level:
+		return false
+	case route.Service != "" && route.Service != service:
+		return false
+	case route.Severity != "" && SEVERITY_RANK[n.Severity()] < SEVERITY_RANK[route.Severity]:
+		return false
+	case route.Hours == HOURS_BUSINESS && !businessHours:
+		return false
+	case route.Hours == HOURS_AFTER && businessHours:
+		return false
+	}
+	return true
+}
+
+// parse reads Start and End as 15:04. Without Days business hours are Monday to Friday and without Start and End they are 08:00 to 17:00
+func (h *BusinessHours) parse() error {
+	if h.Start == "" {
+		h.Start = "08:00"
+	}
+	if h.End == "" {
+		h.End = "17:00"
+	}
+	if len(h.Days) == 0 {
+		h.Days = []string{"Mon", "Tue", "Wed", "Thu", "Fri"}
+	}
+	start, err := time.Parse("15:04", h.Start)
+	if err != nil {
+		return err
+	}
+	end, err := time.Parse("15:04", h.End)
+	if err != nil {
+		return err
+	}
+	h.start = time.Duration(start.Hour())*time.Hour + time.Duration(start.Minute())*time.Minute
+	h.end = time.Duration(end.Hour())*time.Hour + time.Duration(end.Minute())*time.Minute
+	return nil
+}
+
+func (h *BusinessHours) contains(t time.Time) bool {
+	day := false
+	for _, d := range h.Days {
+		if strings.HasPrefix(t.Weekday().String(), d) {
+			day = true
+		}
+	}
+	sinceMidnight := time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute
+	return day && sinceMidnight >= h.start && sinceMidnight < h.end
+}
@@ -0,0 +1,127 @@
+package errord
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+type failingNotifier struct {
+	attempts int
+}
+
+func (f *failingNotifier) Fire(n *ErrorNotification) error {
+	f.attempts++
+	return errors.New("unavailable")
+}
+
+func newTestRouter(t *testing.T, notifiers map[string]Notifier, routes []*Route, defaults []string) (*Router, *memNotifyStore) {
+	store := newMemNotifyStore()
+	router, err := NewRouter(notifiers, routes, defaults, "billing", &BusinessHours{Start: "08:00", End: "17:00"}, store, nil)
+	if err != nil {
+		t.Fatalf("Valid routes should not return an error: %v", err)
+	}
+	// Thursday
+	router.now = func() time.Time { return *newTime(2016, 3, 31, 12, 0, 0) }
+	return router, store
+}
+
+func TestRouterFirstMatchingRouteWins(t *testing.T) {
+	slack, pager, email := &recordingNotifier{}, &recordingNotifier{}, &recordingNotifier{}
+	routes := []*Route{
+		{Exception: `^java\.sql\.`, Targets: []string{"pager"}},
+		{Exception: `Exception$`, Targets: []string{"slack"}},
+	}
+	router, store := newTestRouter(t, map[string]Notifier{"slack": slack, "pager": pager, "email": email}, routes, []string{"email"})
+
+	notification := newTestNotification()
+	if err := router.Fire(notification); err != nil {
+		t.Fatalf("Fire should not fail when the targets succeed: %v", err)
+	}
+	if len(pager.fired) != 1 || len(slack.fired) != 0 || len(email.fired) != 0 {
+		t.Errorf("Only the first matching route should be notified. Got pager %v slack %v email %v", len(pager.fired), len(slack.fired), len(email.fired))
+	}
+	if !store.HasNotification(notification) {
+		t.Errorf("Notification should be recorded as sent once every target succeeded")
+	}
+
+	event := newErrorEvent("TimeoutError", newTime(2016, 3, 31, 12, 0, 0))
+	router.Fire(&ErrorNotification{ErrorEvent: &event})
+	if len(email.fired) != 1 {
+		t.Errorf("Notification matching no route should go to the default notifiers")
+	}
+}
+
+func TestRouterContinueNotifiesSeveralTargets(t *testing.T) {
+	slack, pager := &recordingNotifier{}, &recordingNotifier{}
+	routes := []*Route{
+		{Service: "billing", Targets: []string{"slack"}, Continue: true},
+		{Hours: HOURS_AFTER, Targets: []string{"pager"}},
+		{Level: ERROR_LOG_LEVEL, Targets: []string{"pager"}},
+	}
+	router, _ := newTestRouter(t, map[string]Notifier{"slack": slack, "pager": pager}, routes, nil)
+
+	router.Fire(newTestNotification())
+	if len(slack.fired) != 1 || len(pager.fired) != 1 {
+		t.Errorf("Route with Continue should let later routes match too. Got slack %v pager %v", len(slack.fired), len(pager.fired))
+	}
+
+	router.now = func() time.Time { return *newTime(2016, 4, 2, 12, 0, 0) }
+	router.Fire(newTestNotification())
+	if len(pager.fired) != 2 {
+		t.Errorf("Saturday should be after hours")
+	}
+}
+
+func TestRouterSeverityMatchesAtLeast(t *testing.T) {
+	route := &Route{Severity: SEVERITY_ERROR, Targets: []string{"pager"}}
+	if err := route.compile(); err != nil {
+		t.Fatalf("Valid route should compile: %v", err)
+	}
+	notification := newTestNotification()
+	if !route.matches(notification, "", true) {
+		t.Errorf("Error severity should match a route for at least error")
+	}
+	notification.ErrorEvent.Level = Level("WARN")
+	if route.matches(notification, "", true) {
+		t.Errorf("Warning severity should not match a route for at least error")
+	}
+	notification.Rule = &Rule{Action: RULE_ALWAYS}
+	if !route.matches(notification, "", true) {
+		t.Errorf("Critical severity should match a route for at least error")
+	}
+}
+
+func TestRouterFallsBack(t *testing.T) {
+	pager, sms, email := &failingNotifier{}, &failingNotifier{}, &recordingNotifier{}
+	routes := []*Route{{Targets: []string{"pager"}, Fallbacks: []string{"sms", "email"}}}
+	router, store := newTestRouter(t, map[string]Notifier{"pager": pager, "sms": sms, "email": email}, routes, nil)
+
+	notification := newTestNotification()
+	if err := router.Fire(notification); err != nil {
+		t.Errorf("Fire should succeed when a fallback succeeds: %v", err)
+	}
+	if pager.attempts != 1 || sms.attempts != 1 || len(email.fired) != 1 {
+		t.Errorf("Fallbacks should be tried in order. Got pager %v sms %v email %v", pager.attempts, sms.attempts, len(email.fired))
+	}
+
+	routes = []*Route{{Targets: []string{"pager"}, Fallbacks: []string{"sms"}}}
+	router, store = newTestRouter(t, map[string]Notifier{"pager": pager, "sms": sms}, routes, nil)
+	if err := router.Fire(notification); err == nil {
+		t.Errorf("Fire should fail when the target and its fallbacks fail")
+	}
+	if store.HasNotification(notification) {
+		t.Errorf("Failed notification should not be recorded as sent")
+	}
+}
+
+func TestNewRouterRejectsUnknownTargets(t *testing.T) {
+	routes := []*Route{{Targets: []string{"pager"}}}
+	if _, err := NewRouter(map[string]Notifier{"slack": &recordingNotifier{}}, routes, nil, "", nil, newMemNotifyStore(), nil); err == nil {
+		t.Errorf("Route to an unknown notifier should return an error")
+	}
+	routes = []*Route{{Hours: "weekends", Targets: []string{"slack"}}}
+	if _, err := NewRouter(map[string]Notifier{"slack": &recordingNotifier{}}, routes, nil, "", nil, newMemNotifyStore(), nil); err == nil {
+		t.Errorf("Unknown hours should return an error")
+	}
+}
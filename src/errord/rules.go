@@ -0,0 +1,305 @@
+package errord
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+type RuleAction string
+
+const RULE_DEFAULT RuleAction = ""
+const RULE_ALWAYS RuleAction = "always"
+const RULE_IGNORE RuleAction = "ignore"
+const RULE_RATE RuleAction = "rate"
+const RULE_SIGMA RuleAction = "sigma"
+
+var ErrUnknownRuleAction error = errors.New("Rule action must be one of 'always', 'ignore', 'rate' or 'sigma'")
+var ErrEmptyRule error = errors.New("Rule must match on at least an Exception or a Source")
+var ErrInvalidRateLimit error = errors.New("Rate rule requires a Limit of at least 1")
+
+// DEFAULT_ALWAYS_WINDOW is how long an always rule without a Window waits before it notifies of the same exception again
+const DEFAULT_ALWAYS_WINDOW time.Duration = time.Hour
+
+// RATE_BUCKETS is how many buckets the window of a rule is counted in. The window moves on a bucket at a time
+const RATE_BUCKETS int64 = 60
+
+/*
+A Rule overrides the statistical detector for the exceptions it matches. Exception and Source are matched either
+exactly or on the last part of the name, so "SQLException" matches "java.sql.SQLException". An empty field matches anything.
+
+Always and rate rules notify once when an exception goes over the Limit in the Window, an always rule on the first occurrence, and
+again once the Window has passed or the count dropped back to the Limit.
+
+Rules are evaluated in the order they are defined and the first rule that matches wins
+*/
+type Rule struct {
+	Exception string
+	Source    string
+	Action    RuleAction
+	Limit     int
+	Window    string
+	Sigma     float64
+	window    time.Duration
+}
+
+// RuleDecision is the action of the rule that matched an event. Notify is only true for the event that crossed the limit of the rule
+type RuleDecision struct {
+	Rule   *Rule
+	Action RuleAction
+	Count  int
+	Notify bool
+}
+
+// ruleCount counts the events of a rule key in fixed buckets of the window, by bucket number since the epoch
+type ruleCount struct {
+	buckets  map[int64]int
+	size     time.Duration
+	last     int64
+	notified time.Time
+}
+
+type ruleConfig struct {
+	Rules []*Rule
+}
+
+type RuleSet struct {
+	path    string
+	modTime time.Time
+	rules   []*Rule
+	counts  map[string]*ruleCount
+	pruned  time.Time
+	lock    sync.Mutex
+}
+
+func LoadRuleSet(path string) (*RuleSet, error) {
+	r := new(RuleSet)
+	r.path = path
+	r.counts = make(map[string]*ruleCount)
+	return r, r.Reload()
+}
+
+// Reload reads the rules from disk. When the rules are invalid the previously loaded rules are kept
+func (r *RuleSet) Reload() error {
+	info, err := os.Stat(r.path)
+	if err != nil {
+		return err
+	}
+	content, err := ioutil.ReadFile(r.path)
+	if err != nil {
+		return err
+	}
+	var config ruleConfig
+	if err := json.Unmarshal(content, &config); err != nil {
+		return err
+	}
+	for _, rule := range config.Rules {
+		if err := rule.validate(); err != nil {
+			return err
+		}
+	}
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.rules = config.Rules
+	r.modTime = info.ModTime()
+	log.Printf("Loaded %v rules from %v\n", len(r.rules), r.path)
+	return nil
+}
+
+// WatchForChanges reloads the rules whenever the modification time of the rule file changes
+func (r *RuleSet) WatchForChanges(interval time.Duration) {
+	go func() {
+		for range time.Tick(interval) {
+			info, err := os.Stat(r.path)
+			if err != nil {
+				log.Printf("Failed checking rule file %v for changes: %v\n", r.path, err)
+				continue
+			}
+			r.lock.Lock()
+			changed := !info.ModTime().Equal(r.modTime)
+			r.lock.Unlock()
+			if !changed {
+				continue
+			}
+			if err := r.Reload(); err != nil {
+				log.Printf("Failed reloading rules from %v. Keeping previous rules: %v\n", r.path, err)
+			}
+		}
+	}()
+}
+
+func (r *RuleSet) Evaluate(e *ErrorEvent) RuleDecision {
+	if r == nil {
+		return RuleDecision{}
+	}
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	for _, rule := range r.rules {
+		if !rule.matches(e) {
+			continue
+		}
+		decision := RuleDecision{Rule: rule, Action: rule.Action}
+		if rule.Action == RULE_RATE || rule.Action == RULE_ALWAYS {
+			decision.Count, decision.Notify = r.count(rule, e)
+		}
+		return decision
+	}
+	return RuleDecision{}
+}
+
+// MaxWindow is the longest window of the always and rate rules
+func (r *RuleSet) MaxWindow() time.Duration {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	var max time.Duration
+	for _, rule := range r.rules {
+		if (rule.Action == RULE_RATE || rule.Action == RULE_ALWAYS) && rule.window > max {
+			max = rule.window
+		}
+	}
+	return max
+}
+
+/*
+Seed counts the events seen before errord started in the windows of the always and rate rules, oldest first, so that a restart
+does not reset the windows or notify again of exceptions that were already over the limit. Events stored by older versions have no
+source and are not counted by rules on a Source
+*/
+func (r *RuleSet) Seed(events []ErrorEvent) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	for i := range events {
+		for _, rule := range r.rules {
+			if rule.matches(&events[i]) {
+				if rule.Action == RULE_RATE || rule.Action == RULE_ALWAYS {
+					r.count(rule, &events[i])
+				}
+				break
+			}
+		}
+	}
+}
+
+// count adds the event to the buckets of its rule key. It notifies when the count crosses the limit of the rule, once per window
+func (r *RuleSet) count(rule *Rule, e *ErrorEvent) (int, bool) {
+	key := rule.Exception + "|" + rule.Source + "|" + e.Exception
+	now := time.Now()
+	if e.Timestamp != nil {
+		now = *e.Timestamp
+	}
+	r.prune(now)
+	c, ok := r.counts[key]
+	if !ok {
+		c = &ruleCount{buckets: make(map[int64]int), size: rule.window / time.Duration(RATE_BUCKETS)}
+		r.counts[key] = c
+	}
+	bucket := c.bucket(now)
+	c.buckets[bucket]++
+	if bucket > c.last {
+		c.last = bucket
+	}
+	total := 0
+	for b, n := range c.buckets {
+		if b <= c.last-RATE_BUCKETS {
+			delete(c.buckets, b)
+			continue
+		}
+		total += n
+	}
+	if total <= rule.Limit {
+		c.notified = time.Time{}
+		return total, false
+	}
+	if !c.notified.IsZero() && now.Sub(c.notified) < rule.window {
+		return total, false
+	}
+	c.notified = now
+	return total, true
+}
+
+// prune forgets the keys whose buckets have all left the window, at most once a minute
+func (r *RuleSet) prune(now time.Time) {
+	if now.Sub(r.pruned) < time.Minute {
+		return
+	}
+	r.pruned = now
+	for key, c := range r.counts {
+		if c.bucket(now)-c.last >= RATE_BUCKETS {
+			delete(r.counts, key)
+		}
+	}
+}
+
+func (c *ruleCount) bucket(t time.Time) int64 {
+	if c.size <= 0 {
+		return t.UnixNano()
+	}
+	return t.UnixNano() / int64(c.size)
+}
+
+func (rule *Rule) validate() error {
+	if rule.Exception == "" && rule.Source == "" {
+		return ErrEmptyRule
+	}
+	switch rule.Action {
+	case RULE_IGNORE:
+	case RULE_ALWAYS:
+		rule.window = DEFAULT_ALWAYS_WINDOW
+		if rule.Window != "" {
+			window, err := time.ParseDuration(rule.Window)
+			if err != nil {
+				return err
+			}
+			rule.window = window
+		}
+	case RULE_RATE:
+		if rule.Limit < 1 {
+			return ErrInvalidRateLimit
+		}
+		window, err := time.ParseDuration(rule.Window)
+		if err != nil {
+			return err
+		}
+		rule.window = window
+	case RULE_SIGMA:
+		if rule.Sigma <= 0 {
+			return errors.New("Sigma rule requires a Sigma greater than 0")
+		}
+	default:
+		return ErrUnknownRuleAction
+	}
+	return nil
+}
+
+func (rule *Rule) matches(e *ErrorEvent) bool {
+	return matchesName(rule.Exception, e.Exception) && matchesName(rule.Source, e.Source)
+}
+
+func (rule *Rule) describe() string {
+	switch rule.Action {
+	case RULE_RATE:
+		return fmt.Sprintf("more than %v per %v", rule.Limit, rule.Window)
+	default:
+		return string(rule.Action)
+	}
+}
+
+func (d RuleDecision) sigma() float64 {
+	if d.Action == RULE_SIGMA {
+		return d.Rule.Sigma
+	}
+	return 1
+}
+
+func matchesName(pattern, name string) bool {
+	if pattern == "" {
+		return true
+	}
+	return pattern == name || strings.HasSuffix(name, "."+pattern)
+}
@@ -0,0 +1,166 @@
+package errord
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+)
+
+const TEST_RULES string = `{
+	"Rules": [
+		{"Exception": "ClientAbortException", "Action": "ignore"},
+		{"Exception": "SQLException", "Source": "client.AirtelService", "Action": "sigma", "Sigma": 3},
+		{"Exception": "SocketTimeoutException", "Action": "rate", "Limit": 2, "Window": "1h"},
+		{"Exception": "OutOfMemoryError", "Action": "always"}
+	]
+}`
+
+func writeRules(t *testing.T, content string) string {
+	file, err := ioutil.TempFile("", "rules")
+	if err != nil {
+		t.Fatalf("Failed creating rules file: %v", err)
+	}
+	defer file.Close()
+	file.WriteString(content)
+	return file.Name()
+}
+
+func TestRuleSetEvaluate(t *testing.T) {
+	path := writeRules(t, TEST_RULES)
+	defer os.Remove(path)
+	rules, err := LoadRuleSet(path)
+	if err != nil {
+		t.Fatalf("Valid rules should load without an error. Got [%v]", err)
+	}
+
+	event := &ErrorEvent{Exception: "org.apache.catalina.connector.ClientAbortException"}
+	if d := rules.Evaluate(event); d.Action != RULE_IGNORE {
+		t.Errorf("Exception should match on its simple class name. Got [%v]", d.Action)
+	}
+
+	event = &ErrorEvent{Exception: "java.sql.SQLException"}
+	if d := rules.Evaluate(event); d.Action != RULE_DEFAULT {
+		t.Errorf("SQLException from another source should not match the sigma rule. Got [%v]", d.Action)
+	}
+	event.Source = "client.AirtelService"
+	if d := rules.Evaluate(event); d.Action != RULE_SIGMA || d.sigma() != 3 {
+		t.Errorf("SQLException from client.AirtelService should use 3 sigma. Got [%v] [%v]", d.Action, d.sigma())
+	}
+
+	event = &ErrorEvent{Event: Event{Timestamp: newTime(2016, 3, 31, 12, 0, 0)}, Exception: "java.net.SocketTimeoutException"}
+	rules.Evaluate(event)
+	d := rules.Evaluate(event)
+	if d.Notify {
+		t.Errorf("Rate rule should not notify when the count equals the limit. Got count [%v]", d.Count)
+	}
+	if d = rules.Evaluate(event); !d.Notify {
+		t.Errorf("Rate rule should notify when the count is more than the limit. Got count [%v]", d.Count)
+	}
+	if d = rules.Evaluate(event); d.Count != 4 || d.Notify {
+		t.Errorf("Rate rule should only notify when the count crosses the limit. Got count [%v]", d.Count)
+	}
+	event.Timestamp = newTime(2016, 3, 31, 14, 0, 0)
+	if d = rules.Evaluate(event); d.Count != 1 || len(rules.counts) != 1 {
+		t.Errorf("Occurrences outside of the window should not be counted. Got count [%v] of %v keys", d.Count, len(rules.counts))
+	}
+}
+
+func TestRuleSetNotifiesOncePerWindow(t *testing.T) {
+	path := writeRules(t, TEST_RULES)
+	defer os.Remove(path)
+	rules, _ := LoadRuleSet(path)
+
+	event := &ErrorEvent{Event: Event{Timestamp: newTime(2016, 3, 31, 12, 0, 0)}, Exception: "java.lang.OutOfMemoryError"}
+	if d := rules.Evaluate(event); !d.Notify {
+		t.Errorf("Always rule should notify on the first occurrence")
+	}
+	for _, minute := range []int{10, 30, 59} {
+		event.Timestamp = newTime(2016, 3, 31, 12, minute, 0)
+		if d := rules.Evaluate(event); d.Notify {
+			t.Errorf("Always rule should not notify again within its window. Got count [%v] at minute %v", d.Count, minute)
+		}
+	}
+	event.Timestamp = newTime(2016, 3, 31, 13, 0, 0)
+	if d := rules.Evaluate(event); !d.Notify {
+		t.Errorf("Always rule should notify again once its window has passed. Got count [%v]", d.Count)
+	}
+	event.Timestamp = newTime(2016, 3, 31, 15, 0, 0)
+	if d := rules.Evaluate(event); !d.Notify || d.Count != 1 {
+		t.Errorf("Always rule should notify after a quiet window. Got count [%v]", d.Count)
+	}
+}
+
+func TestRuleSetKeepsRulesWhenReloadFails(t *testing.T) {
+	path := writeRules(t, TEST_RULES)
+	defer os.Remove(path)
+	rules, _ := LoadRuleSet(path)
+
+	ioutil.WriteFile(path, []byte(`{"Rules": [{"Exception": "OutOfMemoryError", "Action": "sometimes"}]}`), 0644)
+	if err := rules.Reload(); err != ErrUnknownRuleAction {
+		t.Errorf("Rule with an unknown action should fail to load. Got [%v]", err)
+	}
+	if d := rules.Evaluate(&ErrorEvent{Exception: "java.lang.OutOfMemoryError"}); d.Action != RULE_ALWAYS {
+		t.Errorf("Previous rules should be kept when a reload fails. Got [%v]", d.Action)
+	}
+}
+
+func TestRateRuleRequiresPositiveLimit(t *testing.T) {
+	for _, limit := range []string{"0", "-1"} {
+		path := writeRules(t, `{"Rules": [{"Exception": "SocketTimeoutException", "Action": "rate", "Limit": `+limit+`, "Window": "1h"}]}`)
+		defer os.Remove(path)
+		if _, err := LoadRuleSet(path); err != ErrInvalidRateLimit {
+			t.Errorf("Rate rule with a limit of %v should fail to load. Got [%v]", limit, err)
+		}
+	}
+	path := writeRules(t, `{"Rules": [{"Exception": "SocketTimeoutException", "Action": "rate", "Window": "1h"}]}`)
+	defer os.Remove(path)
+	if _, err := LoadRuleSet(path); err != ErrInvalidRateLimit {
+		t.Errorf("Rate rule without a limit should fail to load. Got [%v]", err)
+	}
+}
+
+func TestRuleSetSeedRestoresRateWindows(t *testing.T) {
+	path := writeRules(t, TEST_RULES)
+	defer os.Remove(path)
+	rules, _ := LoadRuleSet(path)
+	if rules.MaxWindow() != time.Hour {
+		t.Errorf("Longest rate window should be 1h. Got [%v]", rules.MaxWindow())
+	}
+
+	stored := []ErrorEvent{
+		{Event: Event{Timestamp: newTime(2016, 3, 31, 11, 30, 0)}, Exception: "java.net.SocketTimeoutException"},
+		{Event: Event{Timestamp: newTime(2016, 3, 31, 11, 45, 0)}, Exception: "java.net.SocketTimeoutException"},
+		{Event: Event{Timestamp: newTime(2016, 3, 31, 11, 50, 0)}, Exception: "java.lang.OutOfMemoryError"},
+	}
+	rules.Seed(stored)
+	event := &ErrorEvent{Event: Event{Timestamp: newTime(2016, 3, 31, 12, 0, 0)}, Exception: "java.net.SocketTimeoutException"}
+	if d := rules.Evaluate(event); d.Count != 3 || !d.Notify {
+		t.Errorf("Stored events should count in the rate window. Got count [%v]", d.Count)
+	}
+	event = &ErrorEvent{Event: Event{Timestamp: newTime(2016, 3, 31, 12, 0, 0)}, Exception: "java.lang.OutOfMemoryError"}
+	if d := rules.Evaluate(event); d.Notify {
+		t.Errorf("Always rule should not notify again of an exception it notified of before the restart")
+	}
+}
+
+func TestRuleSetSeedCountsSources(t *testing.T) {
+	path := writeRules(t, `{"Rules": [{"Exception": "SQLException", "Source": "client.AirtelService", "Action": "rate", "Limit": 1, "Window": "1h"}]}`)
+	defer os.Remove(path)
+	rules, _ := LoadRuleSet(path)
+	rules.Seed([]ErrorEvent{
+		{Event: Event{Timestamp: newTime(2016, 3, 31, 11, 30, 0), Source: "client.AirtelService"}, Exception: "java.sql.SQLException"},
+		{Event: Event{Timestamp: newTime(2016, 3, 31, 11, 40, 0), Source: "client.OtherService"}, Exception: "java.sql.SQLException"},
+	})
+	event := &ErrorEvent{Event: Event{Timestamp: newTime(2016, 3, 31, 12, 0, 0), Source: "client.AirtelService"}, Exception: "java.sql.SQLException"}
+	if d := rules.Evaluate(event); d.Count != 2 || !d.Notify {
+		t.Errorf("Stored events of the source should count in the rate window. Got count [%v]", d.Count)
+	}
+}
+
+func TestNilRuleSetUsesDefault(t *testing.T) {
+	var rules *RuleSet
+	if d := rules.Evaluate(&ErrorEvent{Exception: "excp1"}); d.Action != RULE_DEFAULT || d.sigma() != 1 {
+		t.Errorf("Without rules the statistical detector should be used with 1 sigma")
+	}
+}
@@ -0,0 +1,231 @@
+package errord
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"regexp"
+	"sync"
+	"time"
+)
+
+const MAINTENANCE_HOLD string = "hold"
+const MAINTENANCE_DROP string = "drop"
+
+var ErrEmptyMatcher error = errors.New("Silence requires an Exception, Fingerprint, Source or Service to match")
+var ErrSilenceNotFound error = errors.New("Silence not found")
+var ErrMaintenanceWindowNotFound error = errors.New("Maintenance window not found")
+
+// Matcher selects notifications. Exception and Source are regular expressions and Fingerprint and Service must match exactly
+type Matcher struct {
+	Exception   string
+	Fingerprint string
+	Source      string
+	Service     string
+}
+
+// Silence drops the notifications it matches between StartsAt and EndsAt
+type Silence struct {
+	Id int
+	Matcher
+	StartsAt  time.Time
+	EndsAt    time.Time
+	CreatedBy string
+	Comment   string
+	CreatedAt time.Time
+}
+
+/*
+MaintenanceWindow is a recurring period starting every time Cron matches and lasting Duration. Notifications it matches during the
+window are dropped or, with the hold action, sent once the window has ended. A window without matchers matches every notification
+*/
+type MaintenanceWindow struct {
+	Id   int
+	Name string
+	Matcher
+	Cron      string
+	Duration  string
+	Action    string
+	CreatedBy string
+	Comment   string
+	CreatedAt time.Time
+}
+
+func (m Matcher) isEmpty() bool {
+	return m.Exception == "" && m.Fingerprint == "" && m.Source == "" && m.Service == ""
+}
+
+func (m Matcher) validate() error {
+	if _, err := regexp.Compile(m.Exception); err != nil {
+		return err
+	}
+	_, err := regexp.Compile(m.Source)
+	return err
+}
+
+func (m Matcher) matches(n *ErrorNotification, service string) bool {
+	e := n.ErrorEvent
+	switch {
+	case !matchesPattern(m.Exception, e.Exception):
+		return false
+	case !matchesPattern(m.Source, e.Source):
+		return false
+	case m.Fingerprint != "" && m.Fingerprint != n.fingerprint():
+		return false
+	case m.Service != "" && m.Service != service:
+		return false
+	}
+	return true
+}
+
+func matchesPattern(pattern, value string) bool {
+	if pattern == "" {
+		return true
+	}
+	matched, err := regexp.MatchString(pattern, value)
+	if err != nil {
+		log.Printf("Invalid pattern [%v]: %v\n", pattern, err)
+	}
+	return matched
+}
+
+func (s *Silence) validate() error {
+	if s.Matcher.isEmpty() {
+		return ErrEmptyMatcher
+	}
+	if !s.EndsAt.After(s.StartsAt) {
+		return fmt.Errorf("Silence must end after it starts. Got %v to %v", s.StartsAt, s.EndsAt)
+	}
+	return s.Matcher.validate()
+}
+
+func (s *Silence) isActive(now time.Time) bool {
+	return !now.Before(s.StartsAt) && now.Before(s.EndsAt)
+}
+
+func (w *MaintenanceWindow) validate() error {
+	if w.Action == "" {
+		w.Action = MAINTENANCE_HOLD
+	}
+	if w.Action != MAINTENANCE_HOLD && w.Action != MAINTENANCE_DROP {
+		return fmt.Errorf("Maintenance action must be '%v' or '%v'. Got '%v'", MAINTENANCE_HOLD, MAINTENANCE_DROP, w.Action)
+	}
+	if _, err := ParseCron(w.Cron); err != nil {
+		return err
+	}
+	if d, err := time.ParseDuration(w.Duration); err != nil {
+		return err
+	} else if d <= 0 {
+		return fmt.Errorf("Maintenance window requires a positive duration. Got '%v'", w.Duration)
+	}
+	return w.Matcher.validate()
+}
+
+// end is when the window that is active at now ends, or the zero time when no window is active
+func (w *MaintenanceWindow) end(now time.Time) time.Time {
+	schedule, err := ParseCron(w.Cron)
+	if err != nil {
+		return time.Time{}
+	}
+	duration, _ := time.ParseDuration(w.Duration)
+	var end time.Time
+	for start := schedule.Next(now.Add(-duration).Add(-time.Minute)); !start.IsZero() && !start.After(now); start = schedule.Next(start) {
+		if start.Add(duration).After(now) {
+			end = start.Add(duration)
+		}
+	}
+	return end
+}
+
+const MAINTENANCE_SCOPE string = "maintenance"
+
+/*
+SilenceNotifier drops the notifications matched by an active silence or maintenance window, or holds them until the window has ended.
+Held notifications are kept in the outbox, so they are still sent when errord is restarted during the window
+*/
+type SilenceNotifier struct {
+	notifier Notifier
+	store    SilenceStore
+	service  string
+	held     *heldNotifications
+	now      func() time.Time
+	lock     sync.Mutex
+}
+
+func NewSilenceNotifier(n Notifier, store SilenceStore, service string, outbox OutboxStore) *SilenceNotifier {
+	s := new(SilenceNotifier)
+	s.notifier = n
+	s.store = store
+	s.service = service
+	s.now = time.Now
+	s.held = newHeldNotifications(outbox, MAINTENANCE_SCOPE, 0, func() { s.release(s.now()) })
+	return s
+}
+
+func (s *SilenceNotifier) Fire(n *ErrorNotification) error {
+	switch s.action(n, s.now()) {
+	case MAINTENANCE_DROP:
+		return nil
+	case MAINTENANCE_HOLD:
+		return s.held.hold(n)
+	}
+	return s.notifier.Fire(n)
+}
+
+// action is drop for a notification matched by an active silence or drop maintenance window, hold during a hold maintenance window and empty otherwise
+func (s *SilenceNotifier) action(n *ErrorNotification, now time.Time) string {
+	for _, silence := range s.store.FetchActiveSilences(now) {
+		if silence.matches(n, s.service) {
+			log.Printf("Notification for [%v] silenced by Silence #%v until %v: %v\n", n.ErrorEvent.Exception, silence.Id, silence.EndsAt, silence.Comment)
+			return MAINTENANCE_DROP
+		}
+	}
+	for _, w := range s.store.FetchMaintenanceWindows() {
+		end := w.end(now)
+		if end.IsZero() || !w.matches(n, s.service) {
+			continue
+		}
+		if w.Action == MAINTENANCE_DROP {
+			log.Printf("Notification for [%v] dropped during maintenance window [%v]\n", n.ErrorEvent.Exception, w.Name)
+			return MAINTENANCE_DROP
+		}
+		log.Printf("Notification for [%v] held until maintenance window [%v] ends at %v\n", n.ErrorEvent.Exception, w.Name, end)
+		return MAINTENANCE_HOLD
+	}
+	return ""
+}
+
+// Watch sends the held notifications of maintenance windows that have ended every interval
+func (s *SilenceNotifier) Watch(interval time.Duration) {
+	go func() {
+		for range time.Tick(interval) {
+			s.release(s.now())
+		}
+	}()
+}
+
+// release sends the held notifications that are no longer held by a maintenance window. Notifications that fail are retried after a backoff
+func (s *SilenceNotifier) release(now time.Time) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	for _, entry := range s.held.fetch() {
+		if entry.Attempts > 0 && entry.NextAttemptAt.After(now) {
+			s.held.schedule(entry.NextAttemptAt.Sub(now))
+			continue
+		}
+		n := entry.Notification
+		switch s.action(n, now) {
+		case MAINTENANCE_HOLD:
+			continue
+		case MAINTENANCE_DROP:
+			s.held.sent([]*OutboxEntry{entry})
+			continue
+		}
+		log.Printf("Maintenance window ended. Sending held notification for [%v]\n", n.ErrorEvent.Exception)
+		if err := s.notifier.Fire(n); err != nil {
+			s.held.failed([]*OutboxEntry{entry}, err)
+			continue
+		}
+		s.held.sent([]*OutboxEntry{entry})
+	}
+}
@@ -0,0 +1,129 @@
+package errord
+
+import (
+	"database/sql"
+	"log"
+	"time"
+)
+
+type SilenceStore interface {
+	AddSilence(s *Silence) error
+	ExpireSilence(id int) error
+	FetchActiveSilences(now time.Time) []*Silence
+	FetchSilences(since time.Time) []*Silence
+	AddMaintenanceWindow(w *MaintenanceWindow) error
+	DeleteMaintenanceWindow(id int) error
+	FetchMaintenanceWindows() []*MaintenanceWindow
+}
+
+type silenceStore struct {
+	db *sql.DB
+}
+
+const silenceColumns string = `id, exception, fingerprint, source, service, starts_at, ends_at, created_by, comment, created_at`
+
+const maintenanceColumns string = `id, name, exception, fingerprint, source, service, cron, duration, action, created_by, comment, created_at`
+
+func (store *silenceStore) AddSilence(s *Silence) error {
+	if err := s.validate(); err != nil {
+		return err
+	}
+	// times are compared as stored, so they are all stored in UTC
+	s.StartsAt, s.EndsAt, s.CreatedAt = s.StartsAt.UTC(), s.EndsAt.UTC(), time.Now().UTC()
+	r, err := store.db.Exec(`insert into silences(exception, fingerprint, source, service, starts_at, ends_at, created_by, comment, created_at)
+	values (?, ?, ?, ?, ?, ?, ?, ?, ?)`, s.Exception, s.Fingerprint, s.Source, s.Service, s.StartsAt, s.EndsAt, s.CreatedBy, s.Comment, s.CreatedAt)
+	if err != nil {
+		return err
+	}
+	id, err := r.LastInsertId()
+	s.Id = int(id)
+	return err
+}
+
+// ExpireSilence ends the silence now
+func (store *silenceStore) ExpireSilence(id int) error {
+	now := time.Now().UTC()
+	r, err := store.db.Exec(`update silences set ends_at = ? where id = ? and ends_at > ?`, now, id, now)
+	if err != nil {
+		return err
+	}
+	if count, _ := r.RowsAffected(); count == 0 {
+		return ErrSilenceNotFound
+	}
+	return nil
+}
+
+func (store *silenceStore) FetchActiveSilences(now time.Time) []*Silence {
+	return store.fetchSilences(`select `+silenceColumns+` from silences where starts_at <= ? and ends_at > ? order by id`, now.UTC(), now.UTC())
+}
+
+// FetchSilences fetches the silences that ended after since, including the silences that have not started yet
+func (store *silenceStore) FetchSilences(since time.Time) []*Silence {
+	return store.fetchSilences(`select `+silenceColumns+` from silences where ends_at > ? order by id`, since.UTC())
+}
+
+func (store *silenceStore) fetchSilences(query string, args ...interface{}) []*Silence {
+	silences := []*Silence{}
+	rows, err := store.db.Query(query, args...)
+	if err != nil {
+		log.Printf("Failed fetching Silences: %v\n", err)
+		return silences
+	}
+	defer rows.Close()
+	for rows.Next() {
+		s := new(Silence)
+		err := rows.Scan(&s.Id, &s.Exception, &s.Fingerprint, &s.Source, &s.Service, &s.StartsAt, &s.EndsAt, &s.CreatedBy, &s.Comment, &s.CreatedAt)
+		if err != nil {
+			log.Printf("Failed mapping Silence: %v\n", err)
+			continue
+		}
+		silences = append(silences, s)
+	}
+	return silences
+}
+
+func (store *silenceStore) AddMaintenanceWindow(w *MaintenanceWindow) error {
+	if err := w.validate(); err != nil {
+		return err
+	}
+	w.CreatedAt = time.Now().UTC()
+	r, err := store.db.Exec(`insert into maintenance_windows(name, exception, fingerprint, source, service, cron, duration, action, created_by, comment, created_at)
+	values (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`, w.Name, w.Exception, w.Fingerprint, w.Source, w.Service, w.Cron, w.Duration, w.Action, w.CreatedBy, w.Comment, w.CreatedAt)
+	if err != nil {
+		return err
+	}
+	id, err := r.LastInsertId()
+	w.Id = int(id)
+	return err
+}
+
+func (store *silenceStore) DeleteMaintenanceWindow(id int) error {
+	r, err := store.db.Exec(`delete from maintenance_windows where id = ?`, id)
+	if err != nil {
+		return err
+	}
+	if count, _ := r.RowsAffected(); count == 0 {
+		return ErrMaintenanceWindowNotFound
+	}
+	return nil
+}
+
+func (store *silenceStore) FetchMaintenanceWindows() []*MaintenanceWindow {
+	windows := []*MaintenanceWindow{}
+	rows, err := store.db.Query(`select ` + maintenanceColumns + ` from maintenance_windows order by id`)
+	if err != nil {
+		log.Printf("Failed fetching Maintenance windows: %v\n", err)
+		return windows
+	}
+	defer rows.Close()
+	for rows.Next() {
+		w := new(MaintenanceWindow)
+		err := rows.Scan(&w.Id, &w.Name, &w.Exception, &w.Fingerprint, &w.Source, &w.Service, &w.Cron, &w.Duration, &w.Action, &w.CreatedBy, &w.Comment, &w.CreatedAt)
+		if err != nil {
+			log.Printf("Failed mapping Maintenance window: %v\n", err)
+			continue
+		}
+		windows = append(windows, w)
+	}
+	return windows
+}
@@ -0,0 +1,159 @@
+package errord
+
+import (
+	"testing"
+	"time"
+)
+
+type memSilenceStore struct {
+	silences []*Silence
+	windows  []*MaintenanceWindow
+}
+
+func (s *memSilenceStore) AddSilence(silence *Silence) error {
+	if err := silence.validate(); err != nil {
+		return err
+	}
+	silence.Id = len(s.silences) + 1
+	s.silences = append(s.silences, silence)
+	return nil
+}
+
+func (s *memSilenceStore) ExpireSilence(id int) error {
+	s.silences[id-1].EndsAt = time.Now()
+	return nil
+}
+
+func (s *memSilenceStore) FetchActiveSilences(now time.Time) []*Silence {
+	active := []*Silence{}
+	for _, silence := range s.silences {
+		if silence.isActive(now) {
+			active = append(active, silence)
+		}
+	}
+	return active
+}
+
+func (s *memSilenceStore) FetchSilences(since time.Time) []*Silence {
+	return s.silences
+}
+
+func (s *memSilenceStore) AddMaintenanceWindow(w *MaintenanceWindow) error {
+	if err := w.validate(); err != nil {
+		return err
+	}
+	w.Id = len(s.windows) + 1
+	s.windows = append(s.windows, w)
+	return nil
+}
+
+func (s *memSilenceStore) DeleteMaintenanceWindow(id int) error {
+	s.windows = append(s.windows[:id-1], s.windows[id:]...)
+	return nil
+}
+
+func (s *memSilenceStore) FetchMaintenanceWindows() []*MaintenanceWindow {
+	return s.windows
+}
+
+func TestSilenceDropsMatchingNotifications(t *testing.T) {
+	now := time.Date(2016, 3, 31, 12, 0, 0, 0, time.UTC)
+	store := &memSilenceStore{}
+	recorder := &recordingNotifier{}
+	notifier := NewSilenceNotifier(recorder, store, "billing", &memOutboxStore{})
+	notifier.now = func() time.Time { return now }
+
+	err := store.AddSilence(&Silence{Matcher: Matcher{Exception: `^java\.sql\.`, Service: "billing"}, StartsAt: now.Add(-time.Minute), EndsAt: now.Add(time.Hour),
+		CreatedBy: "ops", Comment: "Database migration"})
+	if err != nil {
+		t.Fatalf("Valid silence should be added: %v", err)
+	}
+	notifier.Fire(newTestNotification())
+	if len(recorder.fired) != 0 {
+		t.Errorf("Notification matched by an active silence should be dropped")
+	}
+
+	event := newErrorEvent("TimeoutException", newTime(2016, 3, 31, 12, 0, 0))
+	notifier.Fire(&ErrorNotification{ErrorEvent: &event})
+	if len(recorder.fired) != 1 {
+		t.Errorf("Notification not matched by a silence should be sent")
+	}
+
+	notifier.now = func() time.Time { return now.Add(2 * time.Hour) }
+	notifier.Fire(newTestNotification())
+	if len(recorder.fired) != 2 {
+		t.Errorf("Notification should be sent once the silence has ended")
+	}
+
+	if err := store.AddSilence(&Silence{StartsAt: now, EndsAt: now.Add(time.Hour)}); err != ErrEmptyMatcher {
+		t.Errorf("Silence without matchers should not be added. Got %v", err)
+	}
+}
+
+func TestMaintenanceWindowHoldsNotifications(t *testing.T) {
+	// Saturday 02:30, half way through the window
+	now := time.Date(2016, 4, 2, 2, 30, 0, 0, time.UTC)
+	store := &memSilenceStore{}
+	recorder := &recordingNotifier{}
+	outbox := &memOutboxStore{}
+	notifier := NewSilenceNotifier(recorder, store, "", outbox)
+	notifier.now = func() time.Time { return now }
+	if err := store.AddMaintenanceWindow(&MaintenanceWindow{Name: "Patching", Cron: "0 2 * * 6", Duration: "1h"}); err != nil {
+		t.Fatalf("Valid maintenance window should be added: %v", err)
+	}
+
+	notifier.Fire(newTestNotification())
+	if len(recorder.fired) != 0 || len(outbox.FetchHeld(MAINTENANCE_SCOPE)) != 1 {
+		t.Fatalf("Notification during a maintenance window should be held in the outbox")
+	}
+	notifier.release(now.Add(10 * time.Minute))
+	if len(recorder.fired) != 0 {
+		t.Errorf("Held notification should not be sent before the window ends")
+	}
+	notifier.now = func() time.Time { return now.Add(time.Hour) }
+	notifier.release(now.Add(time.Hour))
+	if len(recorder.fired) != 1 || len(outbox.FetchHeld(MAINTENANCE_SCOPE)) != 0 {
+		t.Errorf("Held notification should be sent once the window ends")
+	}
+
+	store.windows[0].Action = MAINTENANCE_DROP
+	notifier.now = func() time.Time { return now }
+	notifier.Fire(newTestNotification())
+	if len(recorder.fired) != 1 || len(outbox.FetchHeld(MAINTENANCE_SCOPE)) != 0 {
+		t.Errorf("Notification during a drop maintenance window should be dropped")
+	}
+}
+
+func TestHeldNotificationsSurviveARestart(t *testing.T) {
+	now := time.Date(2016, 4, 2, 2, 30, 0, 0, time.UTC)
+	store := &memSilenceStore{}
+	store.AddMaintenanceWindow(&MaintenanceWindow{Name: "Patching", Cron: "0 2 * * 6", Duration: "1h"})
+	outbox := &memOutboxStore{}
+	notifier := NewSilenceNotifier(&recordingNotifier{}, store, "", outbox)
+	notifier.now = func() time.Time { return now }
+	notifier.Fire(newTestNotification())
+
+	recorder := &recordingNotifier{}
+	restarted := NewSilenceNotifier(recorder, store, "", outbox)
+	restarted.now = func() time.Time { return now.Add(time.Hour) }
+	restarted.release(now.Add(time.Hour))
+	if len(recorder.fired) != 1 || outbox.entries[0].State != OUTBOX_DELIVERED {
+		t.Errorf("Notification held before a restart should be sent once the window ends. Got %v", outbox.entries[0])
+	}
+}
+
+func TestMaintenanceWindowEnd(t *testing.T) {
+	w := &MaintenanceWindow{Cron: "0 2 * * 6", Duration: "2h"}
+	if end := w.end(time.Date(2016, 4, 2, 3, 59, 0, 0, time.UTC)); !end.Equal(time.Date(2016, 4, 2, 4, 0, 0, 0, time.UTC)) {
+		t.Errorf("Window should end 2 hours after it started. Got %v", end)
+	}
+	if end := w.end(time.Date(2016, 4, 2, 2, 0, 0, 0, time.UTC)); end.IsZero() {
+		t.Errorf("Window should be active from the minute it starts")
+	}
+	if end := w.end(time.Date(2016, 4, 2, 4, 0, 0, 0, time.UTC)); !end.IsZero() {
+		t.Errorf("Window should not be active once it has ended. Got %v", end)
+	}
+	if err := (&MaintenanceWindow{Cron: "0 2 * * 6", Duration: "1h", Action: "pause"}).validate(); err == nil {
+		t.Errorf("Unknown maintenance action should not be valid")
+	}
+}
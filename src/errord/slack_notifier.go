@@ -0,0 +1,266 @@
+package errord
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+)
+
+const SLACK_FLAVOR string = "slack"
+const MATTERMOST_FLAVOR string = "mattermost"
+
+const SLACK_API_URL string = "https://slack.com/api/chat.postMessage"
+
+const SPARKLINE_DAYS int = 14
+
+var SPARKS = []rune("▁▂▃▄▅▆▇█")
+
+// ChannelRoute sends notifications of exceptions matching the Exception regex to Channel
+type ChannelRoute struct {
+	Exception string
+	Channel   string
+	regex     *regexp.Regexp
+}
+
+/*
+SlackNotifier posts attachment formatted messages to Slack or Mattermost. With only a URL the message is posted to an incoming webhook.
+With a Token the message is posted through the API of the server instead, which allows updates of the same incident to be posted as
+replies in one thread. For Slack the URL defaults to chat.postMessage and for Mattermost the URL is the address of the server
+*/
+type SlackNotifier struct {
+	flavor  string
+	url     string
+	token   string
+	channel string
+	routes  []ChannelRoute
+	client  *http.Client
+	stats   StatStore
+	store   NotifyStore
+	threads map[string]string
+	lock    sync.Mutex
+}
+
+type slackAttachment struct {
+	Fallback string       `json:"fallback"`
+	Color    string       `json:"color"`
+	Title    string       `json:"title"`
+	Text     string       `json:"text"`
+	Fields   []slackField `json:"fields"`
+	Ts       int64        `json:"ts"`
+}
+
+type slackField struct {
+	Title string `json:"title"`
+	Value string `json:"value"`
+	Short bool   `json:"short"`
+}
+
+type slackMessage struct {
+	Channel     string            `json:"channel,omitempty"`
+	Text        string            `json:"text"`
+	ThreadTs    string            `json:"thread_ts,omitempty"`
+	Attachments []slackAttachment `json:"attachments"`
+}
+
+type mattermostPost struct {
+	ChannelId string                 `json:"channel_id"`
+	Message   string                 `json:"message"`
+	RootId    string                 `json:"root_id,omitempty"`
+	Props     map[string]interface{} `json:"props"`
+}
+
+func NewSlackNotifier(flavor, url, token, channel string, routes []ChannelRoute, timeout time.Duration, stats StatStore, store NotifyStore) (Notifier, error) {
+	for i := range routes {
+		regex, err := regexp.Compile(routes[i].Exception)
+		if err != nil {
+			return nil, err
+		}
+		routes[i].regex = regex
+	}
+	if flavor == "" {
+		flavor = SLACK_FLAVOR
+	}
+	if flavor == SLACK_FLAVOR && token != "" && url == "" {
+		url = SLACK_API_URL
+	}
+	n := new(SlackNotifier)
+	n.flavor = flavor
+	n.url = url
+	n.token = token
+	n.channel = channel
+	n.routes = routes
+	n.client = &http.Client{Timeout: timeout}
+	n.stats = stats
+	n.store = store
+	n.threads = make(map[string]string)
+	return n, nil
+}
+
+func (n *SlackNotifier) Fire(notification *ErrorNotification) error {
+	if n.store.HasNotification(notification) {
+		log.Printf("Notification already sent for %v\n", notification.ErrorEvent)
+		return nil
+	}
+	n.lock.Lock()
+	defer n.lock.Unlock()
+	channel := n.route(notification.ErrorEvent.Exception)
+	thread := threadKey(notification)
+	attachment := n.attachment(notification)
+	var err error
+	switch {
+	case n.token == "":
+		err = n.post(n.url, slackMessage{Channel: channel, Text: attachment.Title, Attachments: []slackAttachment{attachment}}, nil)
+	case n.flavor == MATTERMOST_FLAVOR:
+		var created struct {
+			Id string `json:"id"`
+		}
+		post := mattermostPost{channel, attachment.Title, n.threads[thread], map[string]interface{}{"attachments": []slackAttachment{attachment}}}
+		if err = n.post(strings.TrimRight(n.url, "/")+"/api/v4/posts", post, &created); err == nil && n.threads[thread] == "" {
+			n.threads[thread] = created.Id
+		}
+	default:
+		var created struct {
+			Ok    bool   `json:"ok"`
+			Error string `json:"error"`
+			Ts    string `json:"ts"`
+		}
+		message := slackMessage{channel, attachment.Title, n.threads[thread], []slackAttachment{attachment}}
+		if err = n.post(n.url, message, &created); err == nil && !created.Ok {
+			err = fmt.Errorf("Slack responded with error: %v", created.Error)
+		}
+		if err == nil && n.threads[thread] == "" {
+			n.threads[thread] = created.Ts
+		}
+	}
+	if err != nil {
+		log.Printf("Failed posting to %v -> %v\n", n.flavor, err)
+		return err
+	}
+	if notification.Kind == NOTIFY_RESOLVED {
+		delete(n.threads, thread)
+	}
+	markSent(n.store, notification)
+	return nil
+}
+
+func (n *SlackNotifier) post(url string, message interface{}, response interface{}) error {
+	payload, err := json.Marshal(message)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest("POST", url, bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if n.token != "" {
+		req.Header.Set("Authorization", "Bearer "+n.token)
+	}
+	resp, err := n.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("%v responded with %v", n.flavor, resp.Status)
+	}
+	if response == nil {
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(response)
+}
+
+func (n *SlackNotifier) route(exception string) string {
+	for _, r := range n.routes {
+		if r.regex.MatchString(exception) {
+			return r.Channel
+		}
+	}
+	return n.channel
+}
+
+func (n *SlackNotifier) attachment(notification *ErrorNotification) slackAttachment {
+	subject, body := notification.describe()
+	e := notification.ErrorEvent
+	a := slackAttachment{Fallback: subject, Color: notification.color(), Title: subject, Text: body}
+	a.Fields = []slackField{{"Exception", e.Exception, false}}
+	if e.Detail != "" {
+		a.Fields = append(a.Fields, slackField{"Detail", e.Detail, false})
+	}
+	if notification.DaySummary != nil && notification.Stats != nil {
+		a.Fields = append(a.Fields, slackField{"Today", fmt.Sprintf("%v / %v", notification.DaySummary.Total, notification.limit()), true})
+	}
+	history := notification.History
+	if len(history) == 0 && n.stats != nil {
+		history = n.stats.FetchDaySummariesByName(e.Exception)
+	}
+	if len(history) > 0 {
+		a.Fields = append(a.Fields, slackField{fmt.Sprintf("Last %v days", SPARKLINE_DAYS), sparkline(history, SPARKLINE_DAYS), true})
+	}
+	if e.Timestamp != nil {
+		a.Ts = e.Timestamp.Unix()
+	}
+	return a
+}
+
+// color is the severity colour of the notification as used by Slack and Mattermost attachments
+func (n *ErrorNotification) color() string {
+	switch n.Kind {
+	case NOTIFY_RESOLVED:
+		return "good"
+	case NOTIFY_ACKNOWLEDGED:
+		return "#439FE0"
+	case NOTIFY_REGRESSION:
+		return "danger"
+	}
+	if n.Rule != nil || (n.Stats != nil && n.DaySummary != nil) {
+		return "danger"
+	}
+	return "warning"
+}
+
+// threadKey groups the notifications of one incident
+func threadKey(n *ErrorNotification) string {
+	if n.Incident != nil {
+		return fmt.Sprintf("incident:%v", n.Incident.Id)
+	}
+	return n.fingerprint()
+}
+
+// sparkline draws the totals of the last days, ending today, with one character per day
+func sparkline(history []*DaySummary, days int) string {
+	totals, max := dailyTotals(history, days)
+	line := make([]rune, days)
+	for i, total := range totals {
+		if max == 0 {
+			line[i] = SPARKS[0]
+			continue
+		}
+		line[i] = SPARKS[total*(len(SPARKS)-1)/max]
+	}
+	return string(line)
+}
+
+// dailyTotals are the totals of the last days, ending today, and the largest of them
+func dailyTotals(history []*DaySummary, days int) ([]int, int) {
+	totals := make([]int, days)
+	today := time.Now().Truncate(24 * time.Hour)
+	max := 0
+	for _, d := range history {
+		index := days - 1 - int(today.Sub(d.Date.Truncate(24*time.Hour)).Hours()/24)
+		if index < 0 || index >= days {
+			continue
+		}
+		totals[index] += d.Total
+		if totals[index] > max {
+			max = totals[index]
+		}
+	}
+	return totals, max
+}
@@ -0,0 +1,68 @@
+package errord
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestSparkline(t *testing.T) {
+	today := time.Now()
+	yesterday := today.Add(-24 * time.Hour)
+	old := today.Add(-30 * 24 * time.Hour)
+	history := []*DaySummary{{Date: yesterday, Total: 4}, {Date: today, Total: 8}, {Date: old, Total: 100}}
+
+	line := sparkline(history, 4)
+	if line != "▁▁▄█" {
+		t.Errorf("Sparkline should scale totals to the highest total and ignore days outside the period. Got %v", line)
+	}
+	if sparkline([]*DaySummary{}, 3) != "▁▁▁" {
+		t.Errorf("Sparkline without history should be flat")
+	}
+}
+
+func TestSlackNotifierRoutesAndThreadsIncidents(t *testing.T) {
+	messages := []slackMessage{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var m slackMessage
+		json.NewDecoder(r.Body).Decode(&m)
+		messages = append(messages, m)
+		if r.Header.Get("Authorization") != "Bearer token" {
+			t.Errorf("API requests should be authorized with the token")
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{"ok": true, "ts": "1459425600.000100"})
+	}))
+	defer server.Close()
+
+	routes := []ChannelRoute{{Exception: `^java\.sql\.`, Channel: "#database"}}
+	notifier, err := NewSlackNotifier(SLACK_FLAVOR, server.URL, "token", "#errors", routes, time.Second, nil, newMemNotifyStore())
+	if err != nil {
+		t.Fatalf("Valid routes should not return an error: %v", err)
+	}
+	incident := &Incident{Id: 1, Exception: "java.sql.SQLException", State: INCIDENT_OPEN, Count: 1}
+	opened := newTestNotification()
+	opened.Kind = NOTIFY_OPENED
+	opened.Incident = incident
+	notifier.Fire(opened)
+	incident.Count = 20
+	notifier.Fire(&ErrorNotification{ErrorEvent: opened.ErrorEvent, Kind: NOTIFY_ONGOING, Incident: incident})
+	notifier.Fire(&ErrorNotification{ErrorEvent: &ErrorEvent{Exception: "javax.xml.bind.UnmarshalException"}})
+
+	if len(messages) != 3 {
+		t.Fatalf("Every notification should be posted. Got %v", len(messages))
+	}
+	if messages[0].Channel != "#database" || messages[2].Channel != "#errors" {
+		t.Errorf("Exceptions should be routed to the channel of the first matching route. Got %v and %v", messages[0].Channel, messages[2].Channel)
+	}
+	if messages[0].ThreadTs != "" || messages[1].ThreadTs != "1459425600.000100" {
+		t.Errorf("Updates of an incident should be replies to the first message. Got [%v] and [%v]", messages[0].ThreadTs, messages[1].ThreadTs)
+	}
+	if messages[2].ThreadTs != "" {
+		t.Errorf("Other exceptions should start their own thread")
+	}
+	if messages[0].Attachments[0].Color != "warning" {
+		t.Errorf("New error should have the warning colour. Got %v", messages[0].Attachments[0].Color)
+	}
+}
@@ -0,0 +1,187 @@
+package errord
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	_ "github.com/go-sql-driver/mysql"
+	"log"
+	"strings"
+	"time"
+)
+
+var ErrUnknownParameter error = errors.New("Statement uses an unknown parameter")
+
+/*
+SQLConfig is the database a SQLNotifier writes to and the statement it executes. The statement names its parameters as :name and
+they are bound from the notification: subject, body, exception, detail, description, source, level, timestamp, kind, severity,
+fingerprint and incident. Params adds constant parameters, for example the address an email request is sent to
+*/
+type SQLConfig struct {
+	Driver          string
+	DSN             string
+	Statement       string
+	Params          map[string]string
+	MaxOpenConns    int
+	MaxIdleConns    int
+	ConnMaxLifetime time.Duration
+	Timeout         time.Duration
+}
+
+/*
+SQLNotifier writes every notification to a database with a configured statement, so that another system can pick it up from an
+outbox table or a stored procedure. Connections are pooled and kept between notifications
+*/
+type SQLNotifier struct {
+	db        *sql.DB
+	statement string
+	names     []string
+	params    map[string]string
+	timeout   time.Duration
+	store     NotifyStore
+}
+
+func NewSQLNotifier(c SQLConfig, store NotifyStore) (Notifier, error) {
+	if c.Driver == "" {
+		c.Driver = "mysql"
+	}
+	if c.DSN == "" || c.Statement == "" {
+		return nil, errors.New("SQL notifier requires a DSN and a Statement")
+	}
+	statement, names := bindNamed(c.Statement, c.Driver)
+	for _, name := range names {
+		if _, ok := c.Params[name]; !ok && !isNotificationParam(name) {
+			return nil, fmt.Errorf("%v: ':%v'", ErrUnknownParameter, name)
+		}
+	}
+	db, err := sql.Open(c.Driver, c.DSN)
+	if err != nil {
+		return nil, err
+	}
+	if c.MaxOpenConns > 0 {
+		db.SetMaxOpenConns(c.MaxOpenConns)
+	}
+	if c.MaxIdleConns > 0 {
+		db.SetMaxIdleConns(c.MaxIdleConns)
+	}
+	if c.ConnMaxLifetime > 0 {
+		db.SetConnMaxLifetime(c.ConnMaxLifetime)
+	}
+	n := new(SQLNotifier)
+	n.db = db
+	n.statement = statement
+	n.names = names
+	n.params = c.Params
+	n.timeout = c.Timeout
+	if n.timeout == 0 {
+		n.timeout = 10 * time.Second
+	}
+	n.store = store
+	return n, nil
+}
+
+func (n *SQLNotifier) Fire(notification *ErrorNotification) error {
+	if n.store.HasNotification(notification) {
+		log.Printf("Notification already sent for %v\n", notification.ErrorEvent)
+		return nil
+	}
+	values := notificationParams(notification)
+	args := make([]interface{}, len(n.names))
+	for i, name := range n.names {
+		if v, ok := n.params[name]; ok {
+			args[i] = v
+		} else {
+			args[i] = values[name]
+		}
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), n.timeout)
+	defer cancel()
+	if _, err := n.db.ExecContext(ctx, n.statement, args...); err != nil {
+		log.Printf("Failed writing notification to the database -> %v\n", err)
+		return err
+	}
+	log.Printf("Notification written to the database\n")
+	markSent(n.store, notification)
+	return nil
+}
+
+var NOTIFICATION_PARAMS = []string{"subject", "body", "exception", "detail", "description", "source", "level", "timestamp", "kind", "severity",
+	"fingerprint", "incident"}
+
+func isNotificationParam(name string) bool {
+	for _, p := range NOTIFICATION_PARAMS {
+		if p == name {
+			return true
+		}
+	}
+	return false
+}
+
+// notificationParams are the values of the named parameters of a statement. incident is nil when there is no incident
+func notificationParams(n *ErrorNotification) map[string]interface{} {
+	subject, body := n.describe()
+	e := n.ErrorEvent
+	params := map[string]interface{}{"subject": subject, "body": body, "kind": string(n.Kind), "severity": n.Severity(), "incident": nil}
+	if e != nil {
+		params["exception"] = e.Exception
+		params["detail"] = e.Detail
+		params["description"] = e.Description
+		params["source"] = e.Source
+		params["level"] = string(e.Level)
+		params["fingerprint"] = n.fingerprint()
+		if e.Timestamp != nil {
+			params["timestamp"] = *e.Timestamp
+		}
+	}
+	if n.Incident != nil {
+		params["incident"] = n.Incident.Id
+	}
+	return params
+}
+
+/*
+bindNamed replaces the :name parameters of the statement with the placeholders of the driver, $1 for postgres and ? for the others,
+and returns the names in the order they are bound. Parameters in quoted strings and postgres casts like ::text are left alone
+*/
+func bindNamed(statement, driver string) (string, []string) {
+	numbered := driver == "postgres" || driver == "pgx"
+	var b strings.Builder
+	names := []string{}
+	var quote rune
+	runes := []rune(statement)
+	for i := 0; i < len(runes); i++ {
+		r := runes[i]
+		switch {
+		case quote != 0:
+			if r == quote {
+				quote = 0
+			}
+		case r == '\'' || r == '"' || r == '`':
+			quote = r
+		case r == ':' && i+1 < len(runes) && runes[i+1] == ':':
+			b.WriteString("::")
+			i++
+			continue
+		case r == ':' && i+1 < len(runes) && isNameRune(runes[i+1], true):
+			j := i + 1
+			for j < len(runes) && isNameRune(runes[j], false) {
+				j++
+			}
+			names = append(names, string(runes[i+1:j]))
+			if numbered {
+				fmt.Fprintf(&b, "$%v", len(names))
+			} else {
+				b.WriteRune('?')
+			}
+			i = j - 1
+			continue
+		}
+		b.WriteRune(r)
+	}
+	return b.String(), names
+}
+
+func isNameRune(r rune, first bool) bool {
+	return r == '_' || (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z') || (!first && r >= '0' && r <= '9')
+}
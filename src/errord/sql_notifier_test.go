@@ -0,0 +1,107 @@
+package errord
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"testing"
+)
+
+func TestBindNamedParameters(t *testing.T) {
+	statement, names := bindNamed(`call common.sp_create_email_request(:to, '', ':skipped', :subject, :body, 'N', 'errord', '')`, "mysql")
+	if statement != `call common.sp_create_email_request(?, '', ':skipped', ?, ?, 'N', 'errord', '')` {
+		t.Errorf("Named parameters should be replaced with placeholders. Got %v", statement)
+	}
+	if len(names) != 3 || names[0] != "to" || names[1] != "subject" || names[2] != "body" {
+		t.Errorf("Names should be in the order they are bound. Got %v", names)
+	}
+	if statement, _ := bindNamed(`insert into outbox(subject, at) values(:subject, :timestamp::timestamptz)`, "postgres"); statement != `insert into outbox(subject, at) values($1, $2::timestamptz)` {
+		t.Errorf("Postgres parameters should be numbered and casts kept. Got %v", statement)
+	}
+}
+
+// recordingDriver is a database/sql driver that records the statements executed on it
+type recordingDriver struct {
+	opened int
+	execs  []recordedExec
+}
+
+type recordedExec struct {
+	query string
+	args  []driver.Value
+}
+
+func (d *recordingDriver) Open(name string) (driver.Conn, error) {
+	d.opened++
+	return &recordingConn{d}, nil
+}
+
+type recordingConn struct {
+	driver *recordingDriver
+}
+
+func (c *recordingConn) Prepare(query string) (driver.Stmt, error) {
+	return nil, errors.New("Prepare is not supported")
+}
+
+func (c *recordingConn) Close() error {
+	return nil
+}
+
+func (c *recordingConn) Begin() (driver.Tx, error) {
+	return nil, errors.New("Transactions are not supported")
+}
+
+func (c *recordingConn) Exec(query string, args []driver.Value) (driver.Result, error) {
+	c.driver.execs = append(c.driver.execs, recordedExec{query, args})
+	return recordedResult(len(c.driver.execs)), nil
+}
+
+// recordedResult is the result of a recorded statement. Its insert id is the number of statements recorded so far
+type recordedResult int64
+
+func (r recordedResult) LastInsertId() (int64, error) {
+	return int64(r), nil
+}
+
+func (r recordedResult) RowsAffected() (int64, error) {
+	return 1, nil
+}
+
+var testDriver = &recordingDriver{}
+
+func init() {
+	sql.Register("errord-test", testDriver)
+}
+
+func TestSQLNotifierWritesNotification(t *testing.T) {
+	testDriver.execs, testDriver.opened = nil, 0
+	config := SQLConfig{Driver: "errord-test", DSN: "outbox", MaxOpenConns: 2,
+		Statement: `insert into outbox(recipient, subject, exception, severity, incident) values(:to, :subject, :exception, :severity, :incident)`,
+		Params:    map[string]string{"to": "ops@example.com"}}
+	notifier, err := NewSQLNotifier(config, newMemNotifyStore())
+	if err != nil {
+		t.Fatalf("Valid SQL config should not return an error: %v", err)
+	}
+
+	notifier.Fire(newTestNotification())
+	event := newErrorEvent("TimeoutException", newTime(2016, 3, 31, 12, 0, 0))
+	if err := notifier.Fire(&ErrorNotification{ErrorEvent: &event}); err != nil {
+		t.Fatalf("Notification should be written: %v", err)
+	}
+	if len(testDriver.execs) != 2 || testDriver.opened != 1 {
+		t.Fatalf("Notifications should be written over one pooled connection. Got %v statements over %v connections", len(testDriver.execs), testDriver.opened)
+	}
+	exec := testDriver.execs[0]
+	if exec.query != `insert into outbox(recipient, subject, exception, severity, incident) values(?, ?, ?, ?, ?)` {
+		t.Errorf("Named parameters should be bound with placeholders. Got %v", exec.query)
+	}
+	if exec.args[0] != "ops@example.com" || exec.args[1] != newTestNotification().Subject() || exec.args[2] != "java.sql.SQLException" || exec.args[4] != nil {
+		t.Errorf("Parameters should be bound from the notification and Params. Got %v", exec.args)
+	}
+
+	config.Statement = `insert into outbox(recipient) values(:recipient)`
+	if _, err := NewSQLNotifier(config, newMemNotifyStore()); err == nil {
+		t.Errorf("Statement with an unknown parameter should not be valid")
+	}
+}
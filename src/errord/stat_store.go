@@ -11,8 +11,13 @@ type StatStore interface {
 	InsertOrUpdateStatItem(s *StatItem) error
 	FetchSummaries() []Summary
 	FetchDaySummaries() []DaySummary
+	FetchDaySummariesByName(name string) []*DaySummary
 	GetDaySummary(e *ErrorEvent) *DaySummary
 	UpdateDaySummaries() error
+	RebuildDaySummaries() error
+	QuerySummaries(q Query) ([]Summary, int, error)
+	QueryDaySummaries(q Query) ([]DaySummary, int, error)
+	QueryStatItems(q Query) ([]StatItem, int, error)
 }
 
 type statStore struct {
@@ -130,17 +135,120 @@ func (store *statStore) GetDaySummary(event *ErrorEvent) *DaySummary {
 	return s
 }
 
-func (store *statStore) UpdateDaySummaries() error {
-	_, err := store.db.Exec(`
+const UPDATE_DAY_SUMMARIES_SQL string = `
 		insert or ignore into day_summary(created_at, name, count, total) select DATE(event_datetime) as error_date, exception, count(exception) as count, count(exception) as total from error_events group by DATE(error_date), exception
-	`)
+	`
+
+func (store *statStore) UpdateDaySummaries() error {
+	_, err := store.db.Exec(UPDATE_DAY_SUMMARIES_SQL)
 	return err
 }
 
+/*
+RebuildDaySummaries deletes the day summaries and stat items and summarizes every error event again. UpdateDaySummaries only adds
+the days that have no summary yet, so the summaries of days with events added later, like backfilled logs, are only right once rebuilt
+*/
+func (store *statStore) RebuildDaySummaries() error {
+	tx, err := store.db.Begin()
+	if err != nil {
+		return err
+	}
+	for _, statement := range []string{"delete from day_summary", "delete from event_stats", UPDATE_DAY_SUMMARIES_SQL} {
+		if _, err := tx.Exec(statement); err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// QuerySummaries pages the summaries of the exceptions seen between the dates of the query, most seen first
+func (store *statStore) QuerySummaries(q Query) ([]Summary, int, error) {
+	where, args := q.dateWhere("created_at", "name")
+	var total int
+	if err := store.db.QueryRow("select count(distinct name) from day_summary"+where, args...).Scan(&total); err != nil {
+		return nil, 0, err
+	}
+	rows, err := store.db.Query("select name, min(created_at), max(created_at), sum(count), sum(total) from day_summary"+where+
+		" group by name order by sum(total) desc, name"+q.page(), args...)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+	summaries := []Summary{}
+	for rows.Next() {
+		var s Summary
+		var start, end string
+		if err := rows.Scan(&s.Name, &start, &end, &s.Count, &s.Total); err != nil {
+			log.Printf("Failed mapping summary: %v", err)
+			continue
+		}
+		s.StartDate, _ = toDate(start[:len("2006-01-02")])
+		s.EndDate, _ = toDate(end[:len("2006-01-02")])
+		summaries = append(summaries, s)
+	}
+	return summaries, total, nil
+}
+
+// QueryDaySummaries pages the day summaries between the dates of the query, newest first
+func (store *statStore) QueryDaySummaries(q Query) ([]DaySummary, int, error) {
+	where, args := q.dateWhere("created_at", "name")
+	total, err := countRows(store.db, "day_summary", where, args)
+	if err != nil {
+		return nil, 0, err
+	}
+	rows, err := store.db.Query("select id, created_at, name, count, total from day_summary"+where+" order by created_at desc, name"+q.page(), args...)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+	summaries := []DaySummary{}
+	for rows.Next() {
+		var s DaySummary
+		if err := rows.Scan(&s.Id, &s.Date, &s.Name, &s.Count, &s.Total); err != nil {
+			log.Printf("Failed mapping Day Summary: %v", err)
+			continue
+		}
+		summaries = append(summaries, s)
+	}
+	return summaries, total, nil
+}
+
+// QueryStatItems pages the statistics of the exceptions that were modified in the time range of the query
+func (store *statStore) QueryStatItems(q Query) ([]StatItem, int, error) {
+	where, args := q.formattedWhere("modified_at", DATE_FORMAT, "name")
+	total, err := countRows(store.db, "event_stats", where, args)
+	if err != nil {
+		return nil, 0, err
+	}
+	rows, err := store.db.Query("select name, mean, variance, std_dev, total, day_count, modified_at from event_stats"+where+" order by name"+q.page(), args...)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+	items := []StatItem{}
+	for rows.Next() {
+		var s StatItem
+		var modified time.Time
+		if err := rows.Scan(&s.Name, &s.Mean, &s.Variance, &s.StdDev, &s.Total, &s.DayCount, &modified); err != nil {
+			log.Printf("Failed mapping Stat Item: %v", err)
+			continue
+		}
+		s.ModifiedAt = &modified
+		items = append(items, s)
+	}
+	return items, total, nil
+}
+
 func toDateTime(date string) (time.Time, error) {
 	return time.Parse(time.RFC3339Nano, date)
 }
 
+// toSQLiteTime parses a DATETIME as it is written by the sqlite driver. Needed when the column type is lost, like with min()
+func toSQLiteTime(date string) (time.Time, error) {
+	return time.Parse("2006-01-02 15:04:05.999999999-07:00", date)
+}
+
 func toDate(date string) (time.Time, error) {
 	return time.Parse("2006-01-02", date)
 }
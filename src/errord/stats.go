@@ -41,7 +41,12 @@ type StatItem struct {
 }
 
 func (s *StatItem) StdDevMax() int {
-	return int(s.StdDev + s.Mean)
+	return s.StdDevLimit(1)
+}
+
+// StdDevLimit is the daily total allowed when the limit is sigma standard deviations above the mean
+func (s *StatItem) StdDevLimit(sigma float64) int {
+	return int(sigma*s.StdDev + s.Mean)
 }
 
 type StatEngine interface {
@@ -49,20 +54,44 @@ type StatEngine interface {
 	updateStats()
 	getStat(event *ErrorEvent) *StatItem
 	Listen(eventBus chan ErrorEvent, n Notifier)
+	OnDecision(f func(d *AnomalyDecision))
+	Recompute() error
 }
 
 type statEngine struct {
-	store StatStore
+	store     StatStore
+	issues    IssueStore
+	incidents IncidentStore
+	releases  ReleaseStore
+	rules     *RuleSet
+	decided   func(d *AnomalyDecision)
 }
 
-func NewStatEngine(s Store) StatEngine {
+func NewStatEngine(s Store, rules *RuleSet) StatEngine {
 	e := new(statEngine)
 	e.store = s.Stats()
+	e.issues = s.Issues()
+	e.incidents = s.Incidents()
+	e.releases = s.Releases()
+	e.rules = rules
 	return e
 }
 
 func (e *statEngine) Init() {
 	e.updateStats()
+	if err := e.issues.Rebuild(); err != nil {
+		log.Printf("Failed rebuilding issues: %v\n", err)
+	}
+}
+
+// Recompute rebuilds the day summaries from the error events and then the stat items and issues from the day summaries
+func (e *statEngine) Recompute() error {
+	if err := e.store.RebuildDaySummaries(); err != nil {
+		return err
+	}
+	log.Println("Day summaries rebuilt")
+	e.Init()
+	return nil
 }
 
 func (e *statEngine) updateStats() {
@@ -76,6 +105,7 @@ func (e *statEngine) updateStats() {
 	log.Printf("Got %v Summaires. Calculating status on them\n", len(summaries))
 	stats := e.calcStats(summaries)
 	for _, stat := range stats {
+		METRICS.Set("errord_exception_threshold", float64(stat.StdDevMax()), "exception", stat.Name)
 		err := e.store.InsertOrUpdateStatItem(stat)
 		if err != nil {
 			log.Printf("Failed inserting Stat: [%v] : %v\n", stat, err)
@@ -111,6 +141,22 @@ func (e *statEngine) getStat(event *ErrorEvent) *StatItem {
 	return e.store.GetStatItem(event.Exception)
 }
 
+// OnDecision calls f with what was decided about every event Listen reads
+func (e *statEngine) OnDecision(f func(d *AnomalyDecision)) {
+	e.decided = f
+}
+
+func (e *statEngine) decide(event *ErrorEvent, d *AnomalyDecision) {
+	if e.decided == nil {
+		return
+	}
+	d.Exception = event.Exception
+	d.Source = event.Source
+	d.Level = event.Level
+	d.Timestamp = event.Timestamp
+	e.decided(d)
+}
+
 func (e *statEngine) Listen(eventBus chan ErrorEvent, n Notifier) {
 	log.Printf("Creating StatCache")
 	cache := createStatCache(e)
@@ -121,33 +167,96 @@ func (e *statEngine) Listen(eventBus chan ErrorEvent, n Notifier) {
 			cache.reset()
 		}
 		log.Printf("Processing: %v - %v\n", event.Timestamp, event.Exception)
+		issue, regressed, err := e.issues.Track(&event)
+		if err != nil {
+			log.Printf("Failed tracking issue of [%v]: %v\n", event.Exception, err)
+		} else if issue.isSilenced(now) {
+			log.Printf("Issue [%v] of [%v] is %v. Skipping\n", issue.Fingerprint, event.Exception, issue.Status)
+			e.decide(&event, &AnomalyDecision{Decision: ANOMALY_SILENCED})
+			continue
+		} else if regressed {
+			log.Printf("Issue [%v] of [%v] regressed. Notifying\n", issue.Fingerprint, event.Exception)
+			e.decide(&event, &AnomalyDecision{Decision: ANOMALY_REGRESSION, Notify: true})
+			n.Fire(&ErrorNotification{ErrorEvent: &event, Kind: NOTIFY_REGRESSION, Issue: issue, History: e.store.FetchDaySummariesByName(event.Exception),
+				Release: e.releases.ReleaseAt(*event.Timestamp)})
+			continue
+		}
+		incident := e.countOnIncident(&event)
+		decision := e.rules.Evaluate(&event)
+		switch decision.Action {
+		case RULE_IGNORE:
+			log.Printf("[%v] is ignored by rule. Skipping\n", event.Exception)
+			e.decide(&event, &AnomalyDecision{Decision: ANOMALY_IGNORED, Rule: decision.Rule})
+			continue
+		case RULE_ALWAYS:
+			if decision.Notify {
+				log.Printf("[%v] always alerts by rule. Notifying\n", event.Exception)
+			} else {
+				log.Printf("[%v] always alerts by rule and was already notified %v times in its window. Skipping\n", event.Exception, decision.Count)
+			}
+			e.decide(&event, &AnomalyDecision{Decision: ANOMALY_ALWAYS, Notify: decision.Notify, Count: decision.Count, Rule: decision.Rule})
+			if decision.Notify {
+				n.Fire(&ErrorNotification{ErrorEvent: &event, Rule: decision.Rule})
+			}
+			continue
+		case RULE_RATE:
+			log.Printf("[%v] seen %v times in the last %v. Rule limit is %v\n", event.Exception, decision.Count, decision.Rule.Window, decision.Rule.Limit)
+			e.decide(&event, &AnomalyDecision{Decision: ANOMALY_RATE, Notify: decision.Notify, Count: decision.Count, Limit: decision.Rule.Limit,
+				Rule: decision.Rule})
+			if decision.Notify {
+				n.Fire(&ErrorNotification{ErrorEvent: &event, Rule: decision.Rule})
+			}
+			continue
+		}
 		log.Printf("Retrieving StatItem for: %v - %v\n", event.Timestamp, event.Exception)
 		var statItem *StatItem = cache.get(&event)
 		log.Printf("Got: %v\n", statItem)
-		if statItem == nil {
+		if statItem == nil && incident != nil {
+			log.Printf("No Stat Item for [%v] but Incident #%v is already open. Not notifying again\n", event.Exception, incident.Id)
+			e.decide(&event, &AnomalyDecision{Decision: ANOMALY_NEW, Count: incident.Count})
+		} else if statItem == nil {
 			log.Printf("No Stat Item. Exception is propbably new. Notifying of: %v\n", event.Exception)
+			e.decide(&event, &AnomalyDecision{Decision: ANOMALY_NEW, Notify: true})
 			notification := &ErrorNotification{}
 			notification.ErrorEvent = &event
+			notification.Release = e.releases.ReleaseAt(*event.Timestamp)
 			n.Fire(notification)
 		} else {
 			log.Printf("Retrieving DaySummary for: %v - %v\n", event.Timestamp, event.Exception)
 			var sum *DaySummary = e.store.GetDaySummary(&event)
+			sigma := decision.sigma()
 			log.Printf("DaySummary: %v - %v [%v]\n", sum.Date, sum.Name, sum.Total)
-			log.Printf("Checking if [%v] exceeds StdMax [%v] ...", sum.Total, statItem.StdDevMax())
-			if e.dayTotalExceedsStatLimit(statItem, sum) {
+			METRICS.Set("errord_exception_day_total", float64(sum.Total), "exception", event.Exception)
+			METRICS.Set("errord_exception_threshold", float64(statItem.StdDevLimit(sigma)), "exception", event.Exception)
+			log.Printf("Checking if [%v] exceeds StdMax [%v] ...", sum.Total, statItem.StdDevLimit(sigma))
+			exceeded := e.dayTotalExceedsStatLimit(statItem, sum, sigma)
+			e.decide(&event, &AnomalyDecision{Decision: ANOMALY_THRESHOLD, Notify: exceeded, Count: sum.Total, Limit: statItem.StdDevLimit(sigma)})
+			if exceeded {
 				log.Printf("[%v] exceeds StdMax ... Fire Notification!", event.Exception)
-				n.Fire(&ErrorNotification{&event, sum, statItem})
+				n.Fire(&ErrorNotification{ErrorEvent: &event, DaySummary: sum, Stats: statItem, Sigma: sigma})
 			}
 		}
 
 	}
 }
 
-func (e *statEngine) dayTotalExceedsStatLimit(stat *StatItem, sum *DaySummary) bool {
+// countOnIncident counts the event on the active incident of its fingerprint, whether or not the event is notified
+func (e *statEngine) countOnIncident(event *ErrorEvent) *Incident {
+	incident := e.incidents.GetActiveIncident(event.Fingerprint())
+	if incident == nil {
+		return nil
+	}
+	if err := e.incidents.Touch(incident); err != nil {
+		log.Printf("Failed counting [%v] on Incident #%v: %v\n", event.Exception, incident.Id, err)
+	}
+	return incident
+}
+
+func (e *statEngine) dayTotalExceedsStatLimit(stat *StatItem, sum *DaySummary, sigma float64) bool {
 	if sum == nil {
 		return false
 	} else {
-		return sum.Total >= stat.StdDevMax()
+		return sum.Total >= stat.StdDevLimit(sigma)
 	}
 }
 
@@ -3,8 +3,10 @@ package errord
 import (
 	"database/sql"
 	"errors"
+	"fmt"
 	"log"
 	"strings"
+	"time"
 )
 
 const SQL_TABLE_ERROR_EVENTS string = `create table error_events
@@ -15,6 +17,8 @@ const SQL_TABLE_ERROR_EVENTS string = `create table error_events
 		description VARCHAR(255) not null,
 		exception VARCHAR(255) not null,
 		excp_description VARCHAR(255) not null,
+		release_id INTEGER,
+		source VARCHAR(255) not null default '',
 		unique(event_datetime, exception)
 	)
 	`
@@ -22,7 +26,13 @@ const SQL_TABLE_NOTIFICATIONS string = `create table notifications(
 		id INTEGER not null primary key,
 		created_at DATETIME not null,
 		subject VARCHAR(255) not null,
-		unique(created_at, subject))`
+		dedup_key VARCHAR(255) not null,
+		sent_at DATETIME not null,
+		severity VARCHAR(10) not null,
+		decision VARCHAR(10) not null,
+		reason VARCHAR(255) not null,
+		exception VARCHAR(255) not null default '',
+		decisions INTEGER not null default 1)`
 
 const SQL_EVENT_STATS string = `
 	create table event_stats (
@@ -47,6 +57,89 @@ const SQL_TABLE_DAY_SUMMARY string = `
 		unique(created_at, name)
 	)
 	`
+const SQL_TABLE_INCIDENTS string = `
+	create table incidents(
+		id INTEGER not null primary key,
+		exception VARCHAR(255) not null,
+		fingerprint VARCHAR(40) not null default '',
+		source VARCHAR(255) not null default '',
+		state VARCHAR(20) not null,
+		opened_at DATETIME not null,
+		updated_at DATETIME not null,
+		acknowledged_at DATETIME,
+		ack_notified_at DATETIME,
+		resolved_at DATETIME,
+		count INTEGER not null
+	)
+	`
+const SQL_TABLE_ISSUES string = `
+	create table issues(
+		fingerprint VARCHAR(40) not null primary key,
+		exception VARCHAR(255) not null,
+		detail VARCHAR(255) not null,
+		first_seen DATETIME not null,
+		last_seen DATETIME not null,
+		count INTEGER not null,
+		status VARCHAR(20) not null,
+		muted_until DATETIME,
+		resolved_at DATETIME
+	)
+	`
+const SQL_TABLE_RELEASES string = `
+	create table releases(
+		id INTEGER not null primary key,
+		version VARCHAR(255) not null,
+		service VARCHAR(255) not null,
+		deployed_at DATETIME not null,
+		unique(version, service)
+	)
+	`
+
+const SQL_TABLE_OUTBOX string = `
+	create table outbox(
+		id INTEGER not null primary key,
+		scope VARCHAR(255) not null default '',
+		subject VARCHAR(255) not null,
+		payload TEXT not null,
+		state VARCHAR(20) not null,
+		attempts INTEGER not null,
+		created_at DATETIME not null,
+		next_attempt_at DATETIME not null,
+		delivered_at DATETIME,
+		last_error TEXT not null
+	)
+	`
+
+const SQL_TABLE_SILENCES string = `
+	create table silences(
+		id INTEGER not null primary key,
+		exception VARCHAR(255) not null,
+		fingerprint VARCHAR(40) not null,
+		source VARCHAR(255) not null,
+		service VARCHAR(255) not null,
+		starts_at DATETIME not null,
+		ends_at DATETIME not null,
+		created_by VARCHAR(255) not null,
+		comment TEXT not null,
+		created_at DATETIME not null
+	)
+	`
+const SQL_TABLE_MAINTENANCE_WINDOWS string = `
+	create table maintenance_windows(
+		id INTEGER not null primary key,
+		name VARCHAR(255) not null,
+		exception VARCHAR(255) not null,
+		fingerprint VARCHAR(40) not null,
+		source VARCHAR(255) not null,
+		service VARCHAR(255) not null,
+		cron VARCHAR(255) not null,
+		duration VARCHAR(20) not null,
+		action VARCHAR(10) not null,
+		created_by VARCHAR(255) not null,
+		comment TEXT not null,
+		created_at DATETIME not null
+	)
+	`
 
 var ErrTableExists error = errors.New("Not creating Table. Table already exists")
 
@@ -56,10 +149,22 @@ type Store interface {
 	Metrics() MetricStore
 	Stats() StatStore
 	Notifications() NotifyStore
+	ScopedNotifications(scope string) NotifyStore
+	Incidents() IncidentStore
+	Issues() IssueStore
+	Releases() ReleaseStore
+	Outbox() OutboxStore
+	Silences() SilenceStore
+	SetNotifyPolicy(p NotifyPolicy) error
+	SetService(service string)
+	SetOutboxMaxAge(maxAge time.Duration)
 }
 
 type dbStore struct {
-	db *sql.DB
+	db           *sql.DB
+	policy       NotifyPolicy
+	service      string
+	outboxMaxAge time.Duration
 }
 
 func NewStore() Store {
@@ -74,7 +179,7 @@ func (s *dbStore) Init() []error {
 }
 
 func (s *dbStore) Errors() ErrorStore {
-	return &errorStore{s.db}
+	return &errorStore{s.db, s.service}
 }
 
 func (s *dbStore) Metrics() MetricStore {
@@ -82,12 +187,55 @@ func (s *dbStore) Metrics() MetricStore {
 }
 
 func (s *dbStore) Notifications() NotifyStore {
-	return &notifyStore{s.db}
+	return &notifyStore{s.db, "", s.policy}
+}
+
+func (s *dbStore) ScopedNotifications(scope string) NotifyStore {
+	return &notifyStore{s.db, scope, s.policy}
+}
+
+// SetNotifyPolicy sets the policy of the notify stores returned from now on
+func (s *dbStore) SetNotifyPolicy(p NotifyPolicy) error {
+	if err := p.validate(); err != nil {
+		return err
+	}
+	s.policy = p
+	return nil
+}
+
+// SetService sets the service the error events of the error and release stores returned from now on belong to
+func (s *dbStore) SetService(service string) {
+	s.service = service
+}
+
+// SetOutboxMaxAge sets how long the outbox stores returned from now on retry failed notifications
+func (s *dbStore) SetOutboxMaxAge(maxAge time.Duration) {
+	s.outboxMaxAge = maxAge
 }
 func (s *dbStore) Stats() StatStore {
 	return &statStore{s.db}
 }
 
+func (s *dbStore) Incidents() IncidentStore {
+	return &incidentStore{s.db}
+}
+
+func (s *dbStore) Issues() IssueStore {
+	return &issueStore{s.db}
+}
+
+func (s *dbStore) Releases() ReleaseStore {
+	return &releaseStore{s.db, s.service}
+}
+
+func (s *dbStore) Outbox() OutboxStore {
+	return &outboxStore{s.db, s.outboxMaxAge}
+}
+
+func (s *dbStore) Silences() SilenceStore {
+	return &silenceStore{s.db}
+}
+
 func createTable(db *sql.DB, table string, sql string) error {
 	var err error
 	if hasTable(db, table) {
@@ -110,6 +258,12 @@ func initDB() (*sql.DB, []error) {
 	tables["event_stats"] = SQL_EVENT_STATS
 	tables["day_summary"] = SQL_TABLE_DAY_SUMMARY
 	tables["notifications"] = SQL_TABLE_NOTIFICATIONS
+	tables["incidents"] = SQL_TABLE_INCIDENTS
+	tables["issues"] = SQL_TABLE_ISSUES
+	tables["releases"] = SQL_TABLE_RELEASES
+	tables["outbox"] = SQL_TABLE_OUTBOX
+	tables["silences"] = SQL_TABLE_SILENCES
+	tables["maintenance_windows"] = SQL_TABLE_MAINTENANCE_WINDOWS
 	for table, sql := range tables {
 		err := createTable(db, table, sql)
 		if err == ErrTableExists {
@@ -118,9 +272,107 @@ func initDB() (*sql.DB, []error) {
 			errors = append(errors, err)
 		}
 	}
+	//Tables created by older versions are missing columns that were added later
+	if err := addColumn(db, "error_events", "release_id", "INTEGER"); err != nil {
+		errors = append(errors, err)
+	}
+	if err := addColumn(db, "error_events", "source", "VARCHAR(255) not null default ''"); err != nil {
+		errors = append(errors, err)
+	}
+	if err := addColumn(db, "incidents", "fingerprint", "VARCHAR(40) not null default ''"); err != nil {
+		errors = append(errors, err)
+	}
+	if err := addColumn(db, "incidents", "source", "VARCHAR(255) not null default ''"); err != nil {
+		errors = append(errors, err)
+	}
+	if err := addColumn(db, "incidents", "ack_notified_at", "DATETIME"); err != nil {
+		errors = append(errors, err)
+	}
+	if err := addColumn(db, "outbox", "scope", "VARCHAR(255) not null default ''"); err != nil {
+		errors = append(errors, err)
+	}
+	if err := migrateNotifications(db); err != nil {
+		errors = append(errors, err)
+	}
+	if err := addColumn(db, "notifications", "exception", "VARCHAR(255) not null default ''"); err != nil {
+		errors = append(errors, err)
+	}
+	if err := addColumn(db, "notifications", "decisions", "INTEGER not null default 1"); err != nil {
+		errors = append(errors, err)
+	}
+	// the policy looks up the notifications of a subject and of a dedup key for every event
+	if err := createIndex(db, "notifications_subject", "notifications", "subject, decision"); err != nil {
+		errors = append(errors, err)
+	}
+	if err := createIndex(db, "notifications_dedup_key", "notifications", "dedup_key, decision"); err != nil {
+		errors = append(errors, err)
+	}
 	return db, errors
 }
 
+// migrateNotifications recreates the notifications table of older versions without its unique constraint so that decisions can be recorded
+func migrateNotifications(db *sql.DB) error {
+	if hasColumn(db, "notifications", "decision") {
+		return nil
+	}
+	log.Printf("Migrating [notifications]\n")
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	for _, statement := range []string{
+		`alter table notifications rename to notifications_old`,
+		SQL_TABLE_NOTIFICATIONS,
+		`insert into notifications(id, created_at, subject, dedup_key, sent_at, severity, decision, reason)
+		select id, created_at, subject, subject, created_at, '', '` + DECISION_SENT + `', '' from notifications_old`,
+		`drop table notifications_old`,
+	} {
+		if _, err := tx.Exec(statement); err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// countRows counts the rows of the table that match the where clause
+func countRows(db *sql.DB, table, where string, args []interface{}) (int, error) {
+	var count int
+	err := db.QueryRow("select count(*) from "+table+where, args...).Scan(&count)
+	return count, err
+}
+
+func createIndex(db *sql.DB, name, table, columns string) error {
+	_, err := db.Exec(fmt.Sprintf(`create index if not exists %v on %v(%v)`, name, table, columns))
+	return err
+}
+
+func addColumn(db *sql.DB, table, column, definition string) error {
+	if hasColumn(db, table, column) {
+		return nil
+	}
+	log.Printf("Adding column [%v] to [%v]\n", column, table)
+	_, err := db.Exec(fmt.Sprintf("alter table %v add column %v %v", table, column, definition))
+	return err
+}
+
+func hasColumn(db *sql.DB, table, column string) bool {
+	rows, err := db.Query(fmt.Sprintf("pragma table_info(%v)", table))
+	if err != nil {
+		return false
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var cid, notNull, pk int
+		var name, columnType string
+		var defaultValue interface{}
+		if err := rows.Scan(&cid, &name, &columnType, &notNull, &defaultValue, &pk); err == nil && name == column {
+			return true
+		}
+	}
+	return false
+}
+
 func hasTable(db *sql.DB, name string) bool {
 	var table string
 	err := db.QueryRow("select name FROM sqlite_master WHERE (type='table' OR type='view') AND name=?", name).Scan(&table)
@@ -27,3 +27,35 @@ func TestNotificationsReturnsStatsStore(t *testing.T) {
 		t.Errorf("Invalid NotificationsStore returned: %v\n", store)
 	}
 }
+
+func TestIncidentsReturnsIncidentStore(t *testing.T) {
+	store := NewStore().Incidents()
+
+	if store == nil {
+		t.Errorf("Invalid IncidentStore returned: %v\n", store)
+	}
+}
+
+func TestReleasesReturnsReleaseStore(t *testing.T) {
+	store := NewStore().Releases()
+
+	if store == nil {
+		t.Errorf("Invalid ReleaseStore returned: %v\n", store)
+	}
+}
+
+func TestOutboxReturnsOutboxStore(t *testing.T) {
+	store := NewStore().Outbox()
+
+	if store == nil {
+		t.Errorf("Invalid OutboxStore returned: %v\n", store)
+	}
+}
+
+func TestSilencesReturnsSilenceStore(t *testing.T) {
+	store := NewStore().Silences()
+
+	if store == nil {
+		t.Errorf("Invalid SilenceStore returned: %v\n", store)
+	}
+}
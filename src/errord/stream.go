@@ -0,0 +1,391 @@
+package errord
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const STREAM_EVENT string = "event"
+const STREAM_DECISION string = "decision"
+const STREAM_BACKLOG int = 1000
+const STREAM_SUBSCRIBER_BUFFER int = 256
+const STREAM_HEARTBEAT time.Duration = 15 * time.Second
+
+const ANOMALY_SILENCED string = "silenced"
+const ANOMALY_REGRESSION string = "regression"
+const ANOMALY_IGNORED string = "ignored"
+const ANOMALY_ALWAYS string = "always"
+const ANOMALY_RATE string = "rate"
+const ANOMALY_NEW string = "new"
+const ANOMALY_THRESHOLD string = "threshold"
+
+/*
+AnomalyDecision is what the stat engine decided about an error event. Count is the number of times the exception was seen in the
+window of a rate rule or today, and Limit is the count at which it is notified
+*/
+type AnomalyDecision struct {
+	Exception string
+	Source    string
+	Level     Level
+	Timestamp *time.Time
+	Decision  string
+	Notify    bool
+	Count     int
+	Limit     int
+	Rule      *Rule `json:",omitempty"`
+}
+
+// StreamMessage is an error event or an anomaly decision pushed to stream clients. Ids increase by one from the start of errord
+type StreamMessage struct {
+	Id       int64
+	Type     string
+	Event    *ErrorEvent      `json:",omitempty"`
+	Decision *AnomalyDecision `json:",omitempty"`
+}
+
+func (m *StreamMessage) fields() (exception, source string, level Level) {
+	if m.Event != nil {
+		return m.Event.Exception, m.Event.Source, m.Event.Level
+	}
+	return m.Decision.Exception, m.Decision.Source, m.Decision.Level
+}
+
+/*
+StreamFilter selects the messages a client is sent. Exception and Source are regular expressions and Level and Type, event or
+decision, must match exactly
+*/
+type StreamFilter struct {
+	Exception string
+	Source    string
+	Level     Level
+	Type      string
+	exception *regexp.Regexp
+	source    *regexp.Regexp
+}
+
+// ParseStreamFilter reads a filter from the exception, source, level and type URL parameters
+func ParseStreamFilter(values url.Values) (StreamFilter, error) {
+	f := StreamFilter{Exception: values.Get("exception"), Source: values.Get("source"), Level: Level(strings.ToUpper(values.Get("level"))),
+		Type: values.Get("type")}
+	if f.Type != "" && f.Type != STREAM_EVENT && f.Type != STREAM_DECISION {
+		return f, fmt.Errorf("Invalid type: must be %v or %v", STREAM_EVENT, STREAM_DECISION)
+	}
+	var err error
+	if f.exception, err = regexp.Compile(f.Exception); err != nil {
+		return f, fmt.Errorf("Invalid exception: %v", err)
+	}
+	if f.source, err = regexp.Compile(f.Source); err != nil {
+		return f, fmt.Errorf("Invalid source: %v", err)
+	}
+	return f, nil
+}
+
+func (f StreamFilter) matches(m *StreamMessage) bool {
+	if f.Type != "" && f.Type != m.Type {
+		return false
+	}
+	exception, source, level := m.fields()
+	if f.exception != nil && !f.exception.MatchString(exception) {
+		return false
+	}
+	if f.source != nil && !f.source.MatchString(source) {
+		return false
+	}
+	return f.Level == EMPTY_LOG_LEVEL || f.Level == level
+}
+
+/*
+Stream pushes error events and anomaly decisions to the clients of the HTTP API as they happen. The last messages are kept so that
+a client that reconnects with the id of the last message it received is sent the messages it missed. A client that does not keep
+up is disconnected and has to resume
+*/
+type Stream struct {
+	lock        sync.Mutex
+	lastId      int64
+	backlog     []*StreamMessage
+	subscribers map[chan *StreamMessage]StreamFilter
+}
+
+// NewStream creates a stream that keeps the last size messages for clients that resume
+func NewStream(size int) *Stream {
+	s := new(Stream)
+	s.backlog = make([]*StreamMessage, 0, size)
+	s.subscribers = make(map[chan *StreamMessage]StreamFilter)
+	return s
+}
+
+func (s *Stream) PublishEvent(e *ErrorEvent) {
+	s.publish(&StreamMessage{Type: STREAM_EVENT, Event: e})
+}
+
+func (s *Stream) PublishDecision(d *AnomalyDecision) {
+	s.publish(&StreamMessage{Type: STREAM_DECISION, Decision: d})
+}
+
+func (s *Stream) publish(m *StreamMessage) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.lastId++
+	m.Id = s.lastId
+	if len(s.backlog) == cap(s.backlog) && len(s.backlog) > 0 {
+		copy(s.backlog, s.backlog[1:])
+		s.backlog = s.backlog[:len(s.backlog)-1]
+	}
+	if cap(s.backlog) > 0 {
+		s.backlog = append(s.backlog, m)
+	}
+	for ch, filter := range s.subscribers {
+		if !filter.matches(m) {
+			continue
+		}
+		select {
+		case ch <- m:
+		default:
+			log.Printf("Stream subscriber is %v messages behind. Disconnecting it\n", len(ch))
+			delete(s.subscribers, ch)
+			close(ch)
+		}
+	}
+}
+
+/*
+Subscribe returns the messages after lastId that the filter matches and a channel the messages that are published from now on are
+sent to. With a negative lastId no messages are replayed. The channel is closed when the subscriber falls behind
+*/
+func (s *Stream) Subscribe(f StreamFilter, lastId int64) ([]*StreamMessage, chan *StreamMessage) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	missed := []*StreamMessage{}
+	if lastId >= 0 {
+		for _, m := range s.backlog {
+			if m.Id > lastId && f.matches(m) {
+				missed = append(missed, m)
+			}
+		}
+	}
+	ch := make(chan *StreamMessage, STREAM_SUBSCRIBER_BUFFER)
+	s.subscribers[ch] = f
+	return missed, ch
+}
+
+func (s *Stream) Unsubscribe(ch chan *StreamMessage) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if _, ok := s.subscribers[ch]; ok {
+		delete(s.subscribers, ch)
+		close(ch)
+	}
+}
+
+// Listen publishes every event read from the event bus until it is closed
+func (s *Stream) Listen(events chan ErrorEvent) {
+	for event := range events {
+		e := event
+		s.PublishEvent(&e)
+	}
+}
+
+// lastEventId is the id a client resumes from, given by the Last-Event-ID header or the lastEventId parameter, or -1
+func lastEventId(r *http.Request) (int64, error) {
+	value := r.Header.Get("Last-Event-ID")
+	if value == "" {
+		value = r.URL.Query().Get("lastEventId")
+	}
+	if value == "" {
+		return -1, nil
+	}
+	id, err := strconv.ParseInt(value, 10, 64)
+	if err != nil || id < 0 {
+		return -1, fmt.Errorf("Invalid last event id: %v", value)
+	}
+	return id, nil
+}
+
+func (s *Stream) subscribe(w http.ResponseWriter, r *http.Request) ([]*StreamMessage, chan *StreamMessage, bool) {
+	filter, err := ParseStreamFilter(r.URL.Query())
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return nil, nil, false
+	}
+	lastId, err := lastEventId(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return nil, nil, false
+	}
+	missed, ch := s.Subscribe(filter, lastId)
+	return missed, ch, true
+}
+
+// ServeHTTP streams the messages as Server-Sent Events named after the message type, with the message as JSON data
+func (s *Stream) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		writeError(w, http.StatusInternalServerError, fmt.Errorf("Streaming is not supported"))
+		return
+	}
+	missed, ch, ok := s.subscribe(w, r)
+	if !ok {
+		return
+	}
+	defer s.Unsubscribe(ch)
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	for _, m := range missed {
+		if err := writeServerSentEvent(w, m); err != nil {
+			return
+		}
+	}
+	flusher.Flush()
+	heartbeat := time.NewTicker(STREAM_HEARTBEAT)
+	defer heartbeat.Stop()
+	for {
+		select {
+		case m, ok := <-ch:
+			if !ok {
+				return
+			}
+			if err := writeServerSentEvent(w, m); err != nil {
+				return
+			}
+		case <-heartbeat.C:
+			if _, err := fmt.Fprint(w, ": heartbeat\n\n"); err != nil {
+				return
+			}
+		case <-r.Context().Done():
+			return
+		}
+		flusher.Flush()
+	}
+}
+
+func writeServerSentEvent(w http.ResponseWriter, m *StreamMessage) error {
+	data, err := json.Marshal(m)
+	if err != nil {
+		log.Printf("Failed encoding stream message %v: %v\n", m.Id, err)
+		return nil
+	}
+	_, err = fmt.Fprintf(w, "id: %v\nevent: %v\ndata: %s\n\n", m.Id, m.Type, data)
+	return err
+}
+
+// ServeWebSocket streams every message as a JSON text message over a WebSocket
+func (s *Stream) ServeWebSocket(w http.ResponseWriter, r *http.Request) {
+	missed, ch, ok := s.subscribe(w, r)
+	if !ok {
+		return
+	}
+	defer s.Unsubscribe(ch)
+	conn, err := upgradeWebSocket(w, r)
+	if err != nil {
+		log.Printf("Failed upgrading stream to a WebSocket: %v\n", err)
+		return
+	}
+	defer conn.Close()
+	closed := make(chan struct{})
+	go func() {
+		conn.readUntilClosed()
+		close(closed)
+	}()
+	write := func(m *StreamMessage) bool {
+		data, err := json.Marshal(m)
+		if err != nil {
+			log.Printf("Failed encoding stream message %v: %v\n", m.Id, err)
+			return true
+		}
+		return conn.WriteText(data) == nil
+	}
+	for _, m := range missed {
+		if !write(m) {
+			return
+		}
+	}
+	heartbeat := time.NewTicker(STREAM_HEARTBEAT)
+	defer heartbeat.Stop()
+	for {
+		select {
+		case m, ok := <-ch:
+			if !ok || !write(m) {
+				return
+			}
+		case <-heartbeat.C:
+			if conn.write(WEBSOCKET_PING, nil) != nil {
+				return
+			}
+		case <-closed:
+			return
+		}
+	}
+}
+
+/*
+FollowStream reads the Server-Sent Events at streamURL and calls handle with every message. When the connection is lost it
+reconnects after retry and resumes after the last message handled. It only returns when the stream refuses the request
+*/
+func FollowStream(streamURL string, retry time.Duration, handle func(m *StreamMessage)) error {
+	lastId := int64(-1)
+	for {
+		req, err := http.NewRequest("GET", streamURL, nil)
+		if err != nil {
+			return err
+		}
+		req.Header.Set("Accept", "text/event-stream")
+		if lastId >= 0 {
+			req.Header.Set("Last-Event-ID", strconv.FormatInt(lastId, 10))
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err == nil && resp.StatusCode != http.StatusOK {
+			body, _ := ioutil.ReadAll(resp.Body)
+			resp.Body.Close()
+			return fmt.Errorf("Stream responded with %v: %s", resp.Status, strings.TrimSpace(string(body)))
+		}
+		if err == nil {
+			err = readServerSentEvents(resp.Body, func(m *StreamMessage) {
+				lastId = m.Id
+				handle(m)
+			})
+			resp.Body.Close()
+		}
+		log.Printf("Lost the stream at %v: %v. Reconnecting in %v\n", streamURL, err, retry)
+		time.Sleep(retry)
+	}
+}
+
+// readServerSentEvents decodes the data of every event read from r as a message until r ends
+func readServerSentEvents(r io.Reader, handle func(m *StreamMessage)) error {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	data := ""
+	for scanner.Scan() {
+		line := scanner.Text()
+		switch {
+		case line == "":
+			if data != "" {
+				m := new(StreamMessage)
+				if err := json.Unmarshal([]byte(data), m); err != nil {
+					log.Printf("Failed decoding stream message: %v\n", err)
+				} else {
+					handle(m)
+				}
+			}
+			data = ""
+		case strings.HasPrefix(line, "data:"):
+			data += strings.TrimPrefix(strings.TrimPrefix(line, "data:"), " ")
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+	return io.EOF
+}
@@ -0,0 +1,204 @@
+package errord
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+func streamEvent(exception, source string, level Level) *ErrorEvent {
+	now := time.Date(2026, 10, 19, 9, 0, 0, 0, time.UTC)
+	return &ErrorEvent{Event: Event{Timestamp: &now, Level: level, Source: source, Description: "failed"}, Exception: exception}
+}
+
+func TestStreamFilterMatchesExceptionSourceLevelAndType(t *testing.T) {
+	f, err := ParseStreamFilter(url.Values{"exception": {"SQL"}, "source": {"^db"}, "level": {"error"}})
+	if err != nil {
+		t.Fatalf("Expected a valid filter: %v", err)
+	}
+	if !f.matches(&StreamMessage{Type: STREAM_EVENT, Event: streamEvent("java.sql.SQLException", "db.pool", ERROR_LOG_LEVEL)}) {
+		t.Errorf("Expected the filter to match the event")
+	}
+	if f.matches(&StreamMessage{Type: STREAM_EVENT, Event: streamEvent("java.io.IOException", "db.pool", ERROR_LOG_LEVEL)}) {
+		t.Errorf("Expected the filter not to match another exception")
+	}
+	if f.matches(&StreamMessage{Type: STREAM_EVENT, Event: streamEvent("java.sql.SQLException", "web.db", ERROR_LOG_LEVEL)}) {
+		t.Errorf("Expected the filter not to match another source")
+	}
+	if f.matches(&StreamMessage{Type: STREAM_EVENT, Event: streamEvent("java.sql.SQLException", "db.pool", INFO_LOG_LEVEL)}) {
+		t.Errorf("Expected the filter not to match another level")
+	}
+	decision := &AnomalyDecision{Exception: "java.sql.SQLException", Source: "db.pool", Level: ERROR_LOG_LEVEL, Decision: ANOMALY_NEW}
+	if !f.matches(&StreamMessage{Type: STREAM_DECISION, Decision: decision}) {
+		t.Errorf("Expected the filter to match the decision")
+	}
+	f, _ = ParseStreamFilter(url.Values{"type": {STREAM_EVENT}})
+	if f.matches(&StreamMessage{Type: STREAM_DECISION, Decision: decision}) {
+		t.Errorf("Expected an event filter not to match a decision")
+	}
+	if _, err := ParseStreamFilter(url.Values{"exception": {"("}}); err == nil {
+		t.Errorf("Expected an invalid regular expression to be refused")
+	}
+	if _, err := ParseStreamFilter(url.Values{"type": {"metric"}}); err == nil {
+		t.Errorf("Expected an unknown type to be refused")
+	}
+}
+
+func TestStreamResumesAfterLastId(t *testing.T) {
+	s := NewStream(3)
+	for i := 0; i < 5; i++ {
+		s.PublishEvent(streamEvent(fmt.Sprintf("Exception%v", i), "app", ERROR_LOG_LEVEL))
+	}
+	missed, ch := s.Subscribe(StreamFilter{}, 3)
+	defer s.Unsubscribe(ch)
+	if len(missed) != 2 || missed[0].Id != 4 || missed[1].Id != 5 {
+		t.Errorf("Expected messages 4 and 5 to be replayed, got %v", missed)
+	}
+	missed, ch2 := s.Subscribe(StreamFilter{}, 0)
+	defer s.Unsubscribe(ch2)
+	if len(missed) != 3 || missed[0].Id != 3 {
+		t.Errorf("Expected the 3 kept messages to be replayed, got %v", missed)
+	}
+	missed, ch3 := s.Subscribe(StreamFilter{}, -1)
+	defer s.Unsubscribe(ch3)
+	if len(missed) != 0 {
+		t.Errorf("Expected nothing to be replayed without a last id, got %v", missed)
+	}
+
+	s.PublishDecision(&AnomalyDecision{Exception: "Exception4", Decision: ANOMALY_THRESHOLD, Notify: true, Count: 12, Limit: 10})
+	m := <-ch
+	if m.Id != 6 || m.Type != STREAM_DECISION || m.Decision.Limit != 10 {
+		t.Errorf("Expected decision 6 to be sent live, got %v", m)
+	}
+}
+
+func TestStreamDisconnectsSlowSubscriber(t *testing.T) {
+	s := NewStream(0)
+	_, ch := s.Subscribe(StreamFilter{}, -1)
+	for i := 0; i <= STREAM_SUBSCRIBER_BUFFER; i++ {
+		s.PublishEvent(streamEvent("java.sql.SQLException", "app", ERROR_LOG_LEVEL))
+	}
+	received := 0
+	for range ch {
+		received++
+	}
+	if received != STREAM_SUBSCRIBER_BUFFER {
+		t.Errorf("Expected %v buffered messages before the channel was closed, got %v", STREAM_SUBSCRIBER_BUFFER, received)
+	}
+	if len(s.subscribers) != 0 {
+		t.Errorf("Expected the slow subscriber to be removed")
+	}
+}
+
+func TestStreamServerSentEvents(t *testing.T) {
+	s := NewStream(10)
+	s.PublishEvent(streamEvent("java.sql.SQLException", "app", ERROR_LOG_LEVEL))
+	s.PublishEvent(streamEvent("java.io.IOException", "app", ERROR_LOG_LEVEL))
+	server := httptest.NewServer(NewAPI(nil, nil, s, ""))
+	defer server.Close()
+
+	req, _ := http.NewRequest("GET", server.URL+"/stream?exception=IOException", nil)
+	req.Header.Set("Last-Event-ID", "0")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("Failed connecting to the stream: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.Header.Get("Content-Type") != "text/event-stream" {
+		t.Errorf("Expected an event stream, got %v", resp.Header.Get("Content-Type"))
+	}
+	reader := bufio.NewReader(resp.Body)
+	for _, expected := range []string{"id: 2\n", "event: event\n"} {
+		if line, _ := reader.ReadString('\n'); line != expected {
+			t.Errorf("Expected %q, got %q", expected, line)
+		}
+	}
+	if line, _ := reader.ReadString('\n'); !strings.HasPrefix(line, "data: {\"Id\":2,\"Type\":\"event\"") {
+		t.Errorf("Expected the message as JSON data, got %q", line)
+	}
+	reader.ReadString('\n')
+
+	s.PublishDecision(&AnomalyDecision{Exception: "java.io.IOException", Decision: ANOMALY_NEW, Notify: true})
+	messages := make(chan *StreamMessage, 1)
+	go readServerSentEvents(reader, func(m *StreamMessage) { messages <- m })
+	select {
+	case m := <-messages:
+		if m.Id != 3 || m.Decision == nil || m.Decision.Decision != ANOMALY_NEW {
+			t.Errorf("Expected decision 3, got %v", m)
+		}
+	case <-time.After(2 * time.Second):
+		t.Errorf("Expected the decision to be streamed")
+	}
+
+	resp, _ = http.Get(server.URL + "/stream?level=ERROR&lastEventId=x")
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("Expected an invalid last event id to be refused, got %v", resp.Status)
+	}
+}
+
+func TestWebSocketAccept(t *testing.T) {
+	if accept := webSocketAccept("dGhlIHNhbXBsZSBub25jZQ=="); accept != "s3pPLMBiTxaQ9kYGzzhZRbK+xOo=" {
+		t.Errorf("Expected the accept key of RFC 6455, got %v", accept)
+	}
+}
+
+func TestWebSocketFrames(t *testing.T) {
+	for _, size := range []int{5, 300, 70000} {
+		payload := []byte(strings.Repeat("x", size))
+		frame := webSocketFrame(WEBSOCKET_TEXT, payload)
+		opcode, read, err := readWebSocketFrame(bufio.NewReader(strings.NewReader(string(frame))))
+		if size > int(WEBSOCKET_MAX_FRAME) {
+			if err != ErrWebSocketFrameTooLarge {
+				t.Errorf("Expected a frame of %v bytes to be refused, got %v", size, err)
+			}
+			continue
+		}
+		if err != nil || opcode != WEBSOCKET_TEXT || string(read) != string(payload) {
+			t.Errorf("Expected a text frame of %v bytes, got %v %v bytes %v", size, opcode, len(read), err)
+		}
+	}
+	// frames from clients are masked
+	masked := []byte{0x80 | WEBSOCKET_PING, 0x80 | 2, 1, 2, 3, 4, 'h' ^ 1, 'i' ^ 2}
+	opcode, payload, err := readWebSocketFrame(bufio.NewReader(strings.NewReader(string(masked))))
+	if err != nil || opcode != WEBSOCKET_PING || string(payload) != "hi" {
+		t.Errorf("Expected an unmasked ping, got %v %q %v", opcode, payload, err)
+	}
+}
+
+func TestStreamWebSocket(t *testing.T) {
+	s := NewStream(10)
+	s.PublishEvent(streamEvent("java.sql.SQLException", "app", ERROR_LOG_LEVEL))
+	server := httptest.NewServer(NewAPI(nil, nil, s, ""))
+	defer server.Close()
+
+	conn, err := net.Dial("tcp", strings.TrimPrefix(server.URL, "http://"))
+	if err != nil {
+		t.Fatalf("Failed connecting: %v", err)
+	}
+	defer conn.Close()
+	fmt.Fprintf(conn, "GET /stream/ws?lastEventId=0 HTTP/1.1\r\nHost: errord\r\nUpgrade: websocket\r\nConnection: Upgrade\r\n"+
+		"Sec-WebSocket-Key: dGhlIHNhbXBsZSBub25jZQ==\r\nSec-WebSocket-Version: 13\r\n\r\n")
+	reader := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(reader, nil)
+	if err != nil || resp.StatusCode != http.StatusSwitchingProtocols {
+		t.Fatalf("Expected the connection to be upgraded, got %v %v", resp, err)
+	}
+	if resp.Header.Get("Sec-WebSocket-Accept") != "s3pPLMBiTxaQ9kYGzzhZRbK+xOo=" {
+		t.Errorf("Expected the accept key, got %v", resp.Header.Get("Sec-WebSocket-Accept"))
+	}
+	opcode, payload, err := readWebSocketFrame(reader)
+	if err != nil || opcode != WEBSOCKET_TEXT || !strings.Contains(string(payload), `"Exception":"java.sql.SQLException"`) {
+		t.Errorf("Expected the missed event as a text message, got %v %s %v", opcode, payload, err)
+	}
+	s.PublishEvent(streamEvent("java.io.IOException", "app", ERROR_LOG_LEVEL))
+	opcode, payload, err = readWebSocketFrame(reader)
+	if err != nil || !strings.Contains(string(payload), `"Id":2`) {
+		t.Errorf("Expected the live event, got %v %s %v", opcode, payload, err)
+	}
+}
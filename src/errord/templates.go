@@ -0,0 +1,288 @@
+package errord
+
+import (
+	"bytes"
+	"fmt"
+	htmltemplate "html/template"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/template"
+	"time"
+)
+
+const TEMPLATE_NEW string = "new"
+const TEMPLATE_THRESHOLD string = "threshold"
+const TEMPLATE_RESOLVED string = "resolved"
+const TEMPLATE_REGRESSION string = "regression"
+const TEMPLATE_DIGEST string = "digest"
+
+var TEMPLATE_TYPES = []string{TEMPLATE_NEW, TEMPLATE_THRESHOLD, TEMPLATE_RESOLVED, TEMPLATE_REGRESSION, TEMPLATE_DIGEST}
+
+const TEMPLATE_SUBJECT string = "subject"
+const TEMPLATE_TEXT string = "txt"
+const TEMPLATE_HTML string = "html"
+
+/*
+Templates replace the subject and body of notifications. They are read from a directory with a file per notification type and part,
+for example new.subject.tmpl, new.txt.tmpl and new.html.tmpl. Templates in a sub directory named after a notifier are only used by
+that notifier and take precedence over the templates for all notifiers. The html part is parsed with html/template and the others
+with text/template. Parts without a template keep the built in subject and body, which templates can use as .Subject and .Body
+*/
+type Templates struct {
+	sets map[string]*templateSet
+}
+
+type templateSet struct {
+	subject *template.Template
+	text    *template.Template
+	html    *htmltemplate.Template
+}
+
+// TemplateData is what notification templates are executed with
+type TemplateData struct {
+	Notification *ErrorNotification
+	Type         string
+	Event        *ErrorEvent
+	StackTrace   string
+	Summary      *DaySummary
+	Stats        *StatItem
+	Limit        int
+	History      []*DaySummary
+	Incident     *Incident
+	Digest       []*DigestEntry
+	Links        TemplateLinks
+	Subject      string
+	Body         string
+}
+
+// TemplateLinks are the links a template can use. Chart is the inline chart of an email and only shows in html email templates
+type TemplateLinks struct {
+	Ack   string
+	Chart string
+}
+
+// Rendered is a notification rendered with templates. HTML is empty when there is no html template
+type Rendered struct {
+	Subject string
+	Text    string
+	HTML    string
+}
+
+// LoadTemplates parses the templates in dir. A directory that does not exist has no templates
+func LoadTemplates(dir string) (*Templates, error) {
+	t := &Templates{make(map[string]*templateSet)}
+	if _, err := os.Stat(dir); os.IsNotExist(err) {
+		return t, nil
+	}
+	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil || info.IsDir() || filepath.Ext(path) != ".tmpl" {
+			return err
+		}
+		rel, _ := filepath.Rel(dir, path)
+		notifier := filepath.Dir(rel)
+		if notifier == "." {
+			notifier = ""
+		}
+		parts := strings.Split(strings.TrimSuffix(filepath.Base(rel), ".tmpl"), ".")
+		if len(parts) != 2 || !isTemplateType(parts[0]) {
+			return fmt.Errorf("Template %v must be named <%v>.<subject|txt|html>.tmpl", rel, strings.Join(TEMPLATE_TYPES, "|"))
+		}
+		content, err := ioutil.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		return t.add(notifier, parts[0], parts[1], rel, string(content))
+	})
+	if err != nil {
+		return nil, err
+	}
+	log.Printf("Loaded %v notification template sets from %v\n", len(t.sets), dir)
+	return t, nil
+}
+
+func isTemplateType(name string) bool {
+	for _, t := range TEMPLATE_TYPES {
+		if t == name {
+			return true
+		}
+	}
+	return false
+}
+
+func (t *Templates) add(notifier, kind, part, name, content string) error {
+	key := notifier + "/" + kind
+	set, ok := t.sets[key]
+	if !ok {
+		set = new(templateSet)
+		t.sets[key] = set
+	}
+	var err error
+	switch part {
+	case TEMPLATE_SUBJECT:
+		set.subject, err = template.New(name).Funcs(TEMPLATE_FUNCS).Parse(content)
+	case TEMPLATE_TEXT:
+		set.text, err = template.New(name).Funcs(TEMPLATE_FUNCS).Parse(content)
+	case TEMPLATE_HTML:
+		set.html, err = htmltemplate.New(name).Parse(content)
+	default:
+		err = fmt.Errorf("Template %v must be a subject, txt or html template", name)
+	}
+	return err
+}
+
+func (t *Templates) set(notifier, kind string) *templateSet {
+	if set, ok := t.sets[notifier+"/"+kind]; ok && notifier != "" {
+		return set
+	}
+	return t.sets["/"+kind]
+}
+
+// Render renders the notification with the templates of the notifier. Without templates for the notification nil is returned
+func (t *Templates) Render(notifier string, n *ErrorNotification) (*Rendered, error) {
+	set := t.set(notifier, templateType(n))
+	if set == nil {
+		return nil, nil
+	}
+	data := newTemplateData(n)
+	r := &Rendered{Subject: data.Subject, Text: data.Body}
+	var b bytes.Buffer
+	if set.subject != nil {
+		if err := set.subject.Execute(&b, data); err != nil {
+			return nil, err
+		}
+		r.Subject = strings.TrimSpace(b.String())
+		b.Reset()
+	}
+	if set.text != nil {
+		if err := set.text.Execute(&b, data); err != nil {
+			return nil, err
+		}
+		r.Text = b.String()
+		b.Reset()
+	}
+	if set.html != nil {
+		if err := set.html.Execute(&b, data); err != nil {
+			return nil, err
+		}
+		r.HTML = b.String()
+	}
+	return r, nil
+}
+
+// templateType is the type of template a notification is rendered with. Acknowledged, ongoing and escalated incidents and reports have none
+func templateType(n *ErrorNotification) string {
+	switch n.Kind {
+	case NOTIFY_RESOLVED:
+		return TEMPLATE_RESOLVED
+	case NOTIFY_REGRESSION:
+		return TEMPLATE_REGRESSION
+	case NOTIFY_DIGEST:
+		return TEMPLATE_DIGEST
+	case NOTIFY_DETECTED, NOTIFY_OPENED:
+		if n.isNewError() {
+			return TEMPLATE_NEW
+		}
+		return TEMPLATE_THRESHOLD
+	}
+	return ""
+}
+
+func newTemplateData(n *ErrorNotification) *TemplateData {
+	subject, body := n.describe()
+	d := &TemplateData{Notification: n, Type: templateType(n), Event: n.ErrorEvent, Summary: n.DaySummary, Stats: n.Stats, History: n.History,
+		Incident: n.Incident, Digest: n.Digest, Links: TemplateLinks{Ack: n.AckURL, Chart: "cid:" + CHART_CID}, Subject: subject, Body: body}
+	if n.ErrorEvent != nil {
+		d.StackTrace = n.ErrorEvent.StackTrace()
+	}
+	if n.Stats != nil && n.Rule == nil {
+		d.Limit = n.limit()
+	}
+	return d
+}
+
+// StackTrace is what is kept of the stack trace of the event: the log message and the exception it was caused by
+func (e *ErrorEvent) StackTrace() string {
+	trace := e.Description
+	if e.Exception != "" {
+		trace += fmt.Sprintf("\n%v %v: %v", CAUSED_BY, e.Exception, e.Detail)
+	}
+	return strings.TrimSpace(trace)
+}
+
+// TemplateNotifier renders notifications with the templates of the named notifier before passing them on
+type TemplateNotifier struct {
+	notifier  Notifier
+	templates *Templates
+	name      string
+}
+
+func NewTemplateNotifier(n Notifier, templates *Templates, name string) Notifier {
+	t := new(TemplateNotifier)
+	t.notifier = n
+	t.templates = templates
+	t.name = name
+	return t
+}
+
+func (t *TemplateNotifier) Fire(n *ErrorNotification) error {
+	rendered, err := t.templates.Render(t.name, n)
+	if err != nil {
+		log.Printf("Failed rendering templates of %v for %v notification. Sending the default notification: %v\n", t.name, n.Kind, err)
+	}
+	if rendered == nil {
+		return t.notifier.Fire(n)
+	}
+	copy := *n
+	copy.rendered = rendered
+	return t.notifier.Fire(&copy)
+}
+
+// SampleNotification is a notification of the template type with made up data, used to preview templates
+func SampleNotification(kind string) (*ErrorNotification, error) {
+	now := time.Now().Truncate(time.Second)
+	opened := now.Add(-2 * time.Hour)
+	event := &ErrorEvent{Event: Event{Timestamp: &now, Level: ERROR_LOG_LEVEL, Source: "za.co.example.billing.InvoiceService",
+		Description: "Failed creating invoice 1042"}, Exception: "java.sql.SQLException", Detail: "Connection refused"}
+	history := []*DaySummary{}
+	for i := 6; i >= 0; i-- {
+		history = append(history, &DaySummary{Date: now.AddDate(0, 0, -i), Name: event.Exception, Count: 1, Total: 28 - 3*i})
+	}
+	stats := &StatItem{Name: event.Exception, Mean: 12, Variance: 16, StdDev: 4, Total: 84, DayCount: 7}
+	incident := &Incident{Id: 7, Exception: event.Exception, Fingerprint: event.Fingerprint(), Source: event.Source, State: INCIDENT_OPEN,
+		OpenedAt: opened, UpdatedAt: now, Count: 42}
+	n := &ErrorNotification{ErrorEvent: event, History: history, AckURL: "https://errord.example.com/ack?incident=7&signature=sample"}
+	switch kind {
+	case TEMPLATE_NEW:
+		n.Kind = NOTIFY_OPENED
+		n.Incident = incident
+	case TEMPLATE_THRESHOLD:
+		n.Kind = NOTIFY_OPENED
+		n.Incident = incident
+		n.Stats = stats
+		n.DaySummary = &DaySummary{Date: now, Name: event.Exception, Count: 1, Total: 31}
+	case TEMPLATE_RESOLVED:
+		resolved := now
+		incident.State = INCIDENT_RESOLVED
+		incident.ResolvedAt = &resolved
+		n.Kind = NOTIFY_RESOLVED
+		n.Incident = incident
+		n.ErrorEvent = incident.event()
+		n.AckURL = ""
+	case TEMPLATE_REGRESSION:
+		resolved := now.AddDate(0, 0, -3)
+		n.Kind = NOTIFY_REGRESSION
+		n.Issue = &Issue{Fingerprint: event.Fingerprint(), Exception: event.Exception, Status: ISSUE_RESOLVED, FirstSeen: now.AddDate(0, 0, -30),
+			LastSeen: now, Count: 120, ResolvedAt: &resolved}
+	case TEMPLATE_DIGEST:
+		related := []*ErrorNotification{{ErrorEvent: event, Stats: stats, DaySummary: &DaySummary{Date: now, Name: event.Exception, Total: 31}}}
+		timeout := &ErrorEvent{Event: Event{Timestamp: &opened, Level: ERROR_LOG_LEVEL}, Exception: "java.net.SocketTimeoutException"}
+		related = append(related, &ErrorNotification{ErrorEvent: timeout})
+		n = newDigest(related)
+	default:
+		return nil, fmt.Errorf("Unknown template type '%v'. Must be one of %v", kind, strings.Join(TEMPLATE_TYPES, ", "))
+	}
+	return n, nil
+}
@@ -0,0 +1,89 @@
+package errord
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func writeTemplates(t *testing.T, files map[string]string) string {
+	dir, err := ioutil.TempDir("", "templates")
+	if err != nil {
+		t.Fatalf("Failed creating template dir: %v", err)
+	}
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		os.MkdirAll(filepath.Dir(path), 0755)
+		if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatalf("Failed writing template %v: %v", name, err)
+		}
+	}
+	return dir
+}
+
+func TestTemplatesRenderPerNotifier(t *testing.T) {
+	dir := writeTemplates(t, map[string]string{
+		"new.subject.tmpl":       "New: {{.Event.Exception}}",
+		"new.html.tmpl":          "<p>{{.StackTrace}}</p>",
+		"slack/new.subject.tmpl": "Slack: {{.Event.Exception}}",
+	})
+	defer os.RemoveAll(dir)
+	templates, err := LoadTemplates(dir)
+	if err != nil {
+		t.Fatalf("Valid templates should load: %v", err)
+	}
+
+	n := newTestNotification()
+	rendered, err := templates.Render("email", n)
+	if err != nil || rendered == nil {
+		t.Fatalf("Notifier without its own templates should use the shared templates: %v", err)
+	}
+	if rendered.Subject != "New: java.sql.SQLException" {
+		t.Errorf("Subject should be rendered. Got %v", rendered.Subject)
+	}
+	if _, body := n.describe(); rendered.Text != body {
+		t.Errorf("Text without a template should be the default body. Got %v", rendered.Text)
+	}
+	if !strings.Contains(rendered.HTML, "Access denied for user &#34;app&#34;") {
+		t.Errorf("HTML should be rendered with html escaping. Got %v", rendered.HTML)
+	}
+
+	if rendered, _ := templates.Render("slack", n); rendered.Subject != "Slack: java.sql.SQLException" {
+		t.Errorf("Templates of the notifier should take precedence. Got %v", rendered.Subject)
+	}
+	n.Kind = NOTIFY_ACKNOWLEDGED
+	if rendered, _ := templates.Render("slack", n); rendered != nil {
+		t.Errorf("Notification without templates should not be rendered")
+	}
+}
+
+func TestTemplateNotifierReplacesSubject(t *testing.T) {
+	dir := writeTemplates(t, map[string]string{"new.subject.tmpl": "{{.Event.Exception}} is new"})
+	defer os.RemoveAll(dir)
+	templates, _ := LoadTemplates(dir)
+	recorder := &recordingNotifier{}
+	n := newTestNotification()
+	NewTemplateNotifier(recorder, templates, "email").Fire(n)
+	if len(recorder.fired) != 1 || recorder.fired[0].Subject() != "java.sql.SQLException is new" {
+		t.Fatalf("Notification should be fired with the rendered subject")
+	}
+	if n.Subject() == recorder.fired[0].Subject() {
+		t.Errorf("Notification given to other notifiers should not be changed")
+	}
+}
+
+func TestTemplatesRejectUnknownNames(t *testing.T) {
+	dir := writeTemplates(t, map[string]string{"fixed.subject.tmpl": "{{.Event.Exception}}"})
+	defer os.RemoveAll(dir)
+	if _, err := LoadTemplates(dir); err == nil {
+		t.Errorf("Template of an unknown type should not load")
+	}
+	for _, kind := range TEMPLATE_TYPES {
+		n, err := SampleNotification(kind)
+		if err != nil || templateType(n) != kind {
+			t.Errorf("Sample notification should have the %v template type", kind)
+		}
+	}
+}
@@ -0,0 +1,107 @@
+package errord
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"text/template"
+	"time"
+)
+
+const SIGNATURE_HEADER string = "X-Errord-Signature"
+
+const DEFAULT_WEBHOOK_TEMPLATE string = `{"subject": {{json .Subject}}, "body": {{json .Body}}, "exception": {{json .ErrorEvent.Exception}}, "kind": {{json .Kind}}}`
+
+var ErrInvalidPayload error = errors.New("Webhook template did not produce valid JSON")
+
+var TEMPLATE_FUNCS = template.FuncMap{
+	"json": func(v interface{}) (string, error) {
+		b, err := json.Marshal(v)
+		return string(b), err
+	},
+}
+
+// WebhookNotifier POSTs a JSON body built from a template over the ErrorNotification to a URL
+type WebhookNotifier struct {
+	url      string
+	template *template.Template
+	headers  map[string]string
+	secret   string
+	client   *http.Client
+	store    NotifyStore
+}
+
+func NewWebhookNotifier(url, payload string, headers map[string]string, secret string, timeout time.Duration, store NotifyStore) (Notifier, error) {
+	if payload == "" {
+		payload = DEFAULT_WEBHOOK_TEMPLATE
+	}
+	t, err := template.New("webhook").Funcs(TEMPLATE_FUNCS).Parse(payload)
+	if err != nil {
+		return nil, err
+	}
+	n := new(WebhookNotifier)
+	n.url = url
+	n.template = t
+	n.headers = headers
+	n.secret = secret
+	n.client = &http.Client{Timeout: timeout}
+	n.store = store
+	return n, nil
+}
+
+func (n *WebhookNotifier) Fire(notification *ErrorNotification) error {
+	if n.store.HasNotification(notification) {
+		log.Printf("Notification already sent for %v\n", notification.ErrorEvent)
+		return nil
+	}
+	var payload bytes.Buffer
+	if err := n.template.Execute(&payload, notification); err != nil {
+		return err
+	}
+	if !json.Valid(payload.Bytes()) {
+		return ErrInvalidPayload
+	}
+	// a failed post is retried with backoff by the outbox
+	if err := n.post(payload.Bytes()); err != nil {
+		log.Printf("Failed posting to webhook %v -> %v\n", n.url, err)
+		return err
+	}
+	log.Printf("Notification Sent to webhook! Updating Store\n")
+	markSent(n.store, notification)
+	return nil
+}
+
+func (n *WebhookNotifier) post(payload []byte) error {
+	req, err := http.NewRequest("POST", n.url, bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for name, value := range n.headers {
+		req.Header.Set(name, value)
+	}
+	if n.secret != "" {
+		req.Header.Set(SIGNATURE_HEADER, "sha256="+sign(n.secret, payload))
+	}
+	resp, err := n.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("Webhook responded with %v", resp.Status)
+	}
+	return nil
+}
+
+func sign(secret string, payload []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(payload)
+	return hex.EncodeToString(mac.Sum(nil))
+}
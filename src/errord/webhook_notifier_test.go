@@ -0,0 +1,108 @@
+package errord
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+type memNotifyStore struct {
+	sent map[string]bool
+}
+
+func newMemNotifyStore() *memNotifyStore {
+	return &memNotifyStore{make(map[string]bool)}
+}
+
+func (s *memNotifyStore) UpdateNotificationSent(n *ErrorNotification) error {
+	s.sent[n.key()] = true
+	return nil
+}
+
+func (s *memNotifyStore) HasNotification(n *ErrorNotification) bool {
+	return s.sent[n.key()]
+}
+
+func (s *memNotifyStore) Decide(n *ErrorNotification) bool {
+	return !s.HasNotification(n)
+}
+
+func (s *memNotifyStore) FetchNotifications(since time.Time) []*NotificationRecord {
+	return []*NotificationRecord{}
+}
+
+func (s *memNotifyStore) QueryNotifications(q Query) ([]*NotificationRecord, int, error) {
+	return []*NotificationRecord{}, 0, nil
+}
+
+func newTestNotification() *ErrorNotification {
+	event := newErrorEvent("java.sql.SQLException", newTime(2016, 3, 31, 12, 0, 0))
+	event.Detail = `Access denied for user "app"`
+	return &ErrorNotification{ErrorEvent: &event}
+}
+
+func TestWebhookNotifierPostsTemplatedJSON(t *testing.T) {
+	var body []byte
+	var header http.Header
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ = ioutil.ReadAll(r.Body)
+		header = r.Header
+	}))
+	defer server.Close()
+
+	store := newMemNotifyStore()
+	payload := `{"text": {{json .Subject}}, "detail": {{json .ErrorEvent.Detail}}}`
+	notifier, err := NewWebhookNotifier(server.URL, payload, map[string]string{"X-Team": "recharge"}, "secret", time.Second, store)
+	if err != nil {
+		t.Fatalf("Valid template should not return an error: %v", err)
+	}
+	notification := newTestNotification()
+	if err := notifier.Fire(notification); err != nil {
+		t.Fatalf("Fire should not fail when the webhook accepts the notification: %v", err)
+	}
+
+	var received map[string]string
+	if err := json.Unmarshal(body, &received); err != nil {
+		t.Fatalf("Webhook should receive valid JSON. Got %s", body)
+	}
+	if received["text"] != "New Error: java.sql.SQLException" || received["detail"] != `Access denied for user "app"` {
+		t.Errorf("Webhook body was not built from the template. Got %v", received)
+	}
+	if header.Get("X-Team") != "recharge" || header.Get("Content-Type") != "application/json" {
+		t.Errorf("Webhook should receive the configured headers. Got %v", header)
+	}
+	if header.Get(SIGNATURE_HEADER) != "sha256="+sign("secret", body) {
+		t.Errorf("Webhook should receive the HMAC of the body. Got %v", header.Get(SIGNATURE_HEADER))
+	}
+	if !store.HasNotification(notification) {
+		t.Errorf("Notification should be marked as sent")
+	}
+}
+
+func TestWebhookNotifierLeavesRetriesToTheOutbox(t *testing.T) {
+	attempts := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		attempts++
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	store := newMemNotifyStore()
+	notifier, _ := NewWebhookNotifier(server.URL, "", nil, "", time.Second, store)
+	if err := notifier.Fire(newTestNotification()); err == nil || attempts != 1 {
+		t.Errorf("Fire should fail after one attempt so that the outbox retries it. Got %v after %v attempts", err, attempts)
+	}
+	if store.HasNotification(newTestNotification()) {
+		t.Errorf("Failed notification should not be marked as sent")
+	}
+}
+
+func TestWebhookNotifierRejectsInvalidJSON(t *testing.T) {
+	notifier, _ := NewWebhookNotifier("http://localhost", `{"text": {{.Subject}}}`, nil, "", time.Second, newMemNotifyStore())
+	if err := notifier.Fire(newTestNotification()); err != ErrInvalidPayload {
+		t.Errorf("Template that does not produce JSON should not be posted. Got %v", err)
+	}
+}
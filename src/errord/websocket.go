@@ -0,0 +1,172 @@
+package errord
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+)
+
+const WEBSOCKET_GUID string = "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"
+const WEBSOCKET_MAX_FRAME int64 = 1 << 16
+
+const WEBSOCKET_TEXT byte = 0x1
+const WEBSOCKET_CLOSE byte = 0x8
+const WEBSOCKET_PING byte = 0x9
+const WEBSOCKET_PONG byte = 0xA
+
+var ErrNotWebSocket error = errors.New("Request is not a WebSocket upgrade")
+var ErrWebSocketFrameTooLarge error = errors.New("WebSocket frame is too large")
+
+/*
+wsConn is the server side of a WebSocket (RFC 6455) that is only written to. Frames read from the client are only used to answer
+pings and to notice the client closing the connection
+*/
+type wsConn struct {
+	conn   net.Conn
+	reader *bufio.Reader
+	lock   sync.Mutex
+}
+
+// upgradeWebSocket completes the opening handshake of the request and takes over its connection
+func upgradeWebSocket(w http.ResponseWriter, r *http.Request) (*wsConn, error) {
+	key := r.Header.Get("Sec-WebSocket-Key")
+	if !headerContains(r.Header, "Connection", "upgrade") || !headerContains(r.Header, "Upgrade", "websocket") || key == "" {
+		http.Error(w, ErrNotWebSocket.Error(), http.StatusBadRequest)
+		return nil, ErrNotWebSocket
+	}
+	hijacker, ok := w.(http.Hijacker)
+	if !ok {
+		http.Error(w, "WebSockets are not supported", http.StatusInternalServerError)
+		return nil, ErrNotWebSocket
+	}
+	conn, rw, err := hijacker.Hijack()
+	if err != nil {
+		return nil, err
+	}
+	response := "HTTP/1.1 101 Switching Protocols\r\nUpgrade: websocket\r\nConnection: Upgrade\r\nSec-WebSocket-Accept: " +
+		webSocketAccept(key) + "\r\n\r\n"
+	if _, err := conn.Write([]byte(response)); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return &wsConn{conn: conn, reader: rw.Reader}, nil
+}
+
+func webSocketAccept(key string) string {
+	h := sha1.New()
+	io.WriteString(h, key+WEBSOCKET_GUID)
+	return base64.StdEncoding.EncodeToString(h.Sum(nil))
+}
+
+func headerContains(h http.Header, name, token string) bool {
+	for _, value := range h[http.CanonicalHeaderKey(name)] {
+		for _, t := range strings.Split(value, ",") {
+			if strings.EqualFold(strings.TrimSpace(t), token) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func (c *wsConn) WriteText(data []byte) error {
+	return c.write(WEBSOCKET_TEXT, data)
+}
+
+func (c *wsConn) write(opcode byte, payload []byte) error {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	_, err := c.conn.Write(webSocketFrame(opcode, payload))
+	return err
+}
+
+// Close sends a close frame and closes the connection
+func (c *wsConn) Close() error {
+	c.write(WEBSOCKET_CLOSE, nil)
+	return c.conn.Close()
+}
+
+// readUntilClosed reads frames from the client, answering pings, until the client closes the connection or it fails
+func (c *wsConn) readUntilClosed() {
+	for {
+		opcode, payload, err := readWebSocketFrame(c.reader)
+		if err != nil {
+			return
+		}
+		switch opcode {
+		case WEBSOCKET_CLOSE:
+			return
+		case WEBSOCKET_PING:
+			if c.write(WEBSOCKET_PONG, payload) != nil {
+				return
+			}
+		}
+	}
+}
+
+// webSocketFrame is an unfragmented, unmasked frame as sent by a server
+func webSocketFrame(opcode byte, payload []byte) []byte {
+	frame := []byte{0x80 | opcode}
+	switch n := len(payload); {
+	case n < 126:
+		frame = append(frame, byte(n))
+	case n <= 0xFFFF:
+		frame = append(frame, 126, 0, 0)
+		binary.BigEndian.PutUint16(frame[2:], uint16(n))
+	default:
+		frame = append(frame, 127, 0, 0, 0, 0, 0, 0, 0, 0)
+		binary.BigEndian.PutUint64(frame[2:], uint64(n))
+	}
+	return append(frame, payload...)
+}
+
+// readWebSocketFrame reads a frame and unmasks its payload. Frames larger than WEBSOCKET_MAX_FRAME are refused
+func readWebSocketFrame(r *bufio.Reader) (byte, []byte, error) {
+	header := make([]byte, 2)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return 0, nil, err
+	}
+	opcode := header[0] & 0x0F
+	masked := header[1]&0x80 != 0
+	length := int64(header[1] & 0x7F)
+	switch length {
+	case 126:
+		b := make([]byte, 2)
+		if _, err := io.ReadFull(r, b); err != nil {
+			return 0, nil, err
+		}
+		length = int64(binary.BigEndian.Uint16(b))
+	case 127:
+		b := make([]byte, 8)
+		if _, err := io.ReadFull(r, b); err != nil {
+			return 0, nil, err
+		}
+		length = int64(binary.BigEndian.Uint64(b))
+	}
+	if length < 0 || length > WEBSOCKET_MAX_FRAME {
+		return 0, nil, ErrWebSocketFrameTooLarge
+	}
+	mask := make([]byte, 4)
+	if masked {
+		if _, err := io.ReadFull(r, mask); err != nil {
+			return 0, nil, err
+		}
+	}
+	payload := make([]byte, length)
+	if _, err := io.ReadFull(r, payload); err != nil {
+		return 0, nil, err
+	}
+	if masked {
+		for i := range payload {
+			payload[i] ^= mask[i%4]
+		}
+	}
+	return opcode, payload, nil
+}
@@ -8,11 +8,14 @@ import (
 	_ "github.com/mattn/go-sqlite3"
 	"io/ioutil"
 	"log"
+	"net/http"
 	"os"
 	"path"
 	"path/filepath"
 	"runtime"
+	"strings"
 	"sync"
+	"time"
 )
 
 var store errord.Store
@@ -22,26 +25,58 @@ var ErrNotCausedByLine error = errors.New("Line does not contain 'Caused by'")
 var oldLogsPath = ""
 var tailPath = ""
 var emailConfigPath = ""
-
-type EmailConfig struct {
-	Host string
-	From string
-	Pass string
-	To   string
-}
-
-func (c EmailConfig) isEmpty() bool {
-	return c.Host == "" && c.From == "" && c.Pass == "" && c.To == ""
-}
+var notifierConfigPath = ""
+var rulesPath = ""
+var clusterWindow time.Duration
+var quietPeriod time.Duration
+var incidentUpdates time.Duration
+var listenAddr = ""
+var outboxMaxAge time.Duration
+var reportsPath = ""
+var service = ""
+var notifyPolicy errord.NotifyPolicy
+var ackURL = ""
+var ackSecret = ""
+var apiToken = ""
+var busConfig = ""
 
 func init() {
 	flag.StringVar(&oldLogsPath, "oldLogs", "", "Directory where old .log files are stored and need to be parsed")
 	flag.StringVar(&tailPath, "tailFile", "", "location of file to tail and watch")
 	flag.StringVar(&emailConfigPath, "emailConfig", "", "Path to email config json. If empty, notifications are written to stdout")
+	flag.StringVar(&notifierConfigPath, "notifierConfig", "", "Path to notifier config json. Takes precedence over -emailConfig")
+	flag.StringVar(&rulesPath, "rules", "", "Path to rules json. Rules are reloaded when the file changes")
+	flag.DurationVar(&quietPeriod, "quietPeriod", 30*time.Minute, "How long an exception must not be seen before its incident is resolved")
+	flag.DurationVar(&incidentUpdates, "incidentUpdates", time.Hour, "How often an ongoing notification is sent while an incident is open")
+	flag.StringVar(&listenAddr, "listen", "", "Address the HTTP API listens on, for example 127.0.0.1:8080. It serves events, summaries, stats and notifications as JSON. If empty, the API is not started")
+	flag.StringVar(&notifyPolicy.DedupBy, "dedupBy", errord.DEDUP_EXCEPTION, "Deduplicate notifications by exception or by fingerprint")
+	flag.DurationVar(&notifyPolicy.Renotify, "renotifyAfter", 0, "Notify again when an exception is still seen this long after its last notification. 0 notifies once per day")
+	flag.BoolVar(&notifyPolicy.Escalation, "renotifyOnEscalation", true, "Notify again when the severity of an exception is higher than when it was last notified")
+	flag.StringVar(&ackURL, "ackURL", "", "External URL of the HTTP API. With -ackSecret notifications of open incidents link to their acknowledgement")
+	flag.StringVar(&ackSecret, "ackSecret", "", "Secret acknowledge links are signed with")
+	flag.StringVar(&apiToken, "apiToken", "", "Token the HTTP API requires as 'Authorization: Bearer <token>' for releases, silences, maintenance windows and acknowledgements. If empty, the API only serves reads")
+	flag.StringVar(&service, "service", "", "Name of the service errord watches. Error events are associated with its releases and silences and maintenance windows can match on it")
+	flag.StringVar(&reportsPath, "reports", "", "Path to report schedules json. If empty, no scheduled reports are sent")
+	flag.DurationVar(&outboxMaxAge, "outboxMaxAge", errord.DEFAULT_OUTBOX_MAX_AGE, "How long failed notifications, also those held back for a cluster, digest or maintenance window, are retried before they are given up on")
+	flag.StringVar(&busConfig, "subscribers", errord.DEFAULT_BUS_CONFIG, "Buffer and overflow (block, drop-oldest or sample) of every subscriber of the event bus as name=overflow:buffer[:sample rate],...")
+	flag.DurationVar(&clusterWindow, "clusterWindow", time.Minute, "Window in which notifications of correlated exceptions are combined. 0 sends every notification on its own")
 }
 
 func main() {
-	flag.Parse()
+	if runCommand(os.Args[1:]) {
+		return
+	}
+	if len(os.Args) > 1 && !strings.HasPrefix(os.Args[1], "-") {
+		printUsage()
+		os.Exit(2)
+	}
+	log.Println("No command given. Running watch")
+	watchCommand(os.Args[1:])
+}
+
+// watchCommand runs errord as a daemon. It backfills -oldLogs, updates the stats and then tails -tailFile, notifying of anomalies
+func watchCommand(args []string) {
+	flag.CommandLine.Parse(args)
 	log.Println("Starting ErrorD")
 	defer log.Println("ErrorD  exiting")
 
@@ -50,6 +85,10 @@ func main() {
 	if tailPath == "" {
 		log.Fatalf("No File given to Tail and watch")
 	}
+	subscribers, err := errord.ParseBusConfig(busConfig)
+	if err != nil {
+		log.Fatalf("Invalid -subscribers: %v", err)
+	}
 	store = errord.NewStore()
 	errs := store.Init()
 	if len(errs) > 0 {
@@ -57,20 +96,107 @@ func main() {
 	} else {
 		log.Println("Database initiliazed")
 	}
+	if err := store.SetNotifyPolicy(notifyPolicy); err != nil {
+		log.Fatalf("Invalid notification policy: %v", err)
+	}
+	store.SetService(service)
+	store.SetOutboxMaxAge(outboxMaxAge)
+	links := errord.NewAckLinks(ackURL, ackSecret)
+	stream := errord.NewStream(errord.STREAM_BACKLOG)
+	if listenAddr != "" {
+		go serveAPI(listenAddr, store, links, stream, apiToken)
+	}
 	loadAll(store.Errors(), store.Metrics(), findAllFilesToParse(oldLogsPath))
-	statEngine := errord.NewStatEngine(store)
+	rules := loadRules(rulesPath)
+	if rules != nil {
+		rules.Seed(store.Errors().FetchErrorEvents(time.Now().Add(-rules.MaxWindow())))
+	}
+	statEngine := errord.NewStatEngine(store, rules)
 	statEngine.Init()
+	statEngine.OnDecision(stream.PublishDecision)
 	log.Printf("Stat Engine initialized")
-	notifier := createNotifier(emailConfigPath, store.Notifications())
+	base := createNotifier(notifierConfigPath, emailConfigPath, store, links)
+	notifier := base
+	if clusterWindow > 0 {
+		notifier = errord.NewClusterNotifier(notifier, clusterWindow, store.Errors(), store.Notifications(), store.Outbox())
+	}
+	silences := errord.NewSilenceNotifier(notifier, store.Silences(), service, store.Outbox())
+	silences.Watch(time.Minute)
+	// incidents and the policy decide once whether to notify, so notifications are written to the outbox as soon as they have
+	// decided and everything after it is retried by the outbox
+	outbox := errord.NewOutboxNotifier(silences, store.Outbox())
+	outbox.Watch(time.Minute)
+	if router, ok := base.(*errord.Router); ok {
+		// escalations are retried by the outbox and silenced like the notifications they escalate
+		router.EscalateThrough(outbox)
+		router.Watch(time.Minute)
+	}
+	scheduleReports(reportsPath, outbox, store)
+	notifier = errord.NewPolicyNotifier(outbox, store.Notifications())
+	incidents := errord.NewIncidentNotifier(notifier, store.Incidents(), quietPeriod, incidentUpdates, links)
+	incidents.Watch(time.Minute)
+	bus := errord.NewEventBus()
+	events := subscribe(bus, subscribers, "stats")
+	go errord.METRICS.CountEvents(subscribe(bus, subscribers, "metrics"))
+	go stream.Listen(subscribe(bus, subscribers, "stream"))
 	logParser := errord.NewLogFileParser(store.Errors(), store.Metrics())
 	log.Printf("Watching %v", tailPath)
-	eventBus := logParser.Watch(tailPath)
+	logParser.Watch(tailPath, bus)
 	log.Printf("Stat Engine listening for events from event bus")
-	statEngine.Listen(eventBus, notifier)
+	statEngine.Listen(events, incidents)
 }
 
-func readEmailConfig(path string) EmailConfig {
-	var config EmailConfig
+// subscribe subscribes the named subscriber to the bus, blocking with a buffer of 1000 when -subscribers does not configure it
+func subscribe(bus *errord.EventBus, subscribers map[string]errord.SubscriberConfig, name string) chan errord.ErrorEvent {
+	c, ok := subscribers[name]
+	if !ok {
+		c = errord.SubscriberConfig{Buffer: 1000, Overflow: errord.OVERFLOW_BLOCK}
+	}
+	s, err := bus.Subscribe(name, c)
+	if err != nil {
+		log.Fatalf("Failed subscribing %v to the event bus: %v", name, err)
+	}
+	return s.Events
+}
+
+func serveAPI(addr string, s errord.Store, links *errord.AckLinks, stream *errord.Stream, token string) {
+	log.Printf("API listening on %v", addr)
+	if err := http.ListenAndServe(addr, errord.NewAPI(s, links, stream, token)); err != nil {
+		log.Fatalf("API stopped: %v", err)
+	}
+}
+
+func scheduleReports(path string, n errord.Notifier, s errord.Store) {
+	if path == "" {
+		return
+	}
+	schedules, err := errord.ReadReportSchedules(path)
+	if err != nil {
+		log.Fatalf("Failed reading report schedules from %v: %v", path, err)
+	}
+	scheduler, err := errord.NewReportScheduler(schedules, n, s.Stats(), s.Issues(), s.Errors())
+	if err != nil {
+		log.Fatalf("Invalid report schedule in %v: %v", path, err)
+	}
+	scheduler.Watch()
+	log.Printf("Scheduled %v report(s)", len(schedules))
+}
+
+func loadRules(path string) *errord.RuleSet {
+	if path == "" {
+		log.Printf("No rules given. Only the statistical limit will be used")
+		return nil
+	}
+	rules, err := errord.LoadRuleSet(path)
+	if err != nil {
+		log.Fatalf("Failed loading rules from %v: %v", path, err)
+	}
+	rules.WatchForChanges(30 * time.Second)
+	return rules
+}
+
+func readEmailConfig(path string) errord.EmailConfig {
+	var config errord.EmailConfig
 	if path == "" {
 		return config
 	}
@@ -83,14 +209,30 @@ func readEmailConfig(path string) EmailConfig {
 	return config
 }
 
-func createNotifier(emailConfigPath string, store errord.NotifyStore) errord.Notifier {
+func createNotifier(notifierConfigPath, emailConfigPath string, s errord.Store, links *errord.AckLinks) errord.Notifier {
+	if notifierConfigPath != "" {
+		config, err := errord.ReadNotificationConfig(notifierConfigPath)
+		if err != nil {
+			log.Fatalf("Failed reading notifier config %v: %v", notifierConfigPath, err)
+		}
+		n, err := errord.NewNotifierFromNotificationConfig(config, s, links)
+		if err != nil {
+			log.Fatalf("Failed creating notifiers: %v", err)
+		}
+		log.Printf("Created %v notifier(s) with %v route(s)", len(config.Notifiers), len(config.Routes))
+		return n
+	}
 	c := readEmailConfig(emailConfigPath)
-	if c.isEmpty() {
+	if c == (errord.EmailConfig{}) {
 		log.Printf("Email Config is empty. Creating Console Notifier")
-		return errord.NewConsoleNotifier(store)
+		return errord.NewMetricsNotifier(errord.NewConsoleNotifier(s.Notifications()), "console", errord.METRICS)
 	}
 	log.Printf("Creating Email Config notifier")
-	return errord.NewEmailNotifier(c.Host, c.From, c.Pass, c.To, store)
+	n, err := errord.NewEmailNotifier(c, s.Stats(), s.Notifications())
+	if err != nil {
+		log.Fatalf("Invalid email config %v: %v", emailConfigPath, err)
+	}
+	return errord.NewMetricsNotifier(n, "email", errord.METRICS)
 }
 
 func findAllFilesToParse(dir string) []string {
@@ -108,10 +250,13 @@ func findAllFilesToParse(dir string) []string {
 	return files
 }
 
-func loadAll(es errord.ErrorStore, ms errord.MetricStore, files []string) {
+// loadAll parses the files in parallel and returns the stats of every file
+func loadAll(es errord.ErrorStore, ms errord.MetricStore, files []string) map[string]errord.ParseStats {
 	if len(files) == 0 {
 		log.Printf("Empty list of files received. Not loading any files")
 	}
+	stats := make(map[string]errord.ParseStats)
+	var lock sync.Mutex
 	goGroup := new(sync.WaitGroup)
 	goGroup.Add(len(files))
 	for _, filePath := range files {
@@ -120,8 +265,12 @@ func loadAll(es errord.ErrorStore, ms errord.MetricStore, files []string) {
 			log.Printf("Loading File: %v\n", path)
 			parseStats := parser.Parse(path)
 			log.Printf("File: %v Stats -> %v", path, parseStats)
+			lock.Lock()
+			stats[path] = parseStats
+			lock.Unlock()
 			goGroup.Done()
 		}(es, ms, filePath)
 	}
 	goGroup.Wait()
+	return stats
 }